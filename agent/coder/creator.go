@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	jarvisTools "jarvis/agent/tools"
+	"jarvis/agent/utils/kafka"
+
+	"github.com/tmc/langchaingo/agents"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/tools"
+)
+
+// maxResultDiff keeps published results well under Kafka's default 1 MB
+// message limit
+const maxResultDiff = 512 * 1024
+
+// CoderAgent works on coding requests in a git workspace, following a
+// plan -> edit -> test -> commit loop
+type CoderAgent struct {
+	llm           llms.Model
+	executor      *agents.Executor
+	userID        string
+	workspaceRoot string
+	maxAttempts   int
+	testTimeout   int
+}
+
+// CoderConfig holds configuration for creating a coder agent
+type CoderConfig struct {
+	UserID        string
+	OllamaHost    string
+	OllamaModel   string
+	WorkspaceRoot string
+	// MaxAttempts is how many times the agent may edit before giving up on
+	// failing tests
+	MaxAttempts int
+	// TestTimeout is the test run timeout in seconds
+	TestTimeout int
+}
+
+// NewCoderAgent creates a new coder agent instance
+func NewCoderAgent(config CoderConfig) (*CoderAgent, error) {
+	ollamaHost := config.OllamaHost
+	if ollamaHost == "" {
+		ollamaHost = "http://localhost:11434"
+	}
+
+	ollamaModel := config.OllamaModel
+	if ollamaModel == "" {
+		ollamaModel = "llama3.2"
+	}
+
+	if config.WorkspaceRoot == "" {
+		return nil, fmt.Errorf("workspace root is required")
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.TestTimeout <= 0 {
+		config.TestTimeout = 600
+	}
+
+	llm, err := ollama.New(
+		ollama.WithServerURL(ollamaHost),
+		ollama.WithModel(ollamaModel),
+		ollama.WithHTTPClient(&http.Client{
+			Timeout: 5 * time.Minute,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize Ollama: %v", err)
+	}
+
+	var allTools []tools.Tool
+
+	// The loop commits once the tests pass, but the agent may also commit
+	// or open a pull request itself; the loop picks up either
+	allTools = append(allTools, jarvisTools.GetFileTools()...)
+	allTools = append(allTools, jarvisTools.GetExecutionTools()...)
+	allTools = append(allTools, jarvisTools.GetEnvironmentTools()...)
+	allTools = append(allTools, jarvisTools.GetCommunicationTools()...)
+	allTools = append(allTools, jarvisTools.GetTestTools()...)
+	allTools = append(allTools,
+		jarvisTools.GitStatusTool{},
+		jarvisTools.GitDiffTool{},
+		jarvisTools.GitLogTool{},
+	)
+
+	agent := agents.NewConversationalAgent(llm, allTools)
+	executor := agents.NewExecutor(agent, agents.WithMaxIterations(25))
+
+	return &CoderAgent{
+		llm:           llm,
+		executor:      executor,
+		userID:        config.UserID,
+		workspaceRoot: config.WorkspaceRoot,
+		maxAttempts:   config.MaxAttempts,
+		testTimeout:   config.TestTimeout,
+	}, nil
+}
+
+// Process handles one coding request and always returns a result to publish;
+// failures are reported in its Status and Error fields
+func (ca *CoderAgent) Process(ctx context.Context, message kafka.AgentMessage) kafka.CoderResult {
+	result := kafka.CoderResult{
+		ID:        fmt.Sprintf("result_%d", time.Now().UnixNano()),
+		RequestID: message.ID,
+		UserID:    message.UserID,
+		Status:    "failed",
+	}
+
+	var ws *workspace
+	fail := func(err error) kafka.CoderResult {
+		// restoreBranch deletes a branch nothing was committed to
+		if ws == nil || !ws.hasCommits(context.Background()) {
+			result.Branch = ""
+		}
+		result.Error = err.Error()
+		result.Timestamp = time.Now().Unix()
+		return result
+	}
+
+	if strings.TrimSpace(message.Demand) == "" {
+		return fail(fmt.Errorf("demand cannot be empty"))
+	}
+
+	dir, err := resolveWorkspace(ca.workspaceRoot, message)
+	if err != nil {
+		return fail(err)
+	}
+	result.Workspace = dir
+
+	ws, err = openWorkspace(ctx, dir)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.Branch, err = ws.startBranch(ctx, "coder/"+branchSafe(message.ID))
+	if err != nil {
+		return fail(err)
+	}
+	// Leave the workspace on the branch it was on for the next request
+	defer func() {
+		if err := ws.restoreBranch(context.Background()); err != nil {
+			log.Printf("Failed to restore branch in %s: %v", dir, err)
+		}
+	}()
+
+	// Plan
+	result.Plan, err = ca.plan(ctx, ws, message.Demand)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Edit and test until the tests pass or we run out of attempts
+	prompt := editPrompt(dir, message.Demand, result.Plan)
+	var report *jarvisTools.TestReport
+	for attempt := 1; attempt <= ca.maxAttempts; attempt++ {
+		log.Printf("Request %s: edit attempt %d/%d", message.ID, attempt, ca.maxAttempts)
+
+		summary, err := ca.edit(ctx, prompt)
+		if err != nil {
+			return fail(err)
+		}
+		result.Summary = summary
+
+		report, err = jarvisTools.RunTests(ctx, dir, ca.testTimeout)
+		if err != nil {
+			return fail(fmt.Errorf("failed to run tests: %v", err))
+		}
+		if report == nil || testsPassed(report) {
+			break
+		}
+
+		prompt = fixPrompt(dir, message.Demand, report)
+	}
+	result.Tests = describeTests(report)
+
+	// Commit whatever the agent left uncommitted
+	staged, err := ws.stageAll(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	commitMessage := commitSubject(message.Demand)
+	result.Status = "committed"
+	if report != nil && !testsPassed(report) {
+		// Keep the work on the branch, but make the state obvious
+		commitMessage = "WIP: " + commitMessage
+		result.Status = "tests_failed"
+	}
+
+	if strings.TrimSpace(staged) != "" {
+		if err := ws.commit(ctx, commitMessage+"\n\n"+message.Demand); err != nil {
+			return fail(err)
+		}
+	}
+
+	result.Commit, result.Diff, err = ws.branchDiff(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	if strings.TrimSpace(result.Diff) == "" {
+		result.Status = "no_changes"
+		if !ws.committed {
+			result.Branch = ""
+			result.Commit = ""
+		}
+	}
+	if len(result.Diff) > maxResultDiff {
+		result.Diff = result.Diff[:maxResultDiff]
+		result.DiffTruncated = true
+	}
+
+	result.Timestamp = time.Now().Unix()
+	return result
+}
+
+const planPrompt = `You are a senior software engineer planning a change to a repository.
+
+Request:
+%s
+
+Files in the repository:
+%s
+
+Write a short numbered plan (at most 8 steps) of concrete changes that fulfil the request, naming the files to create or change. Include adding or updating tests. Respond with the numbered list only.`
+
+var planStep = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*])\s+(.+)$`)
+
+// plan asks the LLM for a list of steps for the request
+func (ca *CoderAgent) plan(ctx context.Context, ws *workspace, demand string) ([]string, error) {
+	files, err := ws.files(ctx, 200)
+	if err != nil {
+		return nil, err
+	}
+	if files == "" {
+		files = "(empty repository)"
+	}
+
+	response, err := llms.GenerateFromSinglePrompt(ctx, ca.llm, fmt.Sprintf(planPrompt, demand, files), llms.WithTemperature(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan: %v", err)
+	}
+
+	var steps []string
+	for _, line := range strings.Split(response, "\n") {
+		if m := planStep.FindStringSubmatch(line); m != nil {
+			steps = append(steps, strings.TrimSpace(m[1]))
+		}
+	}
+	if len(steps) == 0 && strings.TrimSpace(response) != "" {
+		steps = []string{strings.TrimSpace(response)}
+	}
+
+	return steps, nil
+}
+
+// edit runs the tool-using agent on a prompt and returns its final answer
+func (ca *CoderAgent) edit(ctx context.Context, prompt string) (string, error) {
+	result, err := ca.executor.Call(ctx, map[string]any{
+		"input": prompt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("agent processing error: %v", err)
+	}
+
+	if output, ok := result["output"]; ok {
+		return fmt.Sprintf("%v", output), nil
+	}
+	return fmt.Sprintf("%v", result), nil
+}
+
+func editPrompt(dir, demand string, plan []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are working in the git repository at %s. Use absolute paths under that directory for every file operation and pass it as working_dir or project_dir to tools that take one.\n\n", dir)
+	fmt.Fprintf(&b, "Request:\n%s\n\nPlan:\n", demand)
+	for i, step := range plan {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, step)
+	}
+	b.WriteString("\nCarry out the plan by reading and writing files. Run the tests with run_tests when you are done. Your changes are committed for you; finish with a short summary of what you changed.")
+	return b.String()
+}
+
+func fixPrompt(dir, demand string, report *jarvisTools.TestReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are working in the git repository at %s on this request:\n%s\n\n", dir, demand)
+	fmt.Fprintf(&b, "The tests fail after your changes (%s). Fix the code so that they pass.\n\nFailures:\n", describeTests(report))
+	for _, f := range report.Failures {
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		fmt.Fprintf(&b, "- %s %s\n%s\n", f.Name, location, f.Message)
+	}
+	if len(report.Failures) == 0 && report.Output != "" {
+		fmt.Fprintf(&b, "%s\n", report.Output)
+	}
+	b.WriteString("\nYour changes are committed for you; finish with a short summary of what you changed.")
+	return b.String()
+}
+
+func testsPassed(report *jarvisTools.TestReport) bool {
+	return report.Failed == 0 && report.ExitCode == 0 && !report.TimedOut
+}
+
+func describeTests(report *jarvisTools.TestReport) string {
+	if report == nil {
+		return "no tests detected"
+	}
+	s := fmt.Sprintf("%s: %d passed, %d failed, %d skipped", report.Framework, report.Passed, report.Failed, report.Skipped)
+	if report.TimedOut {
+		s += " (timed out)"
+	} else if report.Failed == 0 && report.ExitCode != 0 {
+		s += fmt.Sprintf(" (exit code %d)", report.ExitCode)
+	}
+	return s
+}
+
+// commitSubject turns the first line of a request into a commit subject
+func commitSubject(demand string) string {
+	subject := strings.TrimSpace(strings.SplitN(strings.TrimSpace(demand), "\n", 2)[0])
+	if len(subject) > 72 {
+		subject = strings.TrimSpace(subject[:69]) + "..."
+	}
+	return subject
+}
+
+var unsafeBranchChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// branchSafe makes a message ID usable as part of a branch name
+func branchSafe(id string) string {
+	id = strings.Trim(unsafeBranchChars.ReplaceAllString(id, "-"), "-.")
+	if id == "" {
+		id = fmt.Sprintf("%d", time.Now().Unix())
+	}
+	return id
+}
+
+// GetUserID returns the user ID associated with this agent
+func (ca *CoderAgent) GetUserID() string {
+	return ca.userID
+}
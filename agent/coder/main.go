@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"jarvis/agent/utils/kafka"
+)
+
+// CoderServer consumes coding requests and publishes their results
+type CoderServer struct {
+	agent       *CoderAgent
+	consumer    *kafka.Consumer
+	taskTimeout time.Duration
+	processed   atomic.Int64
+	busy        atomic.Bool
+}
+
+// handleRequest runs one request to completion and publishes the result.
+// Requests are handled one at a time since they share workspaces.
+func (s *CoderServer) handleRequest(ctx context.Context, message kafka.AgentMessage) error {
+	s.busy.Store(true)
+	defer s.busy.Store(false)
+
+	taskCtx, cancel := context.WithTimeout(ctx, s.taskTimeout)
+	defer cancel()
+
+	start := time.Now()
+	result := s.agent.Process(taskCtx, message)
+	s.processed.Add(1)
+	log.Printf("Request %s finished in %s: %s %s", message.ID, time.Since(start).Round(time.Second), result.Status, result.Error)
+
+	// Publish even if the service is shutting down
+	sendCtx, sendCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer sendCancel()
+
+	return kafka.SendCoderResult(sendCtx, result)
+}
+
+func (s *CoderServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "healthy",
+		"service":   "coder",
+		"userID":    s.agent.GetUserID(),
+		"busy":      s.busy.Load(),
+		"processed": s.processed.Load(),
+	})
+}
+
+func main() {
+	userID := getEnvOrDefault("USER_ID", "default")
+
+	agent, err := NewCoderAgent(CoderConfig{
+		UserID:        userID,
+		OllamaHost:    getEnvOrDefault("OLLAMA_HOST", "http://ollama:11434"),
+		OllamaModel:   getEnvOrDefault("OLLAMA_MODEL", "llama3.2"),
+		WorkspaceRoot: getEnvOrDefault("CODER_WORKSPACE_ROOT", "/workspace"),
+		MaxAttempts:   getEnvInt("CODER_MAX_ATTEMPTS", 3),
+		TestTimeout:   getEnvInt("CODER_TEST_TIMEOUT", 600),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create coder agent: %v", err)
+	}
+
+	consumer, err := kafka.NewConsumer(kafka.CoderAgentTopic, getEnvOrDefault("CODER_CONSUMER_GROUP", "coder-agent"))
+	if err != nil {
+		log.Fatalf("Failed to create consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	server := &CoderServer{
+		agent:       agent,
+		consumer:    consumer,
+		taskTimeout: time.Duration(getEnvInt("CODER_TASK_TIMEOUT", 1800)) * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	port := getEnvOrDefault("PORT", "8080")
+	http.HandleFunc("/health", server.handleHealth)
+	go func() {
+		log.Printf("Starting coder health server on port %s", port)
+		if err := http.ListenAndServe(":"+port, nil); err != nil {
+			log.Printf("Health server stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Coder agent for user %s consuming %s", userID, kafka.CoderAgentTopic)
+	if err := consumer.Consume(ctx, server.handleRequest); err != nil {
+		log.Fatalf("Consumer stopped: %v", err)
+	}
+	log.Printf("Shutting down coder agent")
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"jarvis/agent/utils/kafka"
+)
+
+// workspace is a git checkout the coder works in
+type workspace struct {
+	dir string
+	// original is the branch checked out before the request, or its commit
+	// if HEAD was detached, empty if the repository had no commits yet
+	original string
+	// branch is the request's branch, start the commit it started from
+	// (empty in a new repository) and committed whether anything was
+	// committed to it
+	branch    string
+	start     string
+	committed bool
+}
+
+// emptyTree is git's hash of the empty tree, the base of a diff of a
+// repository's first commits
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// resolveWorkspace returns the directory for a request: the message's
+// workspace under root if set, otherwise a directory per user
+func resolveWorkspace(root string, message kafka.AgentMessage) (string, error) {
+	name := message.Workspace
+	if name == "" {
+		name = message.UserID
+	}
+	if name == "" {
+		name = "default"
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid workspace root: %v", err)
+	}
+
+	dir := filepath.Join(root, filepath.Clean("/"+name))
+	if dir == root {
+		return "", fmt.Errorf("invalid workspace %q", message.Workspace)
+	}
+
+	return dir, nil
+}
+
+// openWorkspace prepares dir as a git repository with a clean working tree
+func openWorkspace(ctx context.Context, dir string) (*workspace, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %v", err)
+	}
+
+	ws := &workspace{dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := ws.git(ctx, "init"); err != nil {
+			return nil, err
+		}
+	}
+
+	status, err := ws.git(ctx, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(status) != "" {
+		return nil, fmt.Errorf("workspace %s has uncommitted changes", dir)
+	}
+
+	if head, err := ws.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+		branch, err := ws.git(ctx, "rev-parse", "--abbrev-ref", "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		ws.original = strings.TrimSpace(branch)
+		// A detached checkout is restored by commit
+		if ws.original == "HEAD" {
+			ws.original = strings.TrimSpace(head)
+		}
+		ws.start = strings.TrimSpace(head)
+	}
+
+	return ws, nil
+}
+
+// startBranch creates and checks out the branch the request's work goes
+// on, adding a suffix if a branch of that name exists, and returns its name
+func (ws *workspace) startBranch(ctx context.Context, branch string) (string, error) {
+	name := branch
+	for i := 2; ; i++ {
+		if _, err := ws.git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+name); err != nil {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", branch, i)
+	}
+
+	if _, err := ws.git(ctx, "checkout", "-q", "-b", name); err != nil {
+		return "", err
+	}
+	ws.branch = name
+	return name, nil
+}
+
+// restoreBranch returns to the branch checked out before the request
+func (ws *workspace) restoreBranch(ctx context.Context) error {
+	// Anything left uncommitted belongs to a failed request; drop it so
+	// the next request starts from a clean tree
+	if ws.original == "" {
+		if _, err := ws.git(ctx, "rev-parse", "--verify", "--quiet", "HEAD"); err == nil {
+			// The request made the first commit; stay on its branch
+			if _, err := ws.git(ctx, "reset", "-q", "--hard"); err != nil {
+				return err
+			}
+			_, err := ws.git(ctx, "clean", "-fd")
+			return err
+		}
+		if _, err := ws.git(ctx, "rm", "-r", "-q", "--cached", "--ignore-unmatch", "."); err != nil {
+			return err
+		}
+		_, err := ws.git(ctx, "clean", "-fd")
+		return err
+	}
+
+	committed := ws.hasCommits(ctx)
+
+	if _, err := ws.git(ctx, "reset", "--hard"); err != nil {
+		return err
+	}
+	if _, err := ws.git(ctx, "clean", "-fd"); err != nil {
+		return err
+	}
+	if _, err := ws.git(ctx, "checkout", "-q", ws.original); err != nil {
+		return err
+	}
+
+	if !committed {
+		_, err := ws.git(ctx, "branch", "-D", ws.branch)
+		return err
+	}
+	return nil
+}
+
+// hasCommits reports whether anything was committed on the request's
+// branch, by the loop or by the agent through its git tools
+func (ws *workspace) hasCommits(ctx context.Context) bool {
+	if ws.committed || ws.branch == "" {
+		return ws.committed
+	}
+	head, err := ws.git(ctx, "rev-parse", "--verify", "--quiet", "refs/heads/"+ws.branch)
+	if err == nil && strings.TrimSpace(head) != ws.start {
+		ws.committed = true
+	}
+	return ws.committed
+}
+
+// branchDiff returns the request branch's head commit and its diff against
+// the commit the branch started from
+func (ws *workspace) branchDiff(ctx context.Context) (string, string, error) {
+	if !ws.hasCommits(ctx) {
+		return "", "", nil
+	}
+	head, err := ws.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	base := ws.start
+	if base == "" {
+		base = emptyTree
+	}
+	diff, err := ws.git(ctx, "diff", "--no-color", "--no-ext-diff", base, "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(head), diff, nil
+}
+
+// files lists up to limit tracked and untracked files
+func (ws *workspace) files(ctx context.Context, limit int) (string, error) {
+	out, err := ws.git(ctx, "ls-files", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return "", err
+	}
+
+	files := strings.Split(strings.TrimSpace(out), "\n")
+	if len(files) > limit {
+		files = append(files[:limit], fmt.Sprintf("... and %d more", len(files)-limit))
+	}
+	return strings.TrimSpace(strings.Join(files, "\n")), nil
+}
+
+// stageAll stages every change and returns the staged diff
+func (ws *workspace) stageAll(ctx context.Context) (string, error) {
+	if _, err := ws.git(ctx, "add", "-A"); err != nil {
+		return "", err
+	}
+	return ws.git(ctx, "diff", "--cached", "--no-color", "--no-ext-diff")
+}
+
+// commit commits the staged changes
+func (ws *workspace) commit(ctx context.Context, message string) error {
+	if _, err := ws.git(ctx, "commit", "-q", "-m", message); err != nil {
+		return err
+	}
+	ws.committed = true
+	return nil
+}
+
+// git runs a git command in the workspace and returns its stdout
+func (ws *workspace) git(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = ws.dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_AUTHOR_NAME="+getEnvOrDefault("CODER_GIT_NAME", "Jarvis Coder"),
+		"GIT_AUTHOR_EMAIL="+getEnvOrDefault("CODER_GIT_EMAIL", "coder@jarvis.local"),
+		"GIT_COMMITTER_NAME="+getEnvOrDefault("CODER_GIT_NAME", "Jarvis Coder"),
+		"GIT_COMMITTER_EMAIL="+getEnvOrDefault("CODER_GIT_EMAIL", "coder@jarvis.local"),
+	)
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	jarvisTools "jarvis/agent/tools"
 )
 
 type AgentServer struct {
@@ -60,7 +66,8 @@ func (s *AgentServer) handleAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Tie the agent run to the request so a client disconnect stops running tools
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
 	response, err := s.agent.ProcessMessage(ctx, req.Message)
@@ -78,6 +85,53 @@ func (s *AgentServer) handleAgent(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleReview runs the review workflow directly, without going through the
+// conversational agent. Reviews make one LLM call per diff chunk, so they get
+// a longer timeout than /agent. Like the review_code tool it responds with
+// markdown unless the request sets "format": "json". Bad requests get 400,
+// timeouts 504 and LLM or forge failures 502.
+func (s *AgentServer) handleReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req jarvisTools.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	review, err := s.agent.Review(ctx, req)
+	if err != nil {
+		var inputErr *jarvisTools.ReviewInputError
+		status := http.StatusBadGateway
+		switch {
+		case errors.As(err, &inputErr):
+			status = http.StatusBadRequest
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(MessageResponse{Error: err.Error()})
+		return
+	}
+
+	if strings.ToLower(req.Format) == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Write([]byte(review.Markdown()))
+}
+
 func (s *AgentServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -108,9 +162,23 @@ func main() {
 	port := getEnvOrDefault("PORT", "8080")
 
 	http.HandleFunc("/agent", server.handleAgent)
+	http.HandleFunc("/review", server.handleReview)
 	http.HandleFunc("/health", server.handleHealth)
 	http.HandleFunc("/capabilities", server.handleCapabilities)
 
+	// Stop background processes when the session ends
+	go func() {
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		<-sigChan
+
+		log.Printf("Shutting down agent session for user %s", userID)
+		if err := server.agent.Close(); err != nil {
+			log.Printf("Error closing agent: %v", err)
+		}
+		os.Exit(0)
+	}()
+
 	log.Printf("Starting agent server for user %s on port %s", userID, port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
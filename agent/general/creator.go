@@ -19,6 +19,7 @@ type JarvisAgent struct {
 	executor       *agents.Executor
 	userID         string
 	knowledgeGraph *db.KnowledgeGraph
+	reviewer       jarvisTools2.CodeReviewTool
 }
 
 // AgentConfig holds configuration for creating an agent
@@ -69,7 +70,15 @@ func NewJarvisAgent(config AgentConfig) (*JarvisAgent, error) {
 	// Add custom tools
 	allTools = append(allTools, jarvisTools2.GetFileTools()...)
 	allTools = append(allTools, jarvisTools2.GetExecutionTools()...)
+	allTools = append(allTools, jarvisTools2.GetProcessTools(config.UserID)...)
 	allTools = append(allTools, jarvisTools2.GetEnvironmentTools()...)
+	allTools = append(allTools, jarvisTools2.GetTestTools()...)
+	allTools = append(allTools, jarvisTools2.GetCommunicationTools()...)
+	allTools = append(allTools, jarvisTools2.GetEmailTools(config.UserID)...)
+
+	// The reviewer makes its own LLM calls per diff chunk
+	reviewer := jarvisTools2.NewCodeReviewTool(llm)
+	allTools = append(allTools, reviewer)
 
 	// Add web tools
 	allTools = append(allTools, webTools...)
@@ -94,6 +103,7 @@ func NewJarvisAgent(config AgentConfig) (*JarvisAgent, error) {
 		executor:       executor,
 		userID:         config.UserID,
 		knowledgeGraph: kg,
+		reviewer:       reviewer,
 	}, nil
 }
 
@@ -167,11 +177,26 @@ func (ja *JarvisAgent) ProcessMessage(ctx context.Context, message string) (stri
 	return response, nil
 }
 
+// Close ends the agent session, stopping its background processes
+func (ja *JarvisAgent) Close() error {
+	jarvisTools2.DefaultProcessManager.StopAll(ja.userID)
+
+	if ja.knowledgeGraph != nil {
+		return ja.knowledgeGraph.Close()
+	}
+	return nil
+}
+
 // GetUserID returns the user ID associated with this agent
 func (ja *JarvisAgent) GetUserID() string {
 	return ja.userID
 }
 
+// Review reviews a branch, staged changes or pull request
+func (ja *JarvisAgent) Review(ctx context.Context, req jarvisTools2.ReviewRequest) (*jarvisTools2.Review, error) {
+	return ja.reviewer.Review(ctx, req)
+}
+
 // GetAvailableTools returns a list of available tool names
 func (ja *JarvisAgent) GetAvailableTools() []string {
 	tools := []string{
@@ -179,10 +204,18 @@ func (ja *JarvisAgent) GetAvailableTools() []string {
 		"read_file", "write_file", "delete_file", "list_files",
 		// Execution Tools
 		"run_code", "execute_terminal", "evaluate_expression",
+		// Background Processes
+		"start_process", "read_process_output", "write_process_input", "list_processes", "stop_process",
 		// Environment Management
 		"install_package", "check_version", "lint_code",
+		// Testing
+		"run_tests",
 		// Communication Tools
-		"commit_to_git", "create_pull_request", "comment_diff",
+		"commit_to_git", "create_pull_request", "list_pull_requests", "get_pull_request_diff", "comment_diff",
+		"git_status", "git_diff", "git_log", "git_branch", "git_stash", "git_clone",
+		"email_tool",
+		// Code Review
+		"review_code",
 		// Web Tools
 		"web_scraper", "Wikipedia",
 	}
@@ -199,19 +232,38 @@ func (ja *JarvisAgent) GetCapabilities() map[string][]string {
 			"List directory contents",
 		},
 		"Code Execution": {
-			"Execute code (Python, Go, JavaScript, Bash)",
+			"Execute code (Python, Go, JavaScript, TypeScript, Ruby, Rust, C/C++, Java, Bash) with multi-file projects and dependencies",
 			"Run terminal commands",
 			"Evaluate mathematical expressions",
 		},
+		"Background Processes": {
+			"Start dev servers and watch builds in the background",
+			"Read incremental stdout/stderr",
+			"Send input to running processes",
+			"List and stop running processes",
+		},
 		"Environment Management": {
-			"Install packages (npm, pip, go get, etc.)",
+			"Install, uninstall and list packages in per-workspace environments (venv, node_modules, go.mod, Cargo.toml)",
 			"Check tool versions",
-			"Run code linters",
+			"Run code linters with structured diagnostics and autofixes",
+		},
+		"Testing": {
+			"Run Go, pytest and jest test suites",
+			"Report pass/fail/skip counts with failure locations",
 		},
 		"Communication": {
 			"Git commit operations",
-			"Create GitHub/GitLab pull requests",
-			"Comment on diffs/PRs",
+			"Inspect status, diffs and history of a repository",
+			"Create and switch branches, stash changes and clone local repositories",
+			"Create and list GitHub/GitLab pull requests",
+			"Fetch pull request diffs",
+			"Comment on pull requests, inline at file:line",
+			"Send email with attachments to allow-listed recipients",
+		},
+		"Code Review": {
+			"Review branches, staged changes and pull requests",
+			"Report findings with severity at file:line",
+			"Post review summaries and inline comments to GitHub/GitLab",
 		},
 		"Web & Research": {
 			"Scrape web content",
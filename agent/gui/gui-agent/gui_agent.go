@@ -88,6 +88,10 @@ func (ga *GUIAgent) ProcessMessage(ctx context.Context, message string) (string,
 
 	// Try up to 5 iterations to complete the task
 	for i := 0; i < 10; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", fmt.Errorf("GUI agent cancelled: %v", err)
+		}
+
 		log.Printf("GUI Agent iteration %d", i+1)
 
 		// Generate response
@@ -122,6 +126,9 @@ func (ga *GUIAgent) ProcessMessage(ctx context.Context, message string) (string,
 			// Execute tool
 			inputJSON, _ := json.Marshal(call.Input)
 			result, err := tool.Call(ctx, string(inputJSON))
+			if ctx.Err() != nil {
+				return "", fmt.Errorf("GUI agent cancelled: %v", ctx.Err())
+			}
 			if err != nil {
 				log.Printf("Tool error: %v", err)
 				msgs = append(msgs, llms.TextParts(llms.ChatMessageTypeHuman,
@@ -200,6 +207,7 @@ Important guidelines:
 - For clicking UI elements: First use find_element or find_coordinates to locate it, then use click_mouse with those coordinates
 - For typing: Use type_text with the text you want to type
 - For screenshots: Use take_screenshot to capture the screen
+- After an action that changes the screen (opening an app, clicking a button), use wait_until (e.g. window_exists or region_stable) before the next step instead of guessing a delay
 - For information requests: Use find_element, describe_screen, or detect_text and then return the result directly to the user
 - Always respond with valid JSON when using a tool
 - Only use one tool at a time
@@ -258,17 +266,21 @@ func (ga *GUIAgent) GetCapabilities() map[string][]string {
 			"Type text strings",
 			"Press key combinations (Ctrl+C, etc.)",
 			"Hold and release keys",
-			"Paste text via clipboard",
+			"Paste text via clipboard, optionally restoring the previous clipboard",
+			"Read and set the clipboard (text, images and files)",
 		},
 		"Screen Operations": {
-			"Capture screenshots (base64 PNG)",
+			"Capture screenshots of the screen, a region or a window (PNG/JPEG, downscaled)",
 			"Get cursor position",
+			"Find known images on screen and read pixel colors",
 			"Wait/delay operations",
+			"Wait until the screen changes, settles or shows an image, color or window",
 		},
 		"Application Control": {
-			"Launch applications",
-			"Activate windows",
-			"File read/write operations",
+			"Launch configured applications and .desktop entries, waiting for their window",
+			"Run tasks on isolated virtual displays, one per session",
+			"List, activate, move, resize, minimize, maximize and close windows",
+			"Read, write, list, inspect and delete files inside a sandboxed directory",
 		},
 		"Visual Analysis": {
 			"Find UI elements by description",
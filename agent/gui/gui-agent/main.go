@@ -57,7 +57,8 @@ func (s *GUIAgentServer) handleAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Hour)
+	// Tie the agent run to the request so a client disconnect stops GUI actions
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Hour)
 	defer cancel()
 
 	response, err := s.agent.ProcessMessage(ctx, req.Message)
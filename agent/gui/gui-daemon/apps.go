@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultAppWaitTimeout is how long to wait for a launched application's
+// window when no timeout is given
+const defaultAppWaitTimeout = 30000 // milliseconds
+
+// AppConfig describes how to launch a named application. Command, args,
+// env values and dir may reference environment variables as $VAR.
+type AppConfig struct {
+	Command      string            `json:"command,omitempty"`
+	Args         []string          `json:"args,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	Dir          string            `json:"dir,omitempty"`
+	WindowTitle  string            `json:"windowTitle,omitempty"`  // Regular expression matched against window titles
+	DesktopEntry string            `json:"desktopEntry,omitempty"` // Launch a .desktop entry instead of command
+}
+
+// AppRegistry maps application names to launch configurations. Built-in
+// defaults for the platform are overridden by the entries in APPS_CONFIG,
+// by default ~/.jarvis/apps.json, which is re-read on every launch.
+type AppRegistry struct {
+	path string
+}
+
+// NewAppRegistry creates a registry backed by APPS_CONFIG
+func NewAppRegistry() *AppRegistry {
+	path := os.Getenv("APPS_CONFIG")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".jarvis", "apps.json")
+	}
+	return &AppRegistry{path: path}
+}
+
+// Lookup returns the configuration for an application. Names that are not
+// configured are tried as .desktop entry ids.
+func (a *AppRegistry) Lookup(name string) (AppConfig, error) {
+	apps, err := a.load()
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	if app, exists := apps[name]; exists {
+		return app, nil
+	}
+	if runtime.GOOS == "linux" {
+		if _, err := findDesktopEntry(name); err == nil {
+			return AppConfig{DesktopEntry: name}, nil
+		}
+	}
+	return AppConfig{}, fmt.Errorf("unsupported application: %s (add it to %s)", name, a.path)
+}
+
+// load merges the config file over the built-in defaults
+func (a *AppRegistry) load() (map[string]AppConfig, error) {
+	apps := defaultApps()
+
+	data, err := os.ReadFile(a.path)
+	if os.IsNotExist(err) {
+		return apps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", a.path, err)
+	}
+
+	var configured map[string]AppConfig
+	if err := json.Unmarshal(data, &configured); err != nil {
+		return nil, fmt.Errorf("invalid application config %s: %v", a.path, err)
+	}
+	for name, app := range configured {
+		if app.Command == "" && app.DesktopEntry == "" {
+			return nil, fmt.Errorf("application %s in %s needs a command or desktopEntry", name, a.path)
+		}
+		apps[name] = app
+	}
+	return apps, nil
+}
+
+// defaultApps returns the built-in applications for this platform
+func defaultApps() map[string]AppConfig {
+	switch runtime.GOOS {
+	case "darwin":
+		return map[string]AppConfig{
+			string(AppFirefox):     {Command: "open", Args: []string{"-a", "Firefox"}},
+			string(AppThunderbird): {Command: "open", Args: []string{"-a", "Thunderbird"}},
+			string(AppVSCode):      {Command: "open", Args: []string{"-a", "Visual Studio Code"}},
+			string(AppTerminal):    {Command: "open", Args: []string{"-a", "Terminal"}},
+			string(AppDirectory):   {Command: "open", Args: []string{"-a", "Finder"}},
+			string(AppDesktop):     {Command: "open", Args: []string{"$HOME/Desktop"}},
+		}
+	case "windows":
+		return map[string]AppConfig{
+			string(AppFirefox):     {Command: "firefox.exe"},
+			string(AppThunderbird): {Command: "thunderbird.exe"},
+			string(AppVSCode):      {Command: "code.cmd"},
+			string(AppTerminal):    {Command: "cmd.exe"},
+			string(AppDirectory):   {Command: "explorer.exe"},
+			string(AppDesktop):     {Command: "explorer.exe", Args: []string{`$USERPROFILE\Desktop`}},
+		}
+	default:
+		return map[string]AppConfig{
+			string(AppFirefox):     {Command: "firefox", WindowTitle: "Mozilla Firefox"},
+			string(AppThunderbird): {Command: "thunderbird", WindowTitle: "Thunderbird"},
+			string(AppVSCode):      {Command: "code", WindowTitle: "Visual Studio Code"},
+			string(AppTerminal):    {Command: "xterm"},
+			string(AppDirectory):   {Command: "nautilus"},
+			string(AppDesktop):     {Command: "nautilus", Args: []string{"$HOME/Desktop"}},
+		}
+	}
+}
+
+// resolveDesktopEntry fills in the command, dir and window title of an
+// application that launches a .desktop entry
+func resolveDesktopEntry(app AppConfig) (AppConfig, error) {
+	path, err := findDesktopEntry(app.DesktopEntry)
+	if err != nil {
+		return AppConfig{}, err
+	}
+	entry, err := parseDesktopEntry(path)
+	if err != nil {
+		return AppConfig{}, err
+	}
+
+	argv, err := splitExec(entry["Exec"])
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("invalid Exec in %s: %v", path, err)
+	}
+	if len(argv) == 0 {
+		return AppConfig{}, fmt.Errorf("%s has no Exec line", path)
+	}
+
+	resolved := app
+	resolved.Command = argv[0]
+	resolved.Args = append(argv[1:], app.Args...)
+	if resolved.Dir == "" {
+		resolved.Dir = entry["Path"]
+	}
+	if resolved.WindowTitle == "" && entry["Name"] != "" {
+		resolved.WindowTitle = regexp.QuoteMeta(entry["Name"])
+	}
+	return resolved, nil
+}
+
+// findDesktopEntry locates a .desktop file by path or by id in the XDG
+// application directories
+func findDesktopEntry(id string) (string, error) {
+	if filepath.IsAbs(id) {
+		if _, err := os.Stat(id); err != nil {
+			return "", fmt.Errorf("desktop entry not found: %s", id)
+		}
+		return id, nil
+	}
+
+	if !strings.HasSuffix(id, ".desktop") {
+		id += ".desktop"
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	for _, dir := range append([]string{dataHome}, filepath.SplitList(dataDirs)...) {
+		path := filepath.Join(dir, "applications", id)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("desktop entry not found: %s", id)
+}
+
+// parseDesktopEntry reads the keys of the [Desktop Entry] group
+func parseDesktopEntry(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open desktop entry: %v", err)
+	}
+	defer file.Close()
+
+	entry := make(map[string]string)
+	inGroup := false
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == "[Desktop Entry]"
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && inGroup {
+			entry[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read desktop entry: %v", err)
+	}
+
+	if t := entry["Type"]; t != "" && t != "Application" {
+		return nil, fmt.Errorf("%s is a %s entry, not an application", path, t)
+	}
+	return entry, nil
+}
+
+// splitExec splits a desktop entry Exec value into arguments, honouring
+// double quotes and dropping field codes such as %f and %U, which have no
+// files or URLs to expand to here
+func splitExec(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inQuote, hasArg := false, false
+
+	flush := func() {
+		if hasArg {
+			arg := current.String()
+			if !(len(arg) == 2 && arg[0] == '%' && arg[1] != '%') {
+				args = append(args, strings.ReplaceAll(arg, "%%", "%"))
+			}
+		}
+		current.Reset()
+		hasArg = false
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(value):
+			i++
+			current.WriteByte(value[i])
+		case c == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case !inQuote && (c == ' ' || c == '\t'):
+			flush()
+		default:
+			current.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	flush()
+	return args, nil
+}
+
+// launchApp starts an application on display, detached from the request,
+// and returns its PID
+func launchApp(app AppConfig, display string) (int, []string, error) {
+	command := os.ExpandEnv(app.Command)
+	args := make([]string, len(app.Args))
+	for i, arg := range app.Args {
+		args[i] = os.ExpandEnv(arg)
+	}
+
+	log.Printf("Executing command: %s %v", command, args)
+
+	cmd := exec.Command(command, args...)
+	cmd.Dir = os.ExpandEnv(app.Dir)
+	cmd.Env = displayEnv(display)
+	for key, value := range app.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, nil, fmt.Errorf("failed to execute command: %v", err)
+	}
+
+	// Don't wait for command to finish (detached execution)
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Command finished with error: %v", err)
+		}
+	}()
+
+	return cmd.Process.Pid, append([]string{command}, args...), nil
+}
+
+// waitForAppWindow waits for a window that was not open before the launch
+// and either belongs to the process or matches the title pattern
+func (s *ComputerUseService) waitForAppWindow(ctx context.Context, pid int, title *regexp.Regexp, before map[string]bool, timeout time.Duration) (*WindowInfo, time.Duration, error) {
+	var found *WindowInfo
+	elapsed, err := pollUntil(ctx, timeout, defaultWaitInterval*time.Millisecond, func() (bool, error) {
+		windows, err := s.windows.List(ctx)
+		if err != nil {
+			return false, err
+		}
+		for _, win := range windows {
+			if before[win.ID] {
+				continue
+			}
+			if win.PID == pid || (title != nil && title.MatchString(win.Title)) {
+				found = &win
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return found, elapsed, err
+}
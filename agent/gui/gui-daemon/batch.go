@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxBatchActions caps the number of actions in one batch
+const maxBatchActions = 200
+
+// displayLocks serialises input per X display so concurrent callers can't
+// interleave mouse and keyboard actions. The empty display is the daemon's
+// own.
+type displayLocks struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func newDisplayLocks() *displayLocks {
+	return &displayLocks{locks: make(map[string]chan struct{})}
+}
+
+// acquire waits for the display's lock or for ctx to be cancelled, and
+// returns the function that releases it
+func (l *displayLocks) acquire(ctx context.Context, display string) (func(), error) {
+	l.mu.Lock()
+	lock, ok := l.locks[display]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		l.locks[display] = lock
+	}
+	l.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		if display == "" {
+			display = "default"
+		}
+		return nil, fmt.Errorf("waiting for display %s: %v", display, ctx.Err())
+	}
+}
+
+// ExecuteBatch runs actions in order while holding the display lock. It
+// stops at the first failure unless ContinueOnError is set.
+func (s *ComputerUseService) ExecuteBatch(ctx context.Context, batch BatchRequest) (*BatchResponse, error) {
+	if len(batch.Actions) == 0 {
+		return nil, fmt.Errorf("actions is empty")
+	}
+	if len(batch.Actions) > maxBatchActions {
+		return nil, fmt.Errorf("too many actions: %d (max %d)", len(batch.Actions), maxBatchActions)
+	}
+
+	// Decode everything up front so a typo doesn't leave a half-run batch
+	actions := make([]ComputerAction, len(batch.Actions))
+	for i, raw := range batch.Actions {
+		if err := json.Unmarshal(raw, &actions[i]); err != nil {
+			return nil, fmt.Errorf("action %d: invalid JSON: %v", i, err)
+		}
+		if actions[i].Action == "" {
+			return nil, fmt.Errorf("action %d: missing action", i)
+		}
+		if actions[i].Session != "" && actions[i].Session != batch.Session {
+			return nil, fmt.Errorf("action %d: session %q differs from the batch session", i, actions[i].Session)
+		}
+	}
+
+	return s.runActions(ctx, batch.Session, actions, batch.ContinueOnError)
+}
+
+// runActions executes actions in order while holding the display lock
+func (s *ComputerUseService) runActions(ctx context.Context, session string, actions []ComputerAction, continueOnError bool) (*BatchResponse, error) {
+	scoped, err := s.forSession(session)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.locks.acquire(ctx, scoped.display)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	log.Printf("Executing batch of %d actions", len(actions))
+
+	response := &BatchResponse{Success: true, Steps: make([]BatchStepResult, 0, len(actions))}
+	start := time.Now()
+
+	for i, action := range actions {
+		if ctx.Err() != nil {
+			response.Success = false
+			response.Skipped = len(actions) - i
+			break
+		}
+
+		stepStart := time.Now()
+		data, err := scoped.execute(ctx, action)
+
+		step := BatchStepResult{
+			Index:    i,
+			Action:   action.Action,
+			Success:  err == nil,
+			Duration: time.Since(stepStart).Milliseconds(),
+		}
+		if err != nil {
+			step.Error = err.Error()
+			response.Success = false
+		} else {
+			step.Data = data
+		}
+		response.Steps = append(response.Steps, step)
+
+		if err != nil && !continueOnError {
+			response.Skipped = len(actions) - i - 1
+			break
+		}
+	}
+
+	response.Duration = time.Since(start).Milliseconds()
+	return response, nil
+}
+
+// Lock takes the input lock of the display a session acts on; single
+// actions, batches and macro replays on the same display run one at a time
+func (s *ComputerUseService) Lock(ctx context.Context, session string) (func(), error) {
+	scoped, err := s.forSession(session)
+	if err != nil {
+		return nil, err
+	}
+	return s.locks.acquire(ctx, scoped.display)
+}
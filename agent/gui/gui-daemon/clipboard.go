@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Clipboard media types, as X11 selection targets
+const (
+	clipboardText  = "UTF8_STRING"
+	clipboardImage = "image/png"
+	clipboardFiles = "text/uri-list"
+)
+
+// maxClipboardBytes caps what is read from the clipboard
+const maxClipboardBytes = 20 * 1024 * 1024
+
+// Clipboard reads and writes the X11 clipboard with xclip. Besides text
+// it handles PNG images and file lists (text/uri-list), which file
+// managers paste as copied files.
+type Clipboard struct {
+	display string // X display of a session; empty for the daemon's own
+}
+
+// NewClipboard creates a new clipboard
+func NewClipboard() *Clipboard {
+	return &Clipboard{}
+}
+
+// ClipboardContent is the clipboard data of one media type
+type ClipboardContent struct {
+	MediaType string
+	Data      []byte
+}
+
+// Targets lists the media types the clipboard owner offers
+func (c *Clipboard) Targets(ctx context.Context) ([]string, error) {
+	out, err := c.read(ctx, "TARGETS")
+	if err != nil || len(out) == 0 {
+		// An empty clipboard has no owner to ask
+		return nil, nil
+	}
+
+	var targets []string
+	for _, t := range strings.Split(string(out), "\n") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// Read returns the clipboard content in the given media type
+func (c *Clipboard) Read(ctx context.Context, mediaType string) ([]byte, error) {
+	data, err := c.read(ctx, mediaType)
+	if err != nil {
+		return nil, fmt.Errorf("clipboard has no %s content", mediaType)
+	}
+	return data, nil
+}
+
+// Write replaces the clipboard content
+func (c *Clipboard) Write(ctx context.Context, mediaType string, data []byte) error {
+	// xclip forks to serve the selection, so its output must not be
+	// captured or Run would wait for the fork to exit
+	cmd := exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-t", mediaType, "-i")
+	cmd.Env = displayEnv(c.display)
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write clipboard: %v", err)
+	}
+	return nil
+}
+
+// read runs xclip -o for a selection target
+func (c *Clipboard) read(ctx context.Context, target string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-t", target, "-o")
+	cmd.Env = displayEnv(c.display)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("xclip: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() > maxClipboardBytes {
+		return nil, fmt.Errorf("clipboard content exceeds %d MB", maxClipboardBytes/(1024*1024))
+	}
+	return stdout.Bytes(), nil
+}
+
+// Snapshot saves the clipboard in its richest format so it can be
+// restored. It returns nil for an empty clipboard.
+func (c *Clipboard) Snapshot(ctx context.Context) (*ClipboardContent, error) {
+	targets, err := c.Targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mediaType := range []string{clipboardImage, clipboardFiles, clipboardText} {
+		if !containsString(targets, mediaType) {
+			continue
+		}
+		data, err := c.Read(ctx, mediaType)
+		if err != nil {
+			return nil, err
+		}
+		return &ClipboardContent{MediaType: mediaType, Data: data}, nil
+	}
+	return nil, nil
+}
+
+// Restore puts back a snapshot; a nil snapshot leaves an empty clipboard
+func (c *Clipboard) Restore(ctx context.Context, content *ClipboardContent) error {
+	if content == nil {
+		return c.Write(ctx, clipboardText, nil)
+	}
+	return c.Write(ctx, content.MediaType, content.Data)
+}
+
+// fileURIs builds a text/uri-list for files, which must exist
+func fileURIs(paths []string) ([]byte, error) {
+	var list strings.Builder
+	for _, path := range paths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("file path must be absolute: %s", path)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("cannot put %s on the clipboard: %v", path, err)
+		}
+		u := url.URL{Scheme: "file", Path: path}
+		list.WriteString(u.String() + "\r\n")
+	}
+	return []byte(list.String()), nil
+}
+
+// parseFileURIs extracts local paths from a text/uri-list
+func parseFileURIs(data []byte) []string {
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		paths = append(paths, u.Path)
+	}
+	return paths
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Virtual display limits
+const (
+	defaultDisplayWidth  = 1920
+	defaultDisplayHeight = 1080
+	maxDisplayWidth      = 7680
+	maxDisplayHeight     = 4320
+	displayStartTimeout  = 10 * time.Second
+)
+
+var sessionName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// DisplaySession is an isolated Xvfb display owned by one agent session
+type DisplaySession struct {
+	ID        string    `json:"id"`
+	Display   string    `json:"display"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	PID       int       `json:"pid"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	robotGo *RobotGoService
+}
+
+// DisplayManager spawns and tears down per-session Xvfb displays. Display
+// numbers start at XVFB_DISPLAY_BASE (default 100) and at most
+// MAX_DISPLAY_SESSIONS (default 8) run at once.
+type DisplayManager struct {
+	mu       sync.Mutex
+	sessions map[string]*DisplaySession
+	base     int
+	max      int
+}
+
+// NewDisplayManager creates a display manager
+func NewDisplayManager() *DisplayManager {
+	base, err := strconv.Atoi(os.Getenv("XVFB_DISPLAY_BASE"))
+	if err != nil || base <= 0 {
+		base = 100
+	}
+	max, err := strconv.Atoi(os.Getenv("MAX_DISPLAY_SESSIONS"))
+	if err != nil || max <= 0 {
+		max = 8
+	}
+	return &DisplayManager{sessions: make(map[string]*DisplaySession), base: base, max: max}
+}
+
+// Create starts a display for a new session. An empty id gets a random one.
+func (d *DisplayManager) Create(ctx context.Context, id string, width, height int) (*DisplaySession, error) {
+	if id == "" {
+		id = newSessionID()
+	}
+	if !sessionName.MatchString(id) {
+		return nil, fmt.Errorf("invalid session id %q: use letters, digits, '-' and '_'", id)
+	}
+	if width == 0 && height == 0 {
+		width, height = defaultDisplayWidth, defaultDisplayHeight
+	}
+	if width <= 0 || height <= 0 || width > maxDisplayWidth || height > maxDisplayHeight {
+		return nil, fmt.Errorf("resolution must be between 1x1 and %dx%d", maxDisplayWidth, maxDisplayHeight)
+	}
+
+	d.mu.Lock()
+	if _, exists := d.sessions[id]; exists {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("session already exists: %s", id)
+	}
+	if len(d.sessions) >= d.max {
+		d.mu.Unlock()
+		return nil, fmt.Errorf("too many sessions (max %d)", d.max)
+	}
+	number := d.freeDisplay()
+	session := &DisplaySession{
+		ID:        id,
+		Display:   ":" + strconv.Itoa(number),
+		Width:     width,
+		Height:    height,
+		CreatedAt: time.Now(),
+		exited:    make(chan struct{}),
+	}
+	// Reserve the id and display number while Xvfb starts
+	d.sessions[id] = session
+	d.mu.Unlock()
+
+	if err := d.start(ctx, session, number); err != nil {
+		d.mu.Lock()
+		delete(d.sessions, id)
+		d.mu.Unlock()
+		return nil, err
+	}
+
+	// A session without its input service is still starting
+	d.mu.Lock()
+	session.robotGo = NewRobotGoService()
+	session.robotGo.display = session.Display
+	d.mu.Unlock()
+
+	log.Printf("Started session %s on display %s (%dx%d)", id, session.Display, width, height)
+	return session, nil
+}
+
+// freeDisplay returns the lowest display number that neither a session
+// nor another X server uses. The caller holds d.mu.
+func (d *DisplayManager) freeDisplay() int {
+	used := make(map[string]bool)
+	for _, session := range d.sessions {
+		used[session.Display] = true
+	}
+
+	for n := d.base; ; n++ {
+		if used[":"+strconv.Itoa(n)] {
+			continue
+		}
+		if _, err := os.Stat(fmt.Sprintf("/tmp/.X%d-lock", n)); err == nil {
+			continue
+		}
+		return n
+	}
+}
+
+// start runs Xvfb and waits until it accepts connections
+func (d *DisplayManager) start(ctx context.Context, session *DisplaySession, number int) error {
+	screen := fmt.Sprintf("%dx%dx24", session.Width, session.Height)
+	cmd := exec.Command("Xvfb", session.Display, "-screen", "0", screen, "-nolisten", "tcp")
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start Xvfb: %v", err)
+	}
+	session.cmd = cmd
+	session.PID = cmd.Process.Pid
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("Xvfb for session %s exited: %v", session.ID, err)
+		}
+		close(session.exited)
+	}()
+
+	// Xvfb creates its socket once it is ready
+	socket := fmt.Sprintf("/tmp/.X11-unix/X%d", number)
+	ctx, cancel := context.WithTimeout(ctx, displayStartTimeout)
+	defer cancel()
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			return nil
+		}
+		select {
+		case <-session.exited:
+			return fmt.Errorf("Xvfb exited while starting display %s", session.Display)
+		case <-ctx.Done():
+			stopProcess(cmd, session.exited)
+			return fmt.Errorf("display %s did not start: %v", session.Display, ctx.Err())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// Get returns a running session
+func (d *DisplayManager) Get(id string) (*DisplaySession, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	session, exists := d.sessions[id]
+	if !exists || session.robotGo == nil {
+		return nil, fmt.Errorf("session not found: %s", id)
+	}
+	select {
+	case <-session.exited:
+		return nil, fmt.Errorf("display of session %s has stopped", id)
+	default:
+	}
+	return session, nil
+}
+
+// List returns the sessions ordered by creation time
+func (d *DisplayManager) List() []DisplaySession {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	sessions := make([]DisplaySession, 0, len(d.sessions))
+	for _, session := range d.sessions {
+		if session.robotGo != nil {
+			sessions = append(sessions, *session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
+}
+
+// Destroy stops a session's display; applications on it exit with it
+func (d *DisplayManager) Destroy(id string) error {
+	d.mu.Lock()
+	session, exists := d.sessions[id]
+	if !exists || session.robotGo == nil {
+		d.mu.Unlock()
+		return fmt.Errorf("session not found: %s", id)
+	}
+	delete(d.sessions, id)
+	d.mu.Unlock()
+
+	log.Printf("Stopping session %s on display %s", id, session.Display)
+	stopProcess(session.cmd, session.exited)
+	return nil
+}
+
+// DestroyAll stops every session's display
+func (d *DisplayManager) DestroyAll() {
+	for _, session := range d.List() {
+		d.Destroy(session.ID)
+	}
+}
+
+// stopProcess asks a process to exit and kills it if it doesn't
+func stopProcess(cmd *exec.Cmd, exited chan struct{}) {
+	cmd.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// newSessionID returns a random session id
+func newSessionID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return "session-" + hex.EncodeToString(b)
+}
+
+// displayEnv returns the environment for a child process on display; the
+// empty display is the one the daemon was started on
+func displayEnv(display string) []string {
+	if display == "" {
+		display = defaultXDisplay
+	}
+	return append(os.Environ(), "DISPLAY="+display)
+}
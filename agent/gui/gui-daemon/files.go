@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Default file size limits
+const (
+	defaultMaxReadBytes  = 25 * 1024 * 1024
+	defaultMaxWriteBytes = 25 * 1024 * 1024
+)
+
+// FileSandbox confines file actions to a root directory. Paths are
+// resolved against the root, and neither ".." nor symlinks may lead out
+// of it.
+type FileSandbox struct {
+	root          string
+	maxReadBytes  int64
+	maxWriteBytes int64
+}
+
+// NewFileSandbox creates a sandbox rooted at FILE_ROOT, by default
+// ~/Desktop, with limits from FILE_MAX_READ_BYTES and FILE_MAX_WRITE_BYTES.
+// The root is created if it is missing.
+func NewFileSandbox() *FileSandbox {
+	root := os.Getenv("FILE_ROOT")
+	if root == "" {
+		home, _ := os.UserHomeDir()
+		root = filepath.Join(home, "Desktop")
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		log.Fatalf("Failed to create file root %s (set FILE_ROOT): %v", root, err)
+	}
+	// Work with the real root so resolved paths compare against it
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+
+	return &FileSandbox{
+		root:          filepath.Clean(root),
+		maxReadBytes:  envBytes("FILE_MAX_READ_BYTES", defaultMaxReadBytes),
+		maxWriteBytes: envBytes("FILE_MAX_WRITE_BYTES", defaultMaxWriteBytes),
+	}
+}
+
+// envBytes reads a positive byte count from the environment
+func envBytes(name string, fallback int64) int64 {
+	if n, err := strconv.ParseInt(os.Getenv(name), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+// maxSymlinkHops bounds symlink resolution the way the kernel's ELOOP does
+const maxSymlinkHops = 40
+
+// Resolve maps a path to the real path it names inside the root, with
+// every symlink resolved. Relative paths are taken from the root; absolute
+// paths must already lie in it. The path need not exist, but no symlink
+// along it, dangling or not, may point outside the root. Callers must use
+// the returned path, not their own.
+func (f *FileSandbox) Resolve(path string) (string, error) {
+	return f.resolve(path, true)
+}
+
+// ResolveLink is Resolve without following a symlink in the last
+// component, for removing the link itself
+func (f *FileSandbox) ResolveLink(path string) (string, error) {
+	return f.resolve(path, false)
+}
+
+func (f *FileSandbox) resolve(path string, followLast bool) (string, error) {
+	target := path
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(f.root, target)
+	}
+	target = filepath.Clean(target)
+
+	if !withinDir(f.root, target) {
+		return "", fmt.Errorf("path is outside the allowed directory %s: %s", f.root, path)
+	}
+
+	rel, _ := filepath.Rel(f.root, target)
+	pending := splitPath(rel)
+	current := f.root
+	hops := 0
+
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		next := filepath.Join(current, name)
+
+		info, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			// Nothing below a missing component exists either
+			return filepath.Join(append([]string{next}, pending...)...), nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve path: %v", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 || (!followLast && len(pending) == 0) {
+			current = next
+			continue
+		}
+
+		hops++
+		if hops > maxSymlinkHops {
+			return "", fmt.Errorf("too many levels of symlinks: %s", path)
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve path: %v", err)
+		}
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(current, link)
+		}
+		link = filepath.Clean(link)
+		if !withinDir(f.root, link) {
+			return "", fmt.Errorf("path leads outside the allowed directory through a symlink: %s", path)
+		}
+
+		// Continue from the root along the link's target
+		linkRel, _ := filepath.Rel(f.root, link)
+		pending = append(splitPath(linkRel), pending...)
+		current = f.root
+	}
+
+	return current, nil
+}
+
+// splitPath splits a clean relative path into its components
+func splitPath(rel string) []string {
+	if rel == "." || rel == "" {
+		return nil
+	}
+	return strings.Split(rel, string(filepath.Separator))
+}
+
+// withinDir reports whether path is dir or lies below it
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// IsRoot reports whether a resolved path is the sandbox root itself
+func (f *FileSandbox) IsRoot(path string) bool {
+	return filepath.Clean(path) == f.root
+}
+
+// Relative returns a resolved path relative to the root, for responses
+func (f *FileSandbox) Relative(path string) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// detectMediaType sniffs the MIME type of a file's content. Generic
+// results fall back to the extension: JSON and CSV sniff as plain text
+// and office documents as zip archives.
+func detectMediaType(path string, head []byte) string {
+	mediaType := http.DetectContentType(head)
+
+	base, _, _ := strings.Cut(mediaType, ";")
+	switch base {
+	case "text/plain", "application/octet-stream", "application/zip":
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); byExt != "" {
+			return byExt
+		}
+	}
+	return mediaType
+}
+
+// sniffFile reads the start of a file and detects its MIME type
+func sniffFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	// DetectContentType considers at most 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return detectMediaType(path, head[:n]), nil
+}
@@ -7,6 +7,8 @@ toolchain go1.24.4
 require (
 	github.com/go-vgo/robotgo v0.110.8
 	github.com/robotn/gohook v0.41.0
+	github.com/vcaesar/bitmap v0.12.2
+	golang.org/x/image v0.27.0
 )
 
 require (
@@ -26,7 +28,6 @@ require (
 	github.com/tailscale/win v0.0.0-20250213223159-5992cb43ca35 // indirect
 	github.com/tklauser/go-sysconf v0.3.15 // indirect
 	github.com/tklauser/numcpus v0.10.0 // indirect
-	github.com/vcaesar/bitmap v0.12.2 // indirect
 	github.com/vcaesar/gops v0.41.0 // indirect
 	github.com/vcaesar/imgo v0.41.0 // indirect
 	github.com/vcaesar/keycode v0.10.1 // indirect
@@ -34,7 +35,6 @@ require (
 	github.com/vcaesar/tt v0.20.1 // indirect
 	github.com/yusufpapurcu/wmi v1.2.4 // indirect
 	golang.org/x/exp v0.0.0-20250506013437-ce4c2cf36ca6 // indirect
-	golang.org/x/image v0.27.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 )
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// defaultJPEGQuality is used when a JPEG is requested without a quality
+const defaultJPEGQuality = 80
+
+// clipRegion intersects a region with the screen, reporting false if
+// nothing is left
+func clipRegion(region, screen Region) (Region, bool) {
+	r := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height).
+		Intersect(image.Rect(screen.X, screen.Y, screen.X+screen.Width, screen.Y+screen.Height))
+	if r.Empty() {
+		return Region{}, false
+	}
+	return Region{X: r.Min.X, Y: r.Min.Y, Width: r.Dx(), Height: r.Dy()}, true
+}
+
+// scaleToFit downscales img to fit within maxWidth x maxHeight, keeping its
+// aspect ratio. A zero limit means unbounded. It never upscales and returns
+// the scale factor applied.
+func scaleToFit(img image.Image, maxWidth, maxHeight int) (image.Image, float64) {
+	bounds := img.Bounds()
+	scale := 1.0
+	if maxWidth > 0 && bounds.Dx() > maxWidth {
+		scale = float64(maxWidth) / float64(bounds.Dx())
+	}
+	if maxHeight > 0 && bounds.Dy() > maxHeight {
+		if s := float64(maxHeight) / float64(bounds.Dy()); s < scale {
+			scale = s
+		}
+	}
+	if scale == 1.0 {
+		return img, scale
+	}
+
+	width := int(float64(bounds.Dx())*scale + 0.5)
+	height := int(float64(bounds.Dy())*scale + 0.5)
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst, scale
+}
+
+// encodeImage encodes img as PNG or JPEG and returns its media type
+func encodeImage(img image.Image, format ImageFormat, quality int) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "", FormatPNG:
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", fmt.Errorf("failed to encode PNG: %v", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	case FormatJPEG, "jpg":
+		if quality == 0 {
+			quality = defaultJPEGQuality
+		}
+		if quality < 1 || quality > 100 {
+			return nil, "", fmt.Errorf("quality must be between 1 and 100")
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, "", fmt.Errorf("failed to encode JPEG: %v", err)
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported format: %s (use png or jpeg)", format)
+	}
+}
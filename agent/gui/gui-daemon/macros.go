@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	hook "github.com/robotn/gohook"
+)
+
+const (
+	// Pauses shorter than this between recorded actions are dropped
+	minMacroWait = 150 * time.Millisecond
+	// Longer pauses are shortened, e.g. when the user stepped away
+	maxMacroWait = 10 * time.Second
+	// Clicks closer together than this at the same spot become a multi-click
+	multiClickInterval = 500 * time.Millisecond
+	// A press and release further apart than this (pixels) is a drag
+	dragThreshold = 5
+	// Drags are replayed through at most this many points
+	maxDragPoints = 50
+)
+
+// Macro is a recorded sequence of actions
+type Macro struct {
+	Name      string            `json:"name"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Duration  int64             `json:"duration"` // milliseconds recorded
+	Actions   []json.RawMessage `json:"actions"`
+}
+
+// MacroInfo summarises a stored macro
+type MacroInfo struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	Duration  int64     `json:"duration"`
+	Actions   int       `json:"actions"`
+}
+
+var macroName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// MacroStore keeps macros as JSON files in a directory
+type MacroStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewMacroStore creates a store in MACRO_DIR, by default ~/.jarvis/macros
+func NewMacroStore() *MacroStore {
+	dir := os.Getenv("MACRO_DIR")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".jarvis", "macros")
+	}
+	return &MacroStore{dir: dir}
+}
+
+func (m *MacroStore) path(name string) (string, error) {
+	if !macroName.MatchString(name) {
+		return "", fmt.Errorf("invalid macro name %q: use letters, digits, '-' and '_'", name)
+	}
+	return filepath.Join(m.dir, name+".json"), nil
+}
+
+// Save stores a macro, replacing any macro with the same name
+func (m *MacroStore) Save(macro *Macro) error {
+	path, err := m.path(macro.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(macro, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode macro: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create macro directory: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save macro: %v", err)
+	}
+	return nil
+}
+
+// Load reads a macro by name
+func (m *MacroStore) Load(name string) (*Macro, error) {
+	path, err := m.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("macro not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read macro: %v", err)
+	}
+
+	var macro Macro
+	if err := json.Unmarshal(data, &macro); err != nil {
+		return nil, fmt.Errorf("failed to parse macro %s: %v", name, err)
+	}
+	return &macro, nil
+}
+
+// List returns the stored macros sorted by name
+func (m *MacroStore) List() ([]MacroInfo, error) {
+	entries, err := os.ReadDir(m.dir)
+	if os.IsNotExist(err) {
+		return []MacroInfo{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list macros: %v", err)
+	}
+
+	infos := []MacroInfo{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || name == entry.Name() {
+			continue
+		}
+		macro, err := m.Load(name)
+		if err != nil {
+			log.Printf("Skipping macro %s: %v", entry.Name(), err)
+			continue
+		}
+		infos = append(infos, MacroInfo{
+			Name:      macro.Name,
+			CreatedAt: macro.CreatedAt,
+			Duration:  macro.Duration,
+			Actions:   len(macro.Actions),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Delete removes a macro
+func (m *MacroStore) Delete(name string) error {
+	path, err := m.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return fmt.Errorf("macro not found: %s", name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete macro: %v", err)
+	}
+	return nil
+}
+
+// Recorder captures global input events while recording a macro
+type Recorder struct {
+	robotGo *RobotGoService
+
+	mu        sync.Mutex
+	recording bool
+	name      string
+	started   time.Time
+	events    []hook.Event
+	done      chan struct{}
+}
+
+// NewRecorder creates a recorder
+func NewRecorder(robotGo *RobotGoService) *Recorder {
+	return &Recorder{robotGo: robotGo}
+}
+
+// Start begins recording input for a macro called name
+func (r *Recorder) Start(name string) error {
+	if !macroName.MatchString(name) {
+		return fmt.Errorf("invalid macro name %q: use letters, digits, '-' and '_'", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.recording {
+		return fmt.Errorf("already recording macro %s", r.name)
+	}
+
+	events := r.robotGo.AddEvent("record")
+	if events == nil {
+		return fmt.Errorf("failed to start input hook")
+	}
+
+	r.recording = true
+	r.name = name
+	r.started = time.Now()
+	r.events = nil
+	r.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+		for ev := range events {
+			r.mu.Lock()
+			r.events = append(r.events, ev)
+			r.mu.Unlock()
+		}
+	}(r.done)
+
+	log.Printf("Recording macro %s", name)
+	return nil
+}
+
+// Stop ends the recording and returns the events normalised into a macro
+func (r *Recorder) Stop() (*Macro, error) {
+	r.mu.Lock()
+	if !r.recording {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("not recording")
+	}
+	r.recording = false
+	done := r.done
+	r.mu.Unlock()
+
+	// Ending the hook closes the event channel
+	r.robotGo.RemoveEvent()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		log.Println("Warning: input hook did not shut down in time")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	actions, err := normaliseEvents(r.events)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Recorded macro %s: %d events, %d actions", r.name, len(r.events), len(actions))
+
+	return &Macro{
+		Name:      r.name,
+		CreatedAt: r.started,
+		Duration:  time.Since(r.started).Milliseconds(),
+		Actions:   actions,
+	}, nil
+}
+
+// Modifier masks of hook events
+const (
+	maskShift = 1<<0 | 1<<4
+	maskCtrl  = 1<<1 | 1<<5
+	maskMeta  = 1<<2 | 1<<6
+	maskAlt   = 1<<3 | 1<<7
+)
+
+// modifierKeys are the key codes of the modifier keys themselves
+var modifierKeys = map[uint16]bool{
+	0x002A: true, 0x0036: true, // shift
+	0x001D: true, 0x0E1D: true, // ctrl
+	0x0038: true, 0x0E38: true, // alt
+	0x0E5B: true, 0x0E5C: true, // meta
+}
+
+// specialKeys maps key codes of keys that don't type text to key names
+var specialKeys = map[uint16]string{
+	0x0001: "esc",
+	0x000E: "backspace",
+	0x000F: "tab",
+	0x001C: "enter",
+	0x0E1C: "enter",
+	0x0E52: "insert",
+	0x0E53: "delete",
+	0x0E47: "home",
+	0x0E4F: "end",
+	0x0E49: "pageup",
+	0x0E51: "pagedown",
+	0xE048: "up",
+	0xE050: "down",
+	0xE04B: "left",
+	0xE04D: "right",
+	0x003B: "f1", 0x003C: "f2", 0x003D: "f3", 0x003E: "f4",
+	0x003F: "f5", 0x0040: "f6", 0x0041: "f7", 0x0042: "f8",
+	0x0043: "f9", 0x0044: "f10", 0x0057: "f11", 0x0058: "f12",
+}
+
+// keyName returns the name of the key for shortcuts such as ctrl+c
+func keyName(code uint16) (string, bool) {
+	if name, ok := specialKeys[code]; ok {
+		return name, true
+	}
+	for _, c := range "abcdefghijklmnopqrstuvwxyz0123456789" {
+		if hook.Keycode[string(c)] == code {
+			return string(c), true
+		}
+	}
+	return "", false
+}
+
+// modifiers returns the held modifier keys of an event, in robotgo names
+func modifiers(mask uint16) []string {
+	var keys []string
+	if mask&maskCtrl != 0 {
+		keys = append(keys, "ctrl")
+	}
+	if mask&maskAlt != 0 {
+		keys = append(keys, "alt")
+	}
+	if mask&maskMeta != 0 {
+		keys = append(keys, "cmd")
+	}
+	if mask&maskShift != 0 {
+		keys = append(keys, "shift")
+	}
+	return keys
+}
+
+func hookButton(button uint16) (ButtonType, bool) {
+	switch button {
+	case 1:
+		return ButtonLeft, true
+	case 2:
+		return ButtonRight, true
+	case 3:
+		return ButtonMiddle, true
+	}
+	return "", false
+}
+
+// normaliseEvents turns raw hook events into actions the daemon executes:
+// clicks, drags, scrolls, typed text and key combinations, with waits for
+// the pauses in between.
+//
+// Note gohook's naming: KeyDown is a typed character, KeyHold a key press,
+// MouseHold a button press and MouseDown a button release.
+func normaliseEvents(events []hook.Event) ([]json.RawMessage, error) {
+	var actions []interface{}
+	var last time.Time
+	var cursor Coordinates
+
+	// emit appends an action, preceded by a wait for the pause before it
+	emit := func(at time.Time, action interface{}) {
+		if !last.IsZero() {
+			if gap := at.Sub(last); gap >= minMacroWait {
+				if gap > maxMacroWait {
+					gap = maxMacroWait
+				}
+				actions = append(actions, &WaitAction{Action: "wait", Duration: int(gap.Milliseconds())})
+			}
+		}
+		actions = append(actions, action)
+		last = at
+	}
+	previous := func() interface{} {
+		if len(actions) == 0 {
+			return nil
+		}
+		return actions[len(actions)-1]
+	}
+
+	var press *hook.Event
+	var dragPath []Coordinates
+
+	for i := range events {
+		ev := events[i]
+		switch ev.Kind {
+		case hook.MouseMove:
+			cursor = Coordinates{X: int(ev.X), Y: int(ev.Y)}
+
+		case hook.MouseHold:
+			press = &ev
+			dragPath = nil
+			cursor = Coordinates{X: int(ev.X), Y: int(ev.Y)}
+
+		case hook.MouseDrag:
+			cursor = Coordinates{X: int(ev.X), Y: int(ev.Y)}
+			if press != nil {
+				dragPath = append(dragPath, cursor)
+			}
+
+		case hook.MouseDown:
+			cursor = Coordinates{X: int(ev.X), Y: int(ev.Y)}
+			if press == nil {
+				continue
+			}
+			button, ok := hookButton(press.Button)
+			start := Coordinates{X: int(press.X), Y: int(press.Y)}
+			pressedAt := press.When
+			press = nil
+			if !ok {
+				continue
+			}
+
+			if distance(start, cursor) > dragThreshold {
+				path := append([]Coordinates{start}, samplePath(dragPath, maxDragPoints)...)
+				path = append(path, cursor)
+				emit(pressedAt, &DragMouseAction{Action: "drag_mouse", Path: path, Button: button})
+				last = ev.When
+				continue
+			}
+
+			if click, ok := previous().(*ClickMouseAction); ok && click.Button == button &&
+				distance(*click.Coordinates, start) <= 3 && pressedAt.Sub(last) < multiClickInterval {
+				click.ClickCount++
+				last = ev.When
+				continue
+			}
+			at := start
+			emit(pressedAt, &ClickMouseAction{Action: "click_mouse", Coordinates: &at, Button: button, ClickCount: 1})
+
+		case hook.MouseWheel:
+			var direction ScrollDirection
+			switch {
+			case ev.Direction == 4 && ev.Rotation < 0:
+				direction = ScrollLeft
+			case ev.Direction == 4:
+				direction = ScrollRight
+			case ev.Rotation < 0:
+				direction = ScrollUp
+			default:
+				direction = ScrollDown
+			}
+
+			if scroll, ok := previous().(*ScrollAction); ok && scroll.Direction == direction &&
+				*scroll.Coordinates == cursor && ev.When.Sub(last) < time.Second {
+				scroll.ScrollCount++
+				last = ev.When
+				continue
+			}
+			at := cursor
+			emit(ev.When, &ScrollAction{Action: "scroll", Coordinates: &at, Direction: direction, ScrollCount: 1})
+
+		case hook.KeyHold:
+			if modifierKeys[ev.Keycode] {
+				continue
+			}
+			name, ok := keyName(ev.Keycode)
+			if !ok {
+				continue
+			}
+			mods := modifiers(ev.Mask)
+			_, special := specialKeys[ev.Keycode]
+			shortcut := ev.Mask&(maskCtrl|maskAlt|maskMeta) != 0
+			// Plain characters arrive as typed events instead
+			if !special && !shortcut {
+				continue
+			}
+			emit(ev.When, &TypeKeysAction{Action: "type_keys", Keys: append(mods, name)})
+
+		case hook.KeyDown:
+			if ev.Mask&(maskCtrl|maskAlt|maskMeta) != 0 || !unicode.IsPrint(ev.Keychar) {
+				continue
+			}
+			if text, ok := previous().(*TypeTextAction); ok && ev.When.Sub(last) < time.Second {
+				text.Text += string(ev.Keychar)
+				last = ev.When
+				continue
+			}
+			emit(ev.When, &TypeTextAction{Action: "type_text", Text: string(ev.Keychar)})
+		}
+	}
+
+	raw := make([]json.RawMessage, 0, len(actions))
+	for _, action := range actions {
+		data, err := json.Marshal(action)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode action: %v", err)
+		}
+		raw = append(raw, data)
+	}
+	return raw, nil
+}
+
+func distance(a, b Coordinates) float64 {
+	return math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+}
+
+// samplePath keeps at most n evenly spaced points of a path
+func samplePath(path []Coordinates, n int) []Coordinates {
+	if len(path) <= n {
+		return path
+	}
+	sampled := make([]Coordinates, 0, n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, path[i*len(path)/n])
+	}
+	return sampled
+}
+
+// ReplayMacro runs a stored macro, scaling its pauses and typing delays by
+// 1/speed. Actions run as a batch on the session, stopping at the first
+// failure.
+func (s *ComputerUseService) ReplayMacro(ctx context.Context, name string, speed float64, session string) (*BatchResponse, error) {
+	if speed == 0 {
+		speed = 1
+	}
+	if speed < 0.1 || speed > 10 {
+		return nil, fmt.Errorf("speed must be between 0.1 and 10")
+	}
+
+	macro, err := s.macros.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := make([]ComputerAction, 0, len(macro.Actions))
+	for i, raw := range macro.Actions {
+		var action ComputerAction
+		if err := json.Unmarshal(scaleMacroAction(raw, speed), &action); err != nil {
+			return nil, fmt.Errorf("macro %s action %d: invalid JSON: %v", name, i, err)
+		}
+		actions = append(actions, action)
+	}
+
+	log.Printf("Replaying macro %s at %.2fx", name, speed)
+	return s.runActions(ctx, session, actions, false)
+}
+
+// scaleMacroAction divides the timing of wait and type_text actions by speed
+func scaleMacroAction(raw json.RawMessage, speed float64) json.RawMessage {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return raw
+	}
+
+	key := ""
+	switch fields["action"] {
+	case "wait":
+		key = "duration"
+	case "type_text":
+		key = "delay"
+	default:
+		return raw
+	}
+
+	if value, ok := fields[key].(float64); ok {
+		fields[key] = int(value / speed)
+	}
+	scaled, err := json.Marshal(fields)
+	if err != nil {
+		return raw
+	}
+	return scaled
+}
+
+// StartRecording starts recording a macro
+func (s *ComputerUseService) StartRecording(name string) error {
+	return s.recorder.Start(name)
+}
+
+// StopRecording stops recording and stores the macro
+func (s *ComputerUseService) StopRecording() (*Macro, error) {
+	macro, err := s.recorder.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.macros.Save(macro); err != nil {
+		return nil, err
+	}
+	return macro, nil
+}
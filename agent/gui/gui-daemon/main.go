@@ -5,6 +5,9 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 // ComputerUseController handles HTTP requests
@@ -42,8 +45,20 @@ func (c *ComputerUseController) HandleComputerUse(w http.ResponseWriter, r *http
 		log.Printf("Computer action request: %s", action.Action)
 	}
 
-	// Execute action
-	result, err := c.service.ExecuteAction(action)
+	// Don't interleave with a batch running on the same display
+	release, err := c.service.Lock(r.Context(), action.Session)
+	if err != nil {
+		status := http.StatusBadRequest
+		if r.Context().Err() != nil {
+			status = http.StatusServiceUnavailable
+		}
+		c.sendError(w, err.Error(), status)
+		return
+	}
+	defer release()
+
+	// Execute action; a client disconnect cancels multi-step actions
+	result, err := c.service.ExecuteAction(r.Context(), action)
 	if err != nil {
 		log.Printf("Error executing action: %v", err)
 		c.sendError(w, err.Error(), http.StatusInternalServerError)
@@ -54,6 +69,160 @@ func (c *ComputerUseController) HandleComputerUse(w http.ResponseWriter, r *http
 	c.sendSuccess(w, result)
 }
 
+// HandleBatch handles POST /computer-use/batch requests
+func (c *ComputerUseController) HandleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		c.sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var batch BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		log.Printf("Error decoding batch request: %v", err)
+		c.sendError(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	result, err := c.service.ExecuteBatch(r.Context(), batch)
+	if err != nil {
+		log.Printf("Error executing batch: %v", err)
+		c.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Failed steps are reported per step; the batch itself ran
+	c.sendSuccess(w, result)
+}
+
+// HandleMacros handles the /macros endpoints:
+//
+//	POST   /macros/record        start recording, body {"name": "..."}
+//	POST   /macros/stop          stop recording and save the macro
+//	GET    /macros               list macros
+//	GET    /macros/{name}        show a macro
+//	DELETE /macros/{name}        delete a macro
+//	POST   /macros/{name}/replay replay, body {"speed": 2, "session": "..."}
+func (c *ComputerUseController) HandleMacros(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/macros"), "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "" && r.Method == http.MethodGet:
+		macros, err := c.service.macros.List()
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		c.sendSuccess(w, macros)
+
+	case path == "record" && r.Method == http.MethodPost:
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			c.sendError(w, "Invalid JSON request", http.StatusBadRequest)
+			return
+		}
+		if err := c.service.StartRecording(req.Name); err != nil {
+			c.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.sendSuccess(w, map[string]string{"recording": req.Name})
+
+	case path == "stop" && r.Method == http.MethodPost:
+		macro, err := c.service.StopRecording()
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		c.sendSuccess(w, macro)
+
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		macro, err := c.service.macros.Load(parts[0])
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		c.sendSuccess(w, macro)
+
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := c.service.macros.Delete(parts[0]); err != nil {
+			c.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		c.sendSuccess(w, nil)
+
+	case len(parts) == 2 && parts[1] == "replay" && r.Method == http.MethodPost:
+		var req struct {
+			Speed   float64 `json:"speed"`
+			Session string  `json:"session"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				c.sendError(w, "Invalid JSON request", http.StatusBadRequest)
+				return
+			}
+		}
+		result, err := c.service.ReplayMacro(r.Context(), parts[0], req.Speed, req.Session)
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.sendSuccess(w, result)
+
+	default:
+		c.sendError(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// HandleSessions handles the /sessions endpoints:
+//
+//	POST   /sessions      start a display, body {"id": "...", "width": 1280, "height": 720}
+//	GET    /sessions      list sessions
+//	GET    /sessions/{id} show a session
+//	DELETE /sessions/{id} stop a session's display
+func (c *ComputerUseController) HandleSessions(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+
+	switch {
+	case id == "" && r.Method == http.MethodGet:
+		c.sendSuccess(w, c.service.displays.List())
+
+	case id == "" && r.Method == http.MethodPost:
+		var req CreateSessionRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				c.sendError(w, "Invalid JSON request", http.StatusBadRequest)
+				return
+			}
+		}
+		session, err := c.service.displays.Create(r.Context(), req.ID, req.Width, req.Height)
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.sendSuccess(w, session)
+
+	case !strings.Contains(id, "/") && r.Method == http.MethodGet:
+		session, err := c.service.displays.Get(id)
+		if err != nil {
+			c.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		c.sendSuccess(w, session)
+
+	case !strings.Contains(id, "/") && r.Method == http.MethodDelete:
+		if err := c.service.displays.Destroy(id); err != nil {
+			c.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		c.sendSuccess(w, nil)
+
+	default:
+		c.sendError(w, "Not found", http.StatusNotFound)
+	}
+}
+
 // HandleHealth handles GET /health requests
 func (c *ComputerUseController) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -106,7 +275,7 @@ func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 
 		// Handle preflight requests
@@ -131,6 +300,11 @@ func main() {
 
 	// Setup routes
 	http.HandleFunc("/computer-use", corsMiddleware(loggingMiddleware(controller.HandleComputerUse)))
+	http.HandleFunc("/computer-use/batch", corsMiddleware(loggingMiddleware(controller.HandleBatch)))
+	http.HandleFunc("/macros", corsMiddleware(loggingMiddleware(controller.HandleMacros)))
+	http.HandleFunc("/macros/", corsMiddleware(loggingMiddleware(controller.HandleMacros)))
+	http.HandleFunc("/sessions", corsMiddleware(loggingMiddleware(controller.HandleSessions)))
+	http.HandleFunc("/sessions/", corsMiddleware(loggingMiddleware(controller.HandleSessions)))
 	http.HandleFunc("/health", corsMiddleware(loggingMiddleware(controller.HandleHealth)))
 
 	// Root endpoint
@@ -151,8 +325,21 @@ func main() {
 	log.Printf("Starting Jarvis GUI Daemon on port %s", port)
 	log.Printf("Endpoints:")
 	log.Printf("  POST /computer-use - Execute computer actions")
+	log.Printf("  POST /computer-use/batch - Execute a list of actions in order")
+	log.Printf("  POST /macros/record, /macros/stop - Record a macro")
+	log.Printf("  POST /macros/{name}/replay - Replay a macro")
+	log.Printf("  POST /sessions, GET /sessions, DELETE /sessions/{id} - Manage per-session displays")
 	log.Printf("  GET  /health       - Health check")
 
+	// Don't leave session displays running when the daemon stops
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		controller.service.displays.DestroyAll()
+		os.Exit(0)
+	}()
+
 	if err := http.ListenAndServe(":"+port, nil); err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// decodeBase64Image decodes a base64 PNG or JPEG, tolerating data URLs
+func decodeBase64Image(data string) (image.Image, error) {
+	if i := strings.Index(data, ";base64,"); i >= 0 {
+		data = data[i+len(";base64,"):]
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 image: %v", err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, nil
+}
+
+// matchScore rates how well template matches src at x, y from 0 (opposite
+// colours) to 1 (identical)
+func matchScore(src, template image.Image, x, y int) float64 {
+	tb := template.Bounds()
+	sb := src.Bounds()
+
+	var diff, count uint64
+	for ty := tb.Min.Y; ty < tb.Max.Y; ty++ {
+		for tx := tb.Min.X; tx < tb.Max.X; tx++ {
+			sx, sy := sb.Min.X+x+tx-tb.Min.X, sb.Min.Y+y+ty-tb.Min.Y
+			if !(image.Point{sx, sy}).In(sb) {
+				continue
+			}
+			tr, tg, tbl, _ := template.At(tx, ty).RGBA()
+			sr, sg, sbl, _ := src.At(sx, sy).RGBA()
+			diff += absDiff(tr, sr) + absDiff(tg, sg) + absDiff(tbl, sbl)
+			count += 3
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return 1 - float64(diff)/float64(count*0xffff)
+}
+
+func absDiff(a, b uint32) uint64 {
+	if a > b {
+		return uint64(a - b)
+	}
+	return uint64(b - a)
+}
+
+// rankMatches scores matches, drops any that overlap a better one and
+// returns at most limit, best first
+func rankMatches(src, template image.Image, found []Coordinates, offset Coordinates, limit int) []ImageMatch {
+	width, height := template.Bounds().Dx(), template.Bounds().Dy()
+
+	scored := make([]ImageMatch, 0, len(found))
+	for _, p := range found {
+		scored = append(scored, ImageMatch{
+			X:      offset.X + p.X,
+			Y:      offset.Y + p.Y,
+			Width:  width,
+			Height: height,
+			Center: Coordinates{X: offset.X + p.X + width/2, Y: offset.Y + p.Y + height/2},
+			Score:  matchScore(src, template, p.X, p.Y),
+		})
+	}
+	sort.SliceStable(scored, func(i, j int) bool { return scored[i].Score > scored[j].Score })
+
+	// With a non-zero tolerance neighbouring offsets of one hit all match
+	var kept []ImageMatch
+	for _, m := range scored {
+		overlaps := false
+		for _, k := range kept {
+			if m.X < k.X+k.Width && k.X < m.X+m.Width && m.Y < k.Y+k.Height && k.Y < m.Y+m.Height {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			kept = append(kept, m)
+		}
+		if limit > 0 && len(kept) == limit {
+			break
+		}
+	}
+	return kept
+}
+
+// parseHexColor parses "#rrggbb" or "rrggbb"
+func parseHexColor(s string) ([3]uint8, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return [3]uint8{}, fmt.Errorf("invalid color %q: expected #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]uint8{}, fmt.Errorf("invalid color %q: expected #rrggbb", s)
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// colorsMatch reports whether every channel of a and b differs by at most
+// tolerance (0-255)
+func colorsMatch(a, b [3]uint8, tolerance int) bool {
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > tolerance {
+			return false
+		}
+	}
+	return true
+}
+
+func formatHexColor(c [3]uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
@@ -2,13 +2,15 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"image"
 	"image/png"
 	"log"
-	"os/exec"
+	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-vgo/robotgo"
@@ -19,6 +21,54 @@ import (
 // RobotGoService wraps RobotGo library for GUI automation
 type RobotGoService struct {
 	autoDelayMs int
+	display     string // X display of a session; empty for the daemon's own
+}
+
+// defaultXDisplay is the display the daemon was started on
+var defaultXDisplay = os.Getenv("DISPLAY")
+
+// xDisplay tracks which display robotgo talks to. robotgo keeps a single
+// process-wide X connection, so services on different displays take turns
+// switching it. Child processes get their display through displayEnv and
+// never through the daemon's own DISPLAY.
+var xDisplay struct {
+	sync.Mutex
+	current string
+}
+
+// use points robotgo at the service's display and holds it there until
+// the returned function is called.
+//
+// Screen capture, pixel colours, non-ASCII typing and window lookups don't
+// use robotgo's connection: they open their own from $DISPLAY. So DISPLAY
+// is pointed at a session's display too while it is held. (Setting
+// robotgo.DisplayID would route captures through robotgo's connection
+// instead, but robotgo closes that connection after every capture.)
+func (r *RobotGoService) use() func() {
+	xDisplay.Lock()
+	if r.display != xDisplay.current {
+		name := r.display
+		if name == "" {
+			name = defaultXDisplay
+		}
+		if err := robotgo.SetXDisplayName(name); err != nil {
+			log.Printf("Warning: failed to switch to display %s: %v", name, err)
+		}
+		xDisplay.current = r.display
+	}
+
+	if r.display == "" {
+		return xDisplay.Unlock
+	}
+	os.Setenv("DISPLAY", r.display)
+	return func() {
+		if defaultXDisplay == "" {
+			os.Unsetenv("DISPLAY")
+		} else {
+			os.Setenv("DISPLAY", defaultXDisplay)
+		}
+		xDisplay.Unlock()
+	}
 }
 
 // NewRobotGoService creates a new RobotGo service
@@ -31,7 +81,9 @@ func NewRobotGoService() *RobotGoService {
 // MouseMove moves cursor to coordinates
 func (r *RobotGoService) MouseMove(x, y int) error {
 	log.Printf("Moving mouse to coordinates: (%d, %d)", x, y)
+	release := r.use()
 	robotgo.Move(x, y)
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
@@ -45,7 +97,9 @@ func (r *RobotGoService) MouseClick(button ButtonType) error {
 		buttonStr = "center" // RobotGo uses "center" instead of "middle"
 	}
 
+	release := r.use()
 	robotgo.Click(buttonStr, false) // false = single click
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
@@ -59,7 +113,9 @@ func (r *RobotGoService) MouseDoubleClick(button ButtonType) error {
 		buttonStr = "center"
 	}
 
+	release := r.use()
 	robotgo.Click(buttonStr, true) // true = double click
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
@@ -77,7 +133,9 @@ func (r *RobotGoService) MouseToggle(button ButtonType, down bool) error {
 		buttonStr = "center"
 	}
 
+	release := r.use()
 	robotgo.Toggle(buttonStr, action)
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
@@ -100,24 +158,33 @@ func (r *RobotGoService) MouseScroll(direction ScrollDirection, amount int) erro
 		x = amount
 	}
 
+	release := r.use()
 	robotgo.Scroll(x, y)
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
 
 // GetCursorPosition returns current cursor position
 func (r *RobotGoService) GetCursorPosition() (int, int, error) {
+	release := r.use()
 	x, y := robotgo.GetMousePos()
+	release()
 	log.Printf("Cursor position: (%d, %d)", x, y)
 	return x, y, nil
 }
 
-// TypeText types text character by character
-func (r *RobotGoService) TypeText(text string, delayMs int) error {
+// TypeText types text character by character, stopping if ctx is cancelled
+func (r *RobotGoService) TypeText(ctx context.Context, text string, delayMs int) error {
 	log.Printf("Typing text: %s", text)
 
 	for _, char := range text {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		release := r.use()
 		robotgo.TypeStr(string(char))
+		release()
 		if delayMs > 0 {
 			time.Sleep(time.Duration(delayMs) * time.Millisecond)
 		}
@@ -129,7 +196,9 @@ func (r *RobotGoService) TypeText(text string, delayMs int) error {
 // TypeString types entire string at once (faster)
 func (r *RobotGoService) TypeString(text string) error {
 	log.Printf("Typing string: %s", text)
+	release := r.use()
 	robotgo.TypeStr(text)
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
@@ -138,6 +207,7 @@ func (r *RobotGoService) TypeString(text string) error {
 func (r *RobotGoService) PressKey(keys ...string) error {
 	log.Printf("Pressing keys: %v", keys)
 
+	release := r.use()
 	if len(keys) == 1 {
 		robotgo.KeyTap(keys[0])
 	} else if len(keys) > 1 {
@@ -146,6 +216,7 @@ func (r *RobotGoService) PressKey(keys ...string) error {
 		mainKey := keys[len(keys)-1]
 		robotgo.KeyTap(mainKey, modifiers)
 	}
+	release()
 
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
@@ -159,30 +230,34 @@ func (r *RobotGoService) KeyToggle(key string, down bool) error {
 	}
 	log.Printf("Key %s: %s", key, action)
 
+	release := r.use()
 	robotgo.KeyToggle(key, action)
+	release()
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
 }
 
-// PasteText pastes text using clipboard
-func (r *RobotGoService) PasteText(text string) error {
+// PasteText pastes text through the clipboard of the service's display
+func (r *RobotGoService) PasteText(ctx context.Context, text string) error {
 	log.Printf("Pasting text (length: %d)", len(text))
 
 	// Write to clipboard
-	err := robotgo.WriteAll(text)
-	if err != nil {
-		return fmt.Errorf("failed to write to clipboard: %v", err)
+	clipboard := &Clipboard{display: r.display}
+	if err := clipboard.Write(ctx, clipboardText, []byte(text)); err != nil {
+		return err
 	}
 
 	// Brief pause to ensure clipboard is set
 	time.Sleep(100 * time.Millisecond)
 
 	// Paste using Ctrl+V (Cmd+V on macOS)
+	release := r.use()
 	if runtime.GOOS == "darwin" {
 		robotgo.KeyTap("v", "cmd")
 	} else {
 		robotgo.KeyTap("v", "ctrl")
 	}
+	release()
 
 	time.Sleep(time.Duration(r.autoDelayMs) * time.Millisecond)
 	return nil
@@ -191,6 +266,7 @@ func (r *RobotGoService) PasteText(text string) error {
 // CaptureScreen captures screenshot and returns image
 func (r *RobotGoService) CaptureScreen() (image.Image, error) {
 	log.Println("Capturing screen")
+	defer r.use()()
 
 	bmp := robotgo.CaptureScreen()
 	if bmp == nil {
@@ -203,6 +279,22 @@ func (r *RobotGoService) CaptureScreen() (image.Image, error) {
 	return img, nil
 }
 
+// CaptureRegion captures the given rectangle of the screen
+func (r *RobotGoService) CaptureRegion(x, y, width, height int) (image.Image, error) {
+	log.Printf("Capturing screen region (%d, %d) %dx%d", x, y, width, height)
+	defer r.use()()
+
+	bmp := robotgo.CaptureScreen(x, y, width, height)
+	if bmp == nil {
+		return nil, fmt.Errorf("failed to capture screen region")
+	}
+
+	defer robotgo.FreeBitmap(bmp)
+
+	img := robotgo.ToImage(bmp)
+	return img, nil
+}
+
 // CaptureScreenPNG captures screenshot and returns PNG bytes
 func (r *RobotGoService) CaptureScreenPNG() ([]byte, error) {
 	img, err := r.CaptureScreen()
@@ -222,6 +314,7 @@ func (r *RobotGoService) CaptureScreenPNG() ([]byte, error) {
 
 // GetScreenSize returns screen dimensions
 func (r *RobotGoService) GetScreenSize() (int, int) {
+	defer r.use()()
 	width, height := robotgo.GetScreenSize()
 	return width, height
 }
@@ -229,6 +322,7 @@ func (r *RobotGoService) GetScreenSize() (int, int) {
 // FindImage finds an image on screen
 func (r *RobotGoService) FindImage(imagePath string) (int, int, error) {
 	log.Printf("Finding image on screen: %s", imagePath)
+	defer r.use()()
 
 	// Capture the entire screen
 	bit := robotgo.CaptureScreen()
@@ -248,41 +342,60 @@ func (r *RobotGoService) FindImage(imagePath string) (int, int, error) {
 	return x, y, nil
 }
 
+// FindAllImages finds every occurrence of template within region of the
+// screen. tolerance ranges from 0 (exact) to 1 (any colour). It also returns
+// the captured region so callers can score the matches.
+func (r *RobotGoService) FindAllImages(template image.Image, region Region, tolerance float64) ([]Coordinates, image.Image, error) {
+	log.Printf("Finding image (%dx%d) in region (%d, %d) %dx%d", template.Bounds().Dx(), template.Bounds().Dy(),
+		region.X, region.Y, region.Width, region.Height)
+	defer r.use()()
+
+	screen := robotgo.CaptureScreen(region.X, region.Y, region.Width, region.Height)
+	if screen == nil {
+		return nil, nil, fmt.Errorf("failed to capture screen")
+	}
+	defer robotgo.FreeBitmap(screen)
+
+	templateBit := robotgo.ImgToCBitmap(template)
+	if templateBit == nil {
+		return nil, nil, fmt.Errorf("failed to convert template")
+	}
+	defer robotgo.FreeBitmap(templateBit)
+
+	var matches []Coordinates
+	for _, p := range bitmap.FindAll(templateBit, screen, tolerance) {
+		matches = append(matches, Coordinates{X: p.X, Y: p.Y})
+	}
+
+	return matches, robotgo.ToImage(screen), nil
+}
+
 // GetPixelColor gets color at specific coordinates
 func (r *RobotGoService) GetPixelColor(x, y int) string {
+	defer r.use()()
 	hex := robotgo.GetPixelColor(x, y)
 	return hex
 }
 
-// Delay waits for specified milliseconds
-func (r *RobotGoService) Delay(ms int) {
+// Delay waits for specified milliseconds or until ctx is cancelled
+func (r *RobotGoService) Delay(ctx context.Context, ms int) error {
 	log.Printf("Waiting for %d ms", ms)
-	time.Sleep(time.Duration(ms) * time.Millisecond)
-}
 
-// ExecuteCommand executes shell command (for application launching)
-func (r *RobotGoService) ExecuteCommand(command string, args ...string) error {
-	log.Printf("Executing command: %s %v", command, args)
+	timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer timer.Stop()
 
-	cmd := exec.Command(command, args...)
-	err := cmd.Start()
-	if err != nil {
-		return fmt.Errorf("failed to execute command: %v", err)
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-
-	// Don't wait for command to finish (detached execution)
-	go func() {
-		if err := cmd.Wait(); err != nil {
-			log.Printf("Command finished with error: %v", err)
-		}
-	}()
-
-	return nil
 }
 
 // ActivateWindow activates a window by title
 func (r *RobotGoService) ActivateWindow(title string) error {
 	log.Printf("Activating window: %s", title)
+	defer r.use()()
 
 	pids, err := robotgo.Pids()
 	if err != nil {
@@ -310,6 +423,7 @@ func (r *RobotGoService) ActivateWindow(title string) error {
 // AddEvent adds global event listener (for future use)
 func (r *RobotGoService) AddEvent(eventType string) chan hook.Event {
 	log.Printf("Adding event listener: %s", eventType)
+	defer r.use()()
 	evChan := hook.Start()
 	return evChan
 }
@@ -1,67 +1,150 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"image"
+	"io"
 	"log"
 	"os"
 	_ "os/exec"
 	"path/filepath"
-	"runtime"
-	"strings"
+	"regexp"
+	"syscall"
 	"time"
 )
 
 // ComputerUseService handles computer automation actions
 type ComputerUseService struct {
-	robotGo *RobotGoService
+	robotGo   *RobotGoService
+	windows   *WindowManager
+	clipboard *Clipboard
+	locks     *displayLocks
+
+	files *FileSandbox
+	apps  *AppRegistry
+
+	// display is the X display of a session scoped service; empty for the
+	// daemon's own
+	display  string
+	displays *DisplayManager
+
+	recorder *Recorder
+	macros   *MacroStore
 }
 
 // NewComputerUseService creates a new service instance
 func NewComputerUseService() *ComputerUseService {
+	robotGo := NewRobotGoService()
 	return &ComputerUseService{
-		robotGo: NewRobotGoService(),
+		robotGo:   robotGo,
+		windows:   NewWindowManager(),
+		clipboard: NewClipboard(),
+		locks:     newDisplayLocks(),
+		files:     NewFileSandbox(),
+		apps:      NewAppRegistry(),
+		displays:  NewDisplayManager(),
+		recorder:  NewRecorder(robotGo),
+		macros:    NewMacroStore(),
 	}
 }
 
-// ExecuteAction executes a computer action based on type
-func (s *ComputerUseService) ExecuteAction(action ComputerAction) (interface{}, error) {
+// ExecuteAction executes a computer action on the display of its session.
+// Multi-step actions stop early when ctx is cancelled, releasing any held
+// keys and buttons.
+func (s *ComputerUseService) ExecuteAction(ctx context.Context, action ComputerAction) (interface{}, error) {
+	scoped, err := s.forSession(action.Session)
+	if err != nil {
+		return nil, err
+	}
+	return scoped.execute(ctx, action)
+}
+
+// forSession returns the service acting on a session's display. The empty
+// session is the daemon's own display.
+func (s *ComputerUseService) forSession(id string) (*ComputerUseService, error) {
+	if id == "" {
+		return s, nil
+	}
+
+	session, err := s.displays.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	scoped := *s
+	scoped.display = session.Display
+	scoped.robotGo = session.robotGo
+	scoped.windows = &WindowManager{display: session.Display}
+	scoped.clipboard = &Clipboard{display: session.Display}
+	return &scoped, nil
+}
+
+// execute executes a computer action based on type
+func (s *ComputerUseService) execute(ctx context.Context, action ComputerAction) (interface{}, error) {
 	log.Printf("Executing computer action: %s", action.Action)
 
 	switch action.Action {
 	case "move_mouse":
 		return s.moveMouse(action.Data)
 	case "trace_mouse":
-		return s.traceMouse(action.Data)
+		return s.traceMouse(ctx, action.Data)
 	case "click_mouse":
-		return s.clickMouse(action.Data)
+		return s.clickMouse(ctx, action.Data)
 	case "press_mouse":
 		return s.pressMouse(action.Data)
 	case "drag_mouse":
-		return s.dragMouse(action.Data)
+		return s.dragMouse(ctx, action.Data)
 	case "scroll":
-		return s.scroll(action.Data)
+		return s.scroll(ctx, action.Data)
 	case "type_keys":
 		return s.typeKeys(action.Data)
 	case "press_keys":
 		return s.pressKeys(action.Data)
 	case "type_text":
-		return s.typeText(action.Data)
+		return s.typeText(ctx, action.Data)
 	case "paste_text":
-		return s.pasteText(action.Data)
+		return s.pasteText(ctx, action.Data)
+	case "clipboard_get":
+		return s.clipboardGet(ctx, action.Data)
+	case "clipboard_set":
+		return s.clipboardSet(ctx, action.Data)
 	case "wait":
-		return s.wait(action.Data)
+		return s.wait(ctx, action.Data)
 	case "screenshot":
-		return s.screenshot(action.Data)
+		return s.screenshot(ctx, action.Data)
 	case "cursor_position":
 		return s.cursorPosition(action.Data)
 	case "application":
-		return s.application(action.Data)
+		return s.application(ctx, action.Data)
+	case "find_image":
+		return s.findImage(action.Data)
+	case "pixel_color":
+		return s.pixelColor(action.Data)
+	case "wait_for_pixel":
+		return s.waitForPixel(ctx, action.Data)
+	case "wait_until":
+		return s.waitUntil(ctx, action.Data)
+	case "list_windows":
+		return s.listWindows(ctx)
+	case "activate_window", "minimize_window", "maximize_window", "close_window":
+		return s.windowAction(ctx, action.Action, action.Data)
+	case "move_window":
+		return s.moveWindow(ctx, action.Data)
+	case "resize_window":
+		return s.resizeWindow(ctx, action.Data)
 	case "write_file":
 		return s.writeFile(action.Data)
 	case "read_file":
 		return s.readFile(action.Data)
+	case "list_dir":
+		return s.listDir(action.Data)
+	case "stat":
+		return s.statFile(action.Data)
+	case "delete_file":
+		return s.deleteFile(action.Data)
 	default:
 		return nil, fmt.Errorf("unsupported action: %s", action.Action)
 	}
@@ -78,7 +161,7 @@ func (s *ComputerUseService) moveMouse(data json.RawMessage) (interface{}, error
 }
 
 // traceMouse moves mouse along a path
-func (s *ComputerUseService) traceMouse(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) traceMouse(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params TraceMouseAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
@@ -104,6 +187,9 @@ func (s *ComputerUseService) traceMouse(data json.RawMessage) (interface{}, erro
 
 	// Move along path
 	for _, coord := range params.Path {
+		if ctx.Err() != nil {
+			break
+		}
 		if err := s.robotGo.MouseMove(coord.X, coord.Y); err != nil {
 			return nil, err
 		}
@@ -118,11 +204,11 @@ func (s *ComputerUseService) traceMouse(data json.RawMessage) (interface{}, erro
 		}
 	}
 
-	return nil, nil
+	return nil, ctx.Err()
 }
 
 // clickMouse performs mouse click
-func (s *ComputerUseService) clickMouse(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) clickMouse(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params ClickMouseAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
@@ -147,6 +233,9 @@ func (s *ComputerUseService) clickMouse(data json.RawMessage) (interface{}, erro
 	// Perform clicks
 	if params.ClickCount > 1 {
 		for i := 0; i < params.ClickCount; i++ {
+			if ctx.Err() != nil {
+				break
+			}
 			if err := s.robotGo.MouseClick(params.Button); err != nil {
 				return nil, err
 			}
@@ -167,7 +256,7 @@ func (s *ComputerUseService) clickMouse(data json.RawMessage) (interface{}, erro
 		}
 	}
 
-	return nil, nil
+	return nil, ctx.Err()
 }
 
 // pressMouse presses or releases mouse button
@@ -189,7 +278,7 @@ func (s *ComputerUseService) pressMouse(data json.RawMessage) (interface{}, erro
 }
 
 // dragMouse drags mouse along a path
-func (s *ComputerUseService) dragMouse(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) dragMouse(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params DragMouseAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
@@ -220,6 +309,9 @@ func (s *ComputerUseService) dragMouse(data json.RawMessage) (interface{}, error
 
 	// Drag along path
 	for _, coord := range params.Path {
+		if ctx.Err() != nil {
+			break
+		}
 		if err := s.robotGo.MouseMove(coord.X, coord.Y); err != nil {
 			return nil, err
 		}
@@ -239,11 +331,11 @@ func (s *ComputerUseService) dragMouse(data json.RawMessage) (interface{}, error
 		}
 	}
 
-	return nil, nil
+	return nil, ctx.Err()
 }
 
 // scroll performs scroll operation
-func (s *ComputerUseService) scroll(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) scroll(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params ScrollAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
@@ -267,6 +359,9 @@ func (s *ComputerUseService) scroll(data json.RawMessage) (interface{}, error) {
 
 	// Perform scroll
 	for i := 0; i < params.ScrollCount; i++ {
+		if ctx.Err() != nil {
+			break
+		}
 		if err := s.robotGo.MouseScroll(params.Direction, 1); err != nil {
 			return nil, err
 		}
@@ -282,7 +377,7 @@ func (s *ComputerUseService) scroll(data json.RawMessage) (interface{}, error) {
 		}
 	}
 
-	return nil, nil
+	return nil, ctx.Err()
 }
 
 // typeKeys types key combination
@@ -339,49 +434,360 @@ func (s *ComputerUseService) pressKeys(data json.RawMessage) (interface{}, error
 }
 
 // typeText types text string
-func (s *ComputerUseService) typeText(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) typeText(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params TypeTextAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
 	}
 
-	return nil, s.robotGo.TypeText(params.Text, params.Delay)
+	return nil, s.robotGo.TypeText(ctx, params.Text, params.Delay)
 }
 
-// pasteText pastes text using clipboard
-func (s *ComputerUseService) pasteText(data json.RawMessage) (interface{}, error) {
+// pasteText pastes text using clipboard, optionally restoring what the
+// clipboard held before
+func (s *ComputerUseService) pasteText(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params PasteTextAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
 	}
 
-	return nil, s.robotGo.PasteText(params.Text)
+	if !params.Restore {
+		return nil, s.robotGo.PasteText(ctx, params.Text)
+	}
+
+	saved, err := s.clipboard.Snapshot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save clipboard: %v", err)
+	}
+
+	if err := s.robotGo.PasteText(ctx, params.Text); err != nil {
+		return nil, err
+	}
+
+	// Give the application time to fetch the pasted text before the
+	// clipboard changes under it
+	if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+		return nil, err
+	}
+
+	return nil, s.clipboard.Restore(context.WithoutCancel(ctx), saved)
+}
+
+// clipboardGet reads the clipboard as text, an image or a file list
+func (s *ComputerUseService) clipboardGet(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params ClipboardGetAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	targets, err := s.clipboard.Targets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	format := params.Format
+	if format == "" {
+		switch {
+		case containsString(targets, clipboardImage):
+			format = "image"
+		case containsString(targets, clipboardFiles):
+			format = "files"
+		case len(targets) > 0:
+			format = "text"
+		default:
+			return ClipboardResponse{}, nil
+		}
+	}
+
+	response := ClipboardResponse{Format: format, Targets: targets}
+	switch format {
+	case "text":
+		text, err := s.clipboard.Read(ctx, clipboardText)
+		if err != nil {
+			return nil, err
+		}
+		response.Text = string(text)
+	case "image":
+		image, err := s.clipboard.Read(ctx, clipboardImage)
+		if err != nil {
+			return nil, err
+		}
+		response.Image = base64.StdEncoding.EncodeToString(image)
+	case "files":
+		list, err := s.clipboard.Read(ctx, clipboardFiles)
+		if err != nil {
+			return nil, err
+		}
+		response.Files = parseFileURIs(list)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s (use text, image or files)", format)
+	}
+
+	return response, nil
+}
+
+// clipboardSet puts text, an image or a list of files on the clipboard
+func (s *ComputerUseService) clipboardSet(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params ClipboardSetAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	given := 0
+	if params.Text != nil {
+		given++
+	}
+	if params.Image != "" {
+		given++
+	}
+	if len(params.Files) > 0 {
+		given++
+	}
+	if given != 1 {
+		return nil, fmt.Errorf("specify exactly one of text, image or files")
+	}
+
+	switch {
+	case params.Text != nil:
+		return nil, s.clipboard.Write(ctx, clipboardText, []byte(*params.Text))
+
+	case params.Image != "":
+		img, err := decodeBase64Image(params.Image)
+		if err != nil {
+			return nil, err
+		}
+		// Applications expect PNG data for image/png whatever was sent
+		pngData, _, err := encodeImage(img, FormatPNG, 0)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.clipboard.Write(ctx, clipboardImage, pngData)
+
+	default:
+		// Only files in the file root may be offered to other applications
+		paths := make([]string, len(params.Files))
+		for i, path := range params.Files {
+			resolved, err := s.files.Resolve(path)
+			if err != nil {
+				return nil, err
+			}
+			paths[i] = resolved
+		}
+		list, err := fileURIs(paths)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.clipboard.Write(ctx, clipboardFiles, list)
+	}
 }
 
 // wait delays execution
-func (s *ComputerUseService) wait(data json.RawMessage) (interface{}, error) {
+func (s *ComputerUseService) wait(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params WaitAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
 	}
 
-	s.robotGo.Delay(params.Duration)
-	return nil, nil
+	return nil, s.robotGo.Delay(ctx, params.Duration)
 }
 
-// screenshot captures screen
-func (s *ComputerUseService) screenshot(data json.RawMessage) (interface{}, error) {
+// sleepContext waits for d without logging, for polling loops
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// screenshot captures the screen, a region or a window, optionally
+// downscaled and JPEG encoded
+func (s *ComputerUseService) screenshot(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params ScreenshotAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
 	log.Println("Taking screenshot")
 
-	pngBytes, err := s.robotGo.CaptureScreenPNG()
+	screenWidth, screenHeight := s.robotGo.GetScreenSize()
+	screen := Region{Width: screenWidth, Height: screenHeight}
+
+	region := screen
+	switch {
+	case params.Region != nil && params.Window != nil:
+		return nil, fmt.Errorf("specify either region or window, not both")
+	case params.Region != nil:
+		region = *params.Region
+	case params.Window != nil:
+		win, err := s.windows.Find(ctx, *params.Window)
+		if err != nil {
+			return nil, err
+		}
+		region = Region{X: win.X, Y: win.Y, Width: win.Width, Height: win.Height}
+	}
+
+	region, ok := clipRegion(region, screen)
+	if !ok {
+		return nil, fmt.Errorf("region is outside the %dx%d screen", screenWidth, screenHeight)
+	}
+
+	var img image.Image
+	var err error
+	if region == screen {
+		img, err = s.robotGo.CaptureScreen()
+	} else {
+		img, err = s.robotGo.CaptureRegion(region.X, region.Y, region.Width, region.Height)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to capture screenshot: %v", err)
 	}
 
-	base64Image := base64.StdEncoding.EncodeToString(pngBytes)
+	img, scale := scaleToFit(img, params.MaxWidth, params.MaxHeight)
+
+	encoded, mediaType, err := encodeImage(img, params.Format, params.Quality)
+	if err != nil {
+		return nil, err
+	}
 
 	return ScreenshotResponse{
-		Image: base64Image,
+		Image:        base64.StdEncoding.EncodeToString(encoded),
+		MediaType:    mediaType,
+		Width:        img.Bounds().Dx(),
+		Height:       img.Bounds().Dy(),
+		Scale:        scale,
+		Region:       region,
+		ScreenWidth:  screenWidth,
+		ScreenHeight: screenHeight,
+	}, nil
+}
+
+// findImage finds all occurrences of a template on screen
+func (s *ComputerUseService) findImage(data json.RawMessage) (interface{}, error) {
+	var params FindImageAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Template == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+	if params.Tolerance < 0 || params.Tolerance > 1 {
+		return nil, fmt.Errorf("tolerance must be between 0 and 1")
+	}
+	if params.MaxMatches <= 0 {
+		params.MaxMatches = 20
+	}
+
+	template, err := decodeBase64Image(params.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	screenWidth, screenHeight := s.robotGo.GetScreenSize()
+	region := Region{Width: screenWidth, Height: screenHeight}
+	if params.Region != nil {
+		var ok bool
+		if region, ok = clipRegion(*params.Region, region); !ok {
+			return nil, fmt.Errorf("region is outside the %dx%d screen", screenWidth, screenHeight)
+		}
+	}
+	if template.Bounds().Dx() > region.Width || template.Bounds().Dy() > region.Height {
+		return nil, fmt.Errorf("template is larger than the search region")
+	}
+
+	found, captured, err := s.robotGo.FindAllImages(template, region, params.Tolerance)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := rankMatches(captured, template, found, Coordinates{X: region.X, Y: region.Y}, params.MaxMatches)
+	if matches == nil {
+		matches = []ImageMatch{}
+	}
+
+	return FindImageResponse{
+		Found:   len(matches) > 0,
+		Matches: matches,
+	}, nil
+}
+
+// pixelColor reads the colour at coordinates
+func (s *ComputerUseService) pixelColor(data json.RawMessage) (interface{}, error) {
+	var params PixelColorAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	color, err := s.readPixel(params.Coordinates)
+	if err != nil {
+		return nil, err
+	}
+
+	return PixelColorResponse{
+		X:     params.Coordinates.X,
+		Y:     params.Coordinates.Y,
+		Color: formatHexColor(color),
+	}, nil
+}
+
+// readPixel reads and parses the colour at coordinates
+func (s *ComputerUseService) readPixel(at Coordinates) ([3]uint8, error) {
+	width, height := s.robotGo.GetScreenSize()
+	if at.X < 0 || at.Y < 0 || at.X >= width || at.Y >= height {
+		return [3]uint8{}, fmt.Errorf("coordinates (%d, %d) are outside the %dx%d screen", at.X, at.Y, width, height)
+	}
+	return parseHexColor(s.robotGo.GetPixelColor(at.X, at.Y))
+}
+
+// waitForPixel polls a pixel until it has the expected colour
+func (s *ComputerUseService) waitForPixel(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params WaitForPixelAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	want, err := parseHexColor(params.Color)
+	if err != nil {
+		return nil, err
+	}
+	if params.Tolerance < 0 || params.Tolerance > 255 {
+		return nil, fmt.Errorf("tolerance must be between 0 and 255")
+	}
+	if params.Timeout <= 0 {
+		params.Timeout = defaultWaitTimeout
+	}
+	if params.Timeout > maxWaitTimeout {
+		return nil, fmt.Errorf("timeout must be at most %d ms", maxWaitTimeout)
+	}
+	if params.Interval <= 0 {
+		params.Interval = 100
+	}
+
+	var color [3]uint8
+	elapsed, err := pollUntil(ctx, time.Duration(params.Timeout)*time.Millisecond,
+		time.Duration(params.Interval)*time.Millisecond, func() (bool, error) {
+			var err error
+			color, err = s.readPixel(params.Coordinates)
+			return err == nil && colorsMatch(color, want, params.Tolerance), err
+		})
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("timed out after %d ms waiting for %s at (%d, %d); last color %s",
+			params.Timeout, params.Color, params.Coordinates.X, params.Coordinates.Y, formatHexColor(color))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return PixelColorResponse{
+		X:       params.Coordinates.X,
+		Y:       params.Coordinates.Y,
+		Color:   formatHexColor(color),
+		Elapsed: elapsed.Milliseconds(),
 	}, nil
 }
 
@@ -400,8 +806,9 @@ func (s *ComputerUseService) cursorPosition(data json.RawMessage) (interface{},
 	}, nil
 }
 
-// application launches or activates application
-func (s *ComputerUseService) application(data json.RawMessage) (interface{}, error) {
+// application launches an application from the registry or a .desktop
+// entry, optionally waiting for its window to appear
+func (s *ComputerUseService) application(ctx context.Context, data json.RawMessage) (interface{}, error) {
 	var params ApplicationAction
 	if err := json.Unmarshal(data, &params); err != nil {
 		return nil, err
@@ -409,71 +816,163 @@ func (s *ComputerUseService) application(data json.RawMessage) (interface{}, err
 
 	log.Printf("Application action: %s", params.Application)
 
-	// Platform-specific application commands
-	var command string
-	var args []string
-
-	switch runtime.GOOS {
-	case "darwin": // macOS
-		command, args = s.getMacOSAppCommand(params.Application)
-	case "linux":
-		command, args = s.getLinuxAppCommand(params.Application)
-	case "windows":
-		command, args = s.getWindowsAppCommand(params.Application)
+	var app AppConfig
+	switch {
+	case params.DesktopEntry != "":
+		app = AppConfig{DesktopEntry: params.DesktopEntry}
+	case params.Application != "":
+		var err error
+		if app, err = s.apps.Lookup(string(params.Application)); err != nil {
+			return nil, err
+		}
 	default:
-		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+		return nil, fmt.Errorf("specify application or desktopEntry")
 	}
 
-	if command == "" {
-		return nil, fmt.Errorf("unsupported application: %s", params.Application)
+	if app.DesktopEntry != "" {
+		var err error
+		if app, err = resolveDesktopEntry(app); err != nil {
+			return nil, err
+		}
+	}
+	app.Args = append(app.Args, params.Args...)
+	if params.WindowTitle != "" {
+		app.WindowTitle = params.WindowTitle
+	}
+
+	var title *regexp.Regexp
+	if app.WindowTitle != "" {
+		var err error
+		if title, err = regexp.Compile("(?i)" + app.WindowTitle); err != nil {
+			return nil, fmt.Errorf("invalid window title pattern: %v", err)
+		}
 	}
 
-	return nil, s.robotGo.ExecuteCommand(command, args...)
+	if params.Timeout <= 0 {
+		params.Timeout = defaultAppWaitTimeout
+	}
+	if params.Timeout > maxWaitTimeout {
+		return nil, fmt.Errorf("timeout must be at most %d ms", maxWaitTimeout)
+	}
+
+	// Remember the open windows so an existing one is not mistaken for
+	// the new application's
+	before := make(map[string]bool)
+	if params.Wait {
+		windows, err := s.windows.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, win := range windows {
+			before[win.ID] = true
+		}
+	}
+
+	pid, command, err := launchApp(app, s.display)
+	if err != nil {
+		return nil, err
+	}
+
+	response := ApplicationResponse{
+		Application: string(params.Application),
+		PID:         pid,
+		Command:     command,
+	}
+	if params.DesktopEntry != "" {
+		response.Application = params.DesktopEntry
+	}
+	if !params.Wait {
+		return response, nil
+	}
+
+	win, elapsed, err := s.waitForAppWindow(ctx, pid, title, before, time.Duration(params.Timeout)*time.Millisecond)
+	if err == context.DeadlineExceeded {
+		return nil, fmt.Errorf("application started (pid %d) but no window appeared within %d ms", pid, params.Timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	response.Window = win
+	response.Elapsed = elapsed.Milliseconds()
+	return response, nil
+}
+
+// listWindows lists the open windows
+func (s *ComputerUseService) listWindows(ctx context.Context) (interface{}, error) {
+	windows, err := s.windows.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if windows == nil {
+		windows = []WindowInfo{}
+	}
+
+	return WindowListResponse{Windows: windows}, nil
 }
 
-// getMacOSAppCommand returns command for macOS
-func (s *ComputerUseService) getMacOSAppCommand(app ApplicationName) (string, []string) {
-	appMap := map[ApplicationName][]string{
-		AppFirefox:   {"open", "-a", "Firefox"},
-		AppVSCode:    {"open", "-a", "Visual Studio Code"},
-		AppTerminal:  {"open", "-a", "Terminal"},
-		AppDirectory: {"open", "-a", "Finder"},
+// windowAction activates, minimizes, maximizes or closes a window
+func (s *ComputerUseService) windowAction(ctx context.Context, action string, data json.RawMessage) (interface{}, error) {
+	var params WindowAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	// Activating "the focused window" would be a no-op, so require a target
+	if action == "activate_window" && params.WindowSelector == (WindowSelector{}) {
+		return nil, fmt.Errorf("activate_window needs title, pid or windowId")
 	}
 
-	if cmd, exists := appMap[app]; exists {
-		return cmd[0], cmd[1:]
+	win, err := s.windows.Find(ctx, params.WindowSelector)
+	if err != nil {
+		return nil, err
 	}
-	return "", nil
+
+	switch action {
+	case "activate_window":
+		err = s.windows.Activate(ctx, win)
+	case "minimize_window":
+		err = s.windows.Minimize(ctx, win)
+	case "maximize_window":
+		err = s.windows.Maximize(ctx, win)
+	case "close_window":
+		err = s.windows.Close(ctx, win)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return win, nil
 }
 
-// getLinuxAppCommand returns command for Linux
-func (s *ComputerUseService) getLinuxAppCommand(app ApplicationName) (string, []string) {
-	appMap := map[ApplicationName]string{
-		AppFirefox:   "firefox",
-		AppVSCode:    "code",
-		AppTerminal:  "xterm",
-		AppDirectory: "nautilus",
+// moveWindow moves a window
+func (s *ComputerUseService) moveWindow(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params MoveWindowAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
 	}
 
-	if cmd, exists := appMap[app]; exists {
-		return cmd, nil
+	win, err := s.windows.Find(ctx, params.WindowSelector)
+	if err != nil {
+		return nil, err
 	}
-	return "", nil
+
+	return win, s.windows.Move(ctx, win, params.Coordinates.X, params.Coordinates.Y)
 }
 
-// getWindowsAppCommand returns command for Windows
-func (s *ComputerUseService) getWindowsAppCommand(app ApplicationName) (string, []string) {
-	appMap := map[ApplicationName]string{
-		AppFirefox:   "firefox.exe",
-		AppVSCode:    "code.cmd",
-		AppTerminal:  "cmd.exe",
-		AppDirectory: "explorer.exe",
+// resizeWindow resizes a window
+func (s *ComputerUseService) resizeWindow(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params ResizeWindowAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
 	}
 
-	if cmd, exists := appMap[app]; exists {
-		return cmd, nil
+	win, err := s.windows.Find(ctx, params.WindowSelector)
+	if err != nil {
+		return nil, err
 	}
-	return "", nil
+
+	return win, s.windows.Resize(ctx, win, params.Width, params.Height)
 }
 
 // writeFile writes file to disk
@@ -493,12 +992,26 @@ func (s *ComputerUseService) writeFile(data json.RawMessage) (interface{}, error
 			Message: fmt.Sprintf("Failed to decode base64 data: %v", err),
 		}, nil
 	}
+	if int64(len(fileData)) > s.files.maxWriteBytes {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("File exceeds the write limit of %d bytes", s.files.maxWriteBytes),
+		}, nil
+	}
 
 	// Resolve path
-	targetPath := params.Path
-	if !filepath.IsAbs(targetPath) {
-		homeDir, _ := os.UserHomeDir()
-		targetPath = filepath.Join(homeDir, "Desktop", targetPath)
+	targetPath, err := s.files.Resolve(params.Path)
+	if err != nil {
+		return FileOperationResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+	if s.files.IsRoot(targetPath) {
+		return FileOperationResponse{
+			Success: false,
+			Message: "Path must name a file",
+		}, nil
 	}
 
 	// Ensure directory exists
@@ -536,36 +1049,72 @@ func (s *ComputerUseService) readFile(data json.RawMessage) (interface{}, error)
 	log.Printf("Reading file: %s", params.Path)
 
 	// Resolve path
-	targetPath := params.Path
-	if !filepath.IsAbs(targetPath) {
-		homeDir, _ := os.UserHomeDir()
-		targetPath = filepath.Join(homeDir, "Desktop", targetPath)
+	targetPath, err := s.files.Resolve(params.Path)
+	if err != nil {
+		return FileOperationResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
 	}
 
-	// Read file
-	fileData, err := os.ReadFile(targetPath)
+	// Open once and check what was opened, so the file can't be swapped
+	// between the checks and the read. O_NONBLOCK keeps a FIFO from
+	// blocking the open; it's rejected below.
+	file, err := os.OpenFile(targetPath, os.O_RDONLY|syscall.O_NONBLOCK, 0)
 	if err != nil {
 		return FileOperationResponse{
 			Success: false,
-			Message: fmt.Sprintf("Failed to read file: %v", err),
+			Message: fmt.Sprintf("Failed to open file: %v", err),
 		}, nil
 	}
+	defer file.Close()
 
-	// Get file info
-	fileInfo, err := os.Stat(targetPath)
+	fileInfo, err := file.Stat()
 	if err != nil {
 		return FileOperationResponse{
 			Success: false,
 			Message: fmt.Sprintf("Failed to get file info: %v", err),
 		}, nil
 	}
+	if fileInfo.IsDir() {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s is a directory; use list_dir", params.Path),
+		}, nil
+	}
+	if !fileInfo.Mode().IsRegular() {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("%s is not a regular file", params.Path),
+		}, nil
+	}
+	if fileInfo.Size() > s.files.maxReadBytes {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("File is %d bytes, over the read limit of %d bytes", fileInfo.Size(), s.files.maxReadBytes),
+		}, nil
+	}
+
+	// Read one byte past the limit to catch a file that grew since Stat
+	fileData, err := io.ReadAll(io.LimitReader(file, s.files.maxReadBytes+1))
+	if err != nil {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to read file: %v", err),
+		}, nil
+	}
+	if int64(len(fileData)) > s.files.maxReadBytes {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("File grew past the read limit of %d bytes while being read", s.files.maxReadBytes),
+		}, nil
+	}
 
 	// Encode to base64
 	base64Data := base64.StdEncoding.EncodeToString(fileData)
 
 	// Determine MIME type
-	ext := strings.ToLower(filepath.Ext(targetPath))
-	mimeType := getMimeType(ext)
+	mimeType := detectMediaType(targetPath, fileData)
 
 	log.Printf("File read successfully: %s", targetPath)
 
@@ -573,31 +1122,127 @@ func (s *ComputerUseService) readFile(data json.RawMessage) (interface{}, error)
 		Success:   true,
 		Data:      base64Data,
 		Name:      filepath.Base(targetPath),
-		Size:      fileInfo.Size(),
+		Size:      int64(len(fileData)),
 		MediaType: mimeType,
 	}, nil
 }
 
-// getMimeType returns MIME type based on file extension
-func getMimeType(ext string) string {
-	mimeTypes := map[string]string{
-		".pdf":  "application/pdf",
-		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
-		".doc":  "application/msword",
-		".txt":  "text/plain",
-		".html": "text/html",
-		".json": "application/json",
-		".xml":  "text/xml",
-		".csv":  "text/csv",
-		".png":  "image/png",
-		".jpg":  "image/jpeg",
-		".jpeg": "image/jpeg",
-		".gif":  "image/gif",
-		".svg":  "image/svg+xml",
-	}
-
-	if mime, exists := mimeTypes[ext]; exists {
-		return mime
-	}
-	return "application/octet-stream"
+// listDir lists a directory inside the file root
+func (s *ComputerUseService) listDir(data json.RawMessage) (interface{}, error) {
+	var params ListDirAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	dirPath, err := s.files.Resolve(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list directory: %v", err)
+	}
+
+	response := DirListResponse{Path: s.files.Relative(dirPath), Entries: []FileInfo{}}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Removed while listing
+			continue
+		}
+		response.Entries = append(response.Entries, s.fileInfo(filepath.Join(dirPath, entry.Name()), info, false))
+	}
+	return response, nil
+}
+
+// statFile describes a file or directory inside the file root
+func (s *ComputerUseService) statFile(data json.RawMessage) (interface{}, error) {
+	var params StatAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	targetPath, err := s.files.Resolve(params.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+	return s.fileInfo(targetPath, info, true), nil
+}
+
+// fileInfo builds a FileInfo, sniffing the content type when asked
+func (s *ComputerUseService) fileInfo(path string, info os.FileInfo, sniff bool) FileInfo {
+	result := FileInfo{
+		Name:    info.Name(),
+		Path:    s.files.Relative(path),
+		IsDir:   info.IsDir(),
+		Size:    info.Size(),
+		Mode:    info.Mode().String(),
+		ModTime: info.ModTime(),
+	}
+	if sniff && info.Mode().IsRegular() {
+		result.MediaType, _ = sniffFile(path)
+	}
+	return result
+}
+
+// deleteFile deletes a file, or a directory when it is empty or recursive is set
+func (s *ComputerUseService) deleteFile(data json.RawMessage) (interface{}, error) {
+	var params DeleteFileAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Deleting file: %s", params.Path)
+
+	targetPath, err := s.files.ResolveLink(params.Path)
+	if err != nil {
+		return FileOperationResponse{
+			Success: false,
+			Message: err.Error(),
+		}, nil
+	}
+	if s.files.IsRoot(targetPath) {
+		return FileOperationResponse{
+			Success: false,
+			Message: "Refusing to delete the file root",
+		}, nil
+	}
+
+	// Lstat so a symlink is removed rather than followed
+	info, err := os.Lstat(targetPath)
+	if err != nil {
+		return FileOperationResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to get file info: %v", err),
+		}, nil
+	}
+
+	if info.IsDir() && params.Recursive {
+		err = os.RemoveAll(targetPath)
+	} else {
+		err = os.Remove(targetPath)
+	}
+	if err != nil {
+		message := fmt.Sprintf("Failed to delete: %v", err)
+		if info.IsDir() && !params.Recursive {
+			message = fmt.Sprintf("Failed to delete directory (set recursive to delete its contents): %v", err)
+		}
+		return FileOperationResponse{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	log.Printf("Deleted successfully: %s", targetPath)
+
+	return FileOperationResponse{
+		Success: true,
+		Message: fmt.Sprintf("Deleted: %s", targetPath),
+	}, nil
 }
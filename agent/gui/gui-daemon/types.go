@@ -1,6 +1,9 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Coordinates represents x,y coordinates on screen
 type Coordinates struct {
@@ -49,8 +52,9 @@ const (
 
 // ComputerAction represents the base action structure
 type ComputerAction struct {
-	Action string          `json:"action"`
-	Data   json.RawMessage `json:"-"`
+	Action  string          `json:"action"`
+	Session string          `json:"session,omitempty"` // Run on this session's display
+	Data    json.RawMessage `json:"-"`
 }
 
 // UnmarshalJSON custom unmarshaler to preserve raw data
@@ -138,8 +142,23 @@ type TypeTextAction struct {
 
 // PasteTextAction pastes text using clipboard
 type PasteTextAction struct {
+	Action  string `json:"action"`
+	Text    string `json:"text"`
+	Restore bool   `json:"restore,omitempty"` // Put back the previous clipboard afterwards
+}
+
+// ClipboardGetAction reads the clipboard
+type ClipboardGetAction struct {
 	Action string `json:"action"`
-	Text   string `json:"text"`
+	Format string `json:"format,omitempty"` // text, image or files; default whatever the clipboard holds
+}
+
+// ClipboardSetAction replaces the clipboard with text, an image or files
+type ClipboardSetAction struct {
+	Action string   `json:"action"`
+	Text   *string  `json:"text,omitempty"`
+	Image  string   `json:"image,omitempty"` // Base64 encoded PNG or JPEG
+	Files  []string `json:"files,omitempty"` // Paths in the file root, pasted as files in file managers
 }
 
 // WaitAction delays execution
@@ -148,9 +167,31 @@ type WaitAction struct {
 	Duration int    `json:"duration"` // milliseconds
 }
 
-// ScreenshotAction captures screen
+// Region is a rectangle on screen
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// ImageFormat represents screenshot encodings
+type ImageFormat string
+
+const (
+	FormatPNG  ImageFormat = "png"
+	FormatJPEG ImageFormat = "jpeg"
+)
+
+// ScreenshotAction captures the screen, a region of it or a window
 type ScreenshotAction struct {
-	Action string `json:"action"`
+	Action    string          `json:"action"`
+	Region    *Region         `json:"region,omitempty"`
+	Window    *WindowSelector `json:"window,omitempty"`
+	Format    ImageFormat     `json:"format,omitempty"`    // png (default) or jpeg
+	Quality   int             `json:"quality,omitempty"`   // JPEG quality 1-100
+	MaxWidth  int             `json:"maxWidth,omitempty"`  // Downscale to fit, keeping aspect ratio
+	MaxHeight int             `json:"maxHeight,omitempty"` // Downscale to fit, keeping aspect ratio
 }
 
 // CursorPositionAction gets cursor position
@@ -158,10 +199,15 @@ type CursorPositionAction struct {
 	Action string `json:"action"`
 }
 
-// ApplicationAction launches/activates application
+// ApplicationAction launches an application by registry name or .desktop entry
 type ApplicationAction struct {
-	Action      string          `json:"action"`
-	Application ApplicationName `json:"application"`
+	Action       string          `json:"action"`
+	Application  ApplicationName `json:"application,omitempty"`
+	DesktopEntry string          `json:"desktopEntry,omitempty"` // Desktop entry id or path
+	Args         []string        `json:"args,omitempty"`         // Appended to the configured arguments
+	Wait         bool            `json:"wait,omitempty"`         // Wait for the application's window
+	WindowTitle  string          `json:"windowTitle,omitempty"`  // Overrides the configured title pattern
+	Timeout      int             `json:"timeout,omitempty"`      // Milliseconds
 }
 
 // WriteFileAction writes file to disk
@@ -177,6 +223,116 @@ type ReadFileAction struct {
 	Path   string `json:"path"`
 }
 
+// ListDirAction lists a directory
+type ListDirAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path,omitempty"` // Default: the file root
+}
+
+// DeleteFileAction deletes a file or directory
+type DeleteFileAction struct {
+	Action    string `json:"action"`
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive,omitempty"` // Required for non-empty directories
+}
+
+// StatAction describes a file or directory
+type StatAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+}
+
+// WindowSelector picks a window by id, pid or a case-insensitive title
+// substring. An empty selector means the focused window.
+type WindowSelector struct {
+	WindowID string `json:"windowId,omitempty"`
+	Title    string `json:"title,omitempty"`
+	PID      int    `json:"pid,omitempty"`
+}
+
+// WindowAction activates, minimizes, maximizes or closes a window
+type WindowAction struct {
+	Action string `json:"action"`
+	WindowSelector
+}
+
+// MoveWindowAction moves a window's top-left corner to coordinates
+type MoveWindowAction struct {
+	Action string `json:"action"`
+	WindowSelector
+	Coordinates Coordinates `json:"coordinates"`
+}
+
+// ResizeWindowAction resizes a window
+type ResizeWindowAction struct {
+	Action string `json:"action"`
+	WindowSelector
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// FindImageAction finds a template image on screen
+type FindImageAction struct {
+	Action     string  `json:"action"`
+	Template   string  `json:"template"`             // Base64 encoded PNG or JPEG
+	Tolerance  float64 `json:"tolerance,omitempty"`  // 0 (exact) to 1 (any colour)
+	Region     *Region `json:"region,omitempty"`     // Search area, default the whole screen
+	MaxMatches int     `json:"maxMatches,omitempty"` // Default 20
+}
+
+// PixelColorAction reads the colour of a pixel
+type PixelColorAction struct {
+	Action      string      `json:"action"`
+	Coordinates Coordinates `json:"coordinates"`
+}
+
+// WaitForPixelAction waits until a pixel has a colour
+type WaitForPixelAction struct {
+	Action      string      `json:"action"`
+	Coordinates Coordinates `json:"coordinates"`
+	Color       string      `json:"color"`               // #rrggbb
+	Tolerance   int         `json:"tolerance,omitempty"` // Per channel, 0-255
+	Timeout     int         `json:"timeout,omitempty"`   // milliseconds, default 10000, at most 120000
+	Interval    int         `json:"interval,omitempty"`  // milliseconds, default 100
+}
+
+// WaitUntilAction polls until a condition holds or the timeout expires.
+// Conditions: region_changed, region_stable, image_appears,
+// image_disappears, pixel_color and window_exists.
+type WaitUntilAction struct {
+	Action    string `json:"action"`
+	Condition string `json:"condition"`
+	Timeout   int    `json:"timeout,omitempty"`  // milliseconds, default 10000
+	Interval  int    `json:"interval,omitempty"` // milliseconds between checks, default 250
+
+	// region_changed, region_stable, image_appears, image_disappears
+	Region *Region `json:"region,omitempty"` // Default the whole screen
+	// region_changed, region_stable: fraction of pixels that may differ
+	// without counting as a change
+	Threshold float64 `json:"threshold,omitempty"`
+	// region_stable: how long the region must stay unchanged, default 1000 ms
+	StableFor int `json:"stableFor,omitempty"`
+
+	// image_appears, image_disappears
+	Template string `json:"template,omitempty"` // Base64 encoded PNG or JPEG
+	// 0-1 for images, 0-255 per channel for pixel_color
+	Tolerance float64 `json:"tolerance,omitempty"`
+
+	// pixel_color
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+	Color       string       `json:"color,omitempty"` // #rrggbb
+
+	// window_exists
+	Window *WindowSelector `json:"window,omitempty"`
+}
+
+// BatchRequest is an ordered list of actions run as one unit
+type BatchRequest struct {
+	Session         string            `json:"session,omitempty"` // Display session the actions run on
+	Actions         []json.RawMessage `json:"actions"`
+	ContinueOnError bool              `json:"continueOnError,omitempty"` // Default: stop at the first failure
+}
+
 // Response represents API response
 type Response struct {
 	Success bool        `json:"success"`
@@ -184,9 +340,17 @@ type Response struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-// ScreenshotResponse for screenshot action
+// ScreenshotResponse for screenshot action. A point in the image maps back
+// to the screen as (region.x + x/scale, region.y + y/scale).
 type ScreenshotResponse struct {
-	Image string `json:"image"` // Base64 encoded PNG
+	Image        string  `json:"image"` // Base64 encoded
+	MediaType    string  `json:"mediaType"`
+	Width        int     `json:"width"`
+	Height       int     `json:"height"`
+	Scale        float64 `json:"scale"`
+	Region       Region  `json:"region"` // Captured area in screen coordinates
+	ScreenWidth  int     `json:"screenWidth"`
+	ScreenHeight int     `json:"screenHeight"`
 }
 
 // CursorPositionResponse for cursor position action
@@ -204,3 +368,114 @@ type FileOperationResponse struct {
 	Size      int64  `json:"size,omitempty"`      // File size
 	MediaType string `json:"mediaType,omitempty"` // MIME type
 }
+
+// FileInfo describes a file or directory; paths are relative to the file root
+type FileInfo struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	IsDir     bool      `json:"isDir"`
+	Size      int64     `json:"size"`
+	Mode      string    `json:"mode"`
+	ModTime   time.Time `json:"modTime"`
+	MediaType string    `json:"mediaType,omitempty"` // Files only
+}
+
+// DirListResponse for list_dir action
+type DirListResponse struct {
+	Path    string     `json:"path"`
+	Entries []FileInfo `json:"entries"`
+}
+
+// ApplicationResponse for application action
+type ApplicationResponse struct {
+	Application string      `json:"application"`
+	PID         int         `json:"pid"`
+	Command     []string    `json:"command"`
+	Window      *WindowInfo `json:"window,omitempty"`  // Set when waiting
+	Elapsed     int64       `json:"elapsed,omitempty"` // Milliseconds waited for the window
+}
+
+// WindowInfo describes a top-level window
+type WindowInfo struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	PID     int    `json:"pid,omitempty"`
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Width   int    `json:"width"`
+	Height  int    `json:"height"`
+	Focused bool   `json:"focused"`
+}
+
+// WindowListResponse for list_windows action
+type WindowListResponse struct {
+	Windows []WindowInfo `json:"windows"`
+}
+
+// ImageMatch is a template match on screen
+type ImageMatch struct {
+	X      int         `json:"x"`
+	Y      int         `json:"y"`
+	Width  int         `json:"width"`
+	Height int         `json:"height"`
+	Center Coordinates `json:"center"`
+	Score  float64     `json:"score"` // 1 is a pixel perfect match
+}
+
+// FindImageResponse for find_image action
+type FindImageResponse struct {
+	Found   bool         `json:"found"`
+	Matches []ImageMatch `json:"matches"`
+}
+
+// PixelColorResponse for pixel_color and wait_for_pixel actions
+type PixelColorResponse struct {
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Color   string `json:"color"`             // #rrggbb
+	Elapsed int64  `json:"elapsed,omitempty"` // milliseconds waited
+}
+
+// WaitUntilResponse for wait_until action
+type WaitUntilResponse struct {
+	Condition string      `json:"condition"`
+	Elapsed   int64       `json:"elapsed"` // milliseconds waited
+	Region    *Region     `json:"region,omitempty"`
+	Match     *ImageMatch `json:"match,omitempty"`
+	Color     string      `json:"color,omitempty"`
+	Window    *WindowInfo `json:"window,omitempty"`
+}
+
+// BatchStepResult is the outcome of one action in a batch
+type BatchStepResult struct {
+	Index    int         `json:"index"`
+	Action   string      `json:"action"`
+	Success  bool        `json:"success"`
+	Data     interface{} `json:"data,omitempty"`
+	Error    string      `json:"error,omitempty"`
+	Duration int64       `json:"duration"` // milliseconds
+}
+
+// BatchResponse for the batch endpoint
+type BatchResponse struct {
+	Success  bool              `json:"success"` // Every step succeeded
+	Steps    []BatchStepResult `json:"steps"`
+	Skipped  int               `json:"skipped,omitempty"` // Steps not run after a failure
+	Duration int64             `json:"duration"`          // milliseconds
+}
+
+// ClipboardResponse for clipboard_get action
+type ClipboardResponse struct {
+	Format  string   `json:"format"` // text, image, files or empty
+	Text    string   `json:"text,omitempty"`
+	Image   string   `json:"image,omitempty"` // Base64 encoded PNG
+	Files   []string `json:"files,omitempty"`
+	Targets []string `json:"targets,omitempty"` // All media types offered
+}
+
+// CreateSessionRequest starts a virtual display for a session
+type CreateSessionRequest struct {
+	ID     string `json:"id,omitempty"` // Default: a random id
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"time"
+)
+
+const (
+	defaultWaitTimeout  = 10000 // milliseconds
+	maxWaitTimeout      = 120000
+	defaultWaitInterval = 250
+	defaultStableFor    = 1000
+)
+
+// pollUntil calls check every interval until it reports true, returns an
+// error or the timeout expires. It returns how long it waited.
+func pollUntil(ctx context.Context, timeout, interval time.Duration, check func() (bool, error)) (time.Duration, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+
+	for {
+		done, err := check()
+		if err != nil {
+			return time.Since(start), err
+		}
+		if done {
+			return time.Since(start), nil
+		}
+		if time.Now().After(deadline) {
+			return time.Since(start), context.DeadlineExceeded
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return time.Since(start), err
+		}
+	}
+}
+
+// waitUntil polls until the requested condition holds
+func (s *ComputerUseService) waitUntil(ctx context.Context, data json.RawMessage) (interface{}, error) {
+	var params WaitUntilAction
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+
+	if params.Timeout <= 0 {
+		params.Timeout = defaultWaitTimeout
+	}
+	if params.Timeout > maxWaitTimeout {
+		return nil, fmt.Errorf("timeout must be at most %d ms", maxWaitTimeout)
+	}
+	if params.Interval <= 0 {
+		params.Interval = defaultWaitInterval
+	}
+
+	check, result, err := s.waitCondition(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Waiting up to %d ms until %s", params.Timeout, params.Condition)
+
+	elapsed, err := pollUntil(ctx, time.Duration(params.Timeout)*time.Millisecond,
+		time.Duration(params.Interval)*time.Millisecond, check)
+	if err == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("timed out after %d ms waiting until %s", params.Timeout, params.Condition)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result.Condition = params.Condition
+	result.Elapsed = elapsed.Milliseconds()
+	return result, nil
+}
+
+// waitCondition builds the check for a wait_until condition. The check
+// fills in the returned response as it observes the screen.
+func (s *ComputerUseService) waitCondition(ctx context.Context, params WaitUntilAction) (func() (bool, error), *WaitUntilResponse, error) {
+	result := &WaitUntilResponse{}
+
+	switch params.Condition {
+	case "region_changed", "region_stable":
+		region, err := s.waitRegion(params.Region)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Region = &region
+		return s.regionCheck(params, region), result, nil
+
+	case "image_appears", "image_disappears":
+		if params.Template == "" {
+			return nil, nil, fmt.Errorf("%s needs a template", params.Condition)
+		}
+		if params.Tolerance < 0 || params.Tolerance > 1 {
+			return nil, nil, fmt.Errorf("tolerance must be between 0 and 1 for images")
+		}
+		template, err := decodeBase64Image(params.Template)
+		if err != nil {
+			return nil, nil, err
+		}
+		region, err := s.waitRegion(params.Region)
+		if err != nil {
+			return nil, nil, err
+		}
+		if template.Bounds().Dx() > region.Width || template.Bounds().Dy() > region.Height {
+			return nil, nil, fmt.Errorf("template is larger than the search region")
+		}
+
+		appears := params.Condition == "image_appears"
+		return func() (bool, error) {
+			found, captured, err := s.robotGo.FindAllImages(template, region, params.Tolerance)
+			if err != nil {
+				return false, err
+			}
+			matches := rankMatches(captured, template, found, Coordinates{X: region.X, Y: region.Y}, 1)
+			if len(matches) > 0 {
+				result.Match = &matches[0]
+			} else {
+				result.Match = nil
+			}
+			return (len(matches) > 0) == appears, nil
+		}, result, nil
+
+	case "pixel_color":
+		if params.Coordinates == nil {
+			return nil, nil, fmt.Errorf("pixel_color needs coordinates")
+		}
+		want, err := parseHexColor(params.Color)
+		if err != nil {
+			return nil, nil, err
+		}
+		if params.Tolerance < 0 || params.Tolerance > 255 {
+			return nil, nil, fmt.Errorf("tolerance must be between 0 and 255 for colors")
+		}
+		return func() (bool, error) {
+			color, err := s.readPixel(*params.Coordinates)
+			if err != nil {
+				return false, err
+			}
+			result.Color = formatHexColor(color)
+			return colorsMatch(color, want, int(params.Tolerance)), nil
+		}, result, nil
+
+	case "window_exists":
+		if params.Window == nil || *params.Window == (WindowSelector{}) {
+			return nil, nil, fmt.Errorf("window_exists needs a window title, pid or windowId")
+		}
+		return func() (bool, error) {
+			win, err := s.windows.Find(ctx, *params.Window)
+			if err != nil {
+				// Not there yet
+				return false, nil
+			}
+			result.Window = &win
+			return true, nil
+		}, result, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported condition: %s (use region_changed, region_stable, image_appears, image_disappears, pixel_color or window_exists)", params.Condition)
+	}
+}
+
+// waitRegion clips the requested region to the screen, defaulting to the
+// whole screen
+func (s *ComputerUseService) waitRegion(requested *Region) (Region, error) {
+	width, height := s.robotGo.GetScreenSize()
+	screen := Region{Width: width, Height: height}
+	if requested == nil {
+		return screen, nil
+	}
+
+	region, ok := clipRegion(*requested, screen)
+	if !ok {
+		return Region{}, fmt.Errorf("region is outside the %dx%d screen", width, height)
+	}
+	return region, nil
+}
+
+// regionCheck detects a region changing from how it first looked, or
+// staying unchanged for StableFor milliseconds
+func (s *ComputerUseService) regionCheck(params WaitUntilAction, region Region) func() (bool, error) {
+	stableFor := time.Duration(params.StableFor) * time.Millisecond
+	if stableFor <= 0 {
+		stableFor = defaultStableFor * time.Millisecond
+	}
+
+	var previous image.Image
+	var unchangedSince time.Time
+
+	return func() (bool, error) {
+		current, err := s.robotGo.CaptureRegion(region.X, region.Y, region.Width, region.Height)
+		if err != nil {
+			return false, err
+		}
+
+		if previous == nil {
+			previous = current
+			unchangedSince = time.Now()
+			return false, nil
+		}
+
+		changed := changedFraction(previous, current) > params.Threshold
+
+		if params.Condition == "region_changed" {
+			// Compare against the first capture so slow changes add up
+			return changed, nil
+		}
+
+		if changed {
+			previous = current
+			unchangedSince = time.Now()
+			return false, nil
+		}
+		return time.Since(unchangedSince) >= stableFor, nil
+	}
+}
+
+// changedFraction returns the fraction of pixels that differ between two
+// captures of the same region
+func changedFraction(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	if ab.Dx() != bb.Dx() || ab.Dy() != bb.Dy() {
+		return 1
+	}
+
+	total := ab.Dx() * ab.Dy()
+	if total == 0 {
+		return 0
+	}
+
+	changed := 0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			r1, g1, b1, _ := a.At(ab.Min.X+x, ab.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(bb.Min.X+x, bb.Min.Y+y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 {
+				changed++
+			}
+		}
+	}
+	return float64(changed) / float64(total)
+}
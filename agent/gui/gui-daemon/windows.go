@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// WindowManager manages X11 windows with xdotool and wmctrl. Under a bare
+// Xvfb there is no window manager to honour EWMH requests, so every
+// operation falls back to acting on the X windows directly.
+type WindowManager struct {
+	display string // X display of a session; empty for the daemon's own
+}
+
+// NewWindowManager creates a new window manager
+func NewWindowManager() *WindowManager {
+	return &WindowManager{}
+}
+
+// runX runs an X11 helper command and returns its trimmed output
+func (w *WindowManager) runX(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = displayEnv(w.display)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("%s %s: %v", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// hasWindowManager reports whether an EWMH compliant window manager is running
+func (w *WindowManager) hasWindowManager(ctx context.Context) bool {
+	_, err := w.runX(ctx, "wmctrl", "-m")
+	return err == nil
+}
+
+// List returns the top-level windows that have a title
+func (w *WindowManager) List(ctx context.Context) ([]WindowInfo, error) {
+	if w.hasWindowManager(ctx) {
+		return w.listEWMH(ctx)
+	}
+	return w.listX(ctx)
+}
+
+// listEWMH lists the windows managed by the window manager
+func (w *WindowManager) listEWMH(ctx context.Context) ([]WindowInfo, error) {
+	out, err := w.runX(ctx, "wmctrl", "-l", "-p", "-G")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list windows: %v", err)
+	}
+
+	active, _ := w.runX(ctx, "xdotool", "getactivewindow")
+	activeID, _ := parseWindowID(active)
+
+	var windows []WindowInfo
+	for _, line := range strings.Split(out, "\n") {
+		// <id> <desktop> <pid> <x> <y> <width> <height> <host> <title...>
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		id, err := parseWindowID(fields[0])
+		if err != nil {
+			continue
+		}
+
+		info := WindowInfo{ID: formatWindowID(id)}
+		info.PID, _ = strconv.Atoi(fields[2])
+		info.X, _ = strconv.Atoi(fields[3])
+		info.Y, _ = strconv.Atoi(fields[4])
+		info.Width, _ = strconv.Atoi(fields[5])
+		info.Height, _ = strconv.Atoi(fields[6])
+		info.Title = strings.Join(fields[8:], " ")
+		info.Focused = id == activeID
+
+		windows = append(windows, info)
+	}
+	return windows, nil
+}
+
+// listX lists the children of the root window; without a window manager
+// these are the application windows
+func (w *WindowManager) listX(ctx context.Context) ([]WindowInfo, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "xdotool", "search", "--maxdepth", "1", "--name", "")
+	cmd.Env = displayEnv(w.display)
+	cmd.Stderr = &stderr
+	stdout, err := cmd.Output()
+	if err != nil {
+		// xdotool exits with status 1 and no message when nothing matches
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 && stderr.Len() == 0 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list windows: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	out := strings.TrimSpace(string(stdout))
+
+	focused, _ := w.runX(ctx, "xdotool", "getwindowfocus")
+	focusedID, _ := parseWindowID(focused)
+
+	var windows []WindowInfo
+	for _, line := range strings.Split(out, "\n") {
+		id, err := parseWindowID(line)
+		if err != nil {
+			continue
+		}
+
+		title, err := w.runX(ctx, "xdotool", "getwindowname", strconv.FormatUint(id, 10))
+		if err != nil || title == "" {
+			continue
+		}
+
+		info := WindowInfo{ID: formatWindowID(id), Title: title, Focused: id == focusedID}
+		if pid, err := w.runX(ctx, "xdotool", "getwindowpid", strconv.FormatUint(id, 10)); err == nil {
+			info.PID, _ = strconv.Atoi(pid)
+		}
+		if geometry, err := w.runX(ctx, "xdotool", "getwindowgeometry", "--shell", strconv.FormatUint(id, 10)); err == nil {
+			values := parseShellVars(geometry)
+			info.X, _ = strconv.Atoi(values["X"])
+			info.Y, _ = strconv.Atoi(values["Y"])
+			info.Width, _ = strconv.Atoi(values["WIDTH"])
+			info.Height, _ = strconv.Atoi(values["HEIGHT"])
+		}
+
+		windows = append(windows, info)
+	}
+	return windows, nil
+}
+
+// Find returns the window matching the selector. An empty selector means
+// the focused window.
+func (w *WindowManager) Find(ctx context.Context, sel WindowSelector) (WindowInfo, error) {
+	windows, err := w.List(ctx)
+	if err != nil {
+		return WindowInfo{}, err
+	}
+
+	if sel.WindowID != "" {
+		id, err := parseWindowID(sel.WindowID)
+		if err != nil {
+			return WindowInfo{}, fmt.Errorf("invalid window id: %s", sel.WindowID)
+		}
+		for _, win := range windows {
+			if win.ID == formatWindowID(id) {
+				return win, nil
+			}
+		}
+		return WindowInfo{}, fmt.Errorf("window not found: %s", sel.WindowID)
+	}
+
+	if sel.Title == "" && sel.PID == 0 {
+		for _, win := range windows {
+			if win.Focused {
+				return win, nil
+			}
+		}
+		return WindowInfo{}, fmt.Errorf("no window is focused; specify title, pid or windowId")
+	}
+
+	title := strings.ToLower(sel.Title)
+	for _, win := range windows {
+		if sel.PID != 0 && win.PID != sel.PID {
+			continue
+		}
+		if title != "" && !strings.Contains(strings.ToLower(win.Title), title) {
+			continue
+		}
+		return win, nil
+	}
+
+	if sel.PID != 0 && sel.Title != "" {
+		return WindowInfo{}, fmt.Errorf("window not found: %q (pid %d)", sel.Title, sel.PID)
+	} else if sel.PID != 0 {
+		return WindowInfo{}, fmt.Errorf("window not found for pid %d", sel.PID)
+	}
+	return WindowInfo{}, fmt.Errorf("window not found: %s", sel.Title)
+}
+
+// Activate raises and focuses a window
+func (w *WindowManager) Activate(ctx context.Context, win WindowInfo) error {
+	log.Printf("Activating window %s (%s)", win.ID, win.Title)
+
+	if w.hasWindowManager(ctx) {
+		_, err := w.runX(ctx, "wmctrl", "-i", "-a", win.ID)
+		return err
+	}
+	// Map it again in case it was minimized without a window manager
+	_, err := w.runX(ctx, "xdotool", "windowmap", win.ID, "windowraise", win.ID, "windowfocus", win.ID)
+	return err
+}
+
+// Move moves a window's top-left corner to x, y
+func (w *WindowManager) Move(ctx context.Context, win WindowInfo, x, y int) error {
+	log.Printf("Moving window %s to (%d, %d)", win.ID, x, y)
+
+	_, err := w.runX(ctx, "xdotool", "windowmove", win.ID, strconv.Itoa(x), strconv.Itoa(y))
+	return err
+}
+
+// Resize sets a window's size
+func (w *WindowManager) Resize(ctx context.Context, win WindowInfo, width, height int) error {
+	log.Printf("Resizing window %s to %dx%d", win.ID, width, height)
+
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("width and height must be positive")
+	}
+	_, err := w.runX(ctx, "xdotool", "windowsize", win.ID, strconv.Itoa(width), strconv.Itoa(height))
+	return err
+}
+
+// Minimize iconifies a window, or unmaps it when there is no window manager
+func (w *WindowManager) Minimize(ctx context.Context, win WindowInfo) error {
+	log.Printf("Minimizing window %s", win.ID)
+
+	if w.hasWindowManager(ctx) {
+		_, err := w.runX(ctx, "xdotool", "windowminimize", win.ID)
+		return err
+	}
+	_, err := w.runX(ctx, "xdotool", "windowunmap", win.ID)
+	return err
+}
+
+// Maximize maximizes a window, or fills the screen with it when there is
+// no window manager
+func (w *WindowManager) Maximize(ctx context.Context, win WindowInfo) error {
+	log.Printf("Maximizing window %s", win.ID)
+
+	if w.hasWindowManager(ctx) {
+		_, err := w.runX(ctx, "wmctrl", "-i", "-r", win.ID, "-b", "add,maximized_vert,maximized_horz")
+		return err
+	}
+
+	out, err := w.runX(ctx, "xdotool", "getdisplaygeometry")
+	if err != nil {
+		return err
+	}
+	size := strings.Fields(out)
+	if len(size) != 2 {
+		return fmt.Errorf("unexpected display geometry: %s", out)
+	}
+	_, err = w.runX(ctx, "xdotool", "windowmove", win.ID, "0", "0", "windowsize", win.ID, size[0], size[1])
+	return err
+}
+
+// Close asks a window to close, or kills its client when there is no
+// window manager to deliver the request
+func (w *WindowManager) Close(ctx context.Context, win WindowInfo) error {
+	log.Printf("Closing window %s (%s)", win.ID, win.Title)
+
+	if w.hasWindowManager(ctx) {
+		_, err := w.runX(ctx, "wmctrl", "-i", "-c", win.ID)
+		return err
+	}
+	_, err := w.runX(ctx, "xdotool", "windowkill", win.ID)
+	return err
+}
+
+// parseWindowID parses a window id in decimal or 0x-prefixed hex
+func parseWindowID(s string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimSpace(s), 0, 32)
+}
+
+// formatWindowID formats a window id the way wmctrl prints it
+func formatWindowID(id uint64) string {
+	return fmt.Sprintf("0x%08x", id)
+}
+
+// parseShellVars parses KEY=value lines as printed by xdotool --shell
+func parseShellVars(s string) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(s, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+	return values
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// agentClient asks the general, GUI and visual agents directly over HTTP,
+// for channels that have to wait for the answer. None of these agents
+// consume their Kafka topics or publish results, so this is the only way
+// to get an answer from them.
+//
+// The URLs come from GENERAL_AGENT_URL, GUI_AGENT_URL and
+// VISUAL_ANALYSER_URL. The general and GUI agents serve a single user, so
+// "{user_id}" in their URL is replaced by the user the request is for, for
+// deployments that run one agent per user.
+type agentClient struct {
+	urls   map[string]string
+	client *http.Client
+}
+
+func newAgentClientFromEnv() *agentClient {
+	return &agentClient{
+		urls: map[string]string{
+			"general":         getEnvOrDefault("GENERAL_AGENT_URL", "http://agent-general:8080"),
+			"gui":             getEnvOrDefault("GUI_AGENT_URL", "http://agent-gui:8080"),
+			"visual_analyser": getEnvOrDefault("VISUAL_ANALYSER_URL", "http://visual-analyser:8080"),
+		},
+		client: &http.Client{},
+	}
+}
+
+// ask sends a routed call to its agent and returns the agent's answer
+func (a *agentClient) ask(ctx context.Context, c *Call, userID string, imageData string) (string, error) {
+	base, ok := a.urls[c.Tool]
+	if !ok {
+		return "", fmt.Errorf("the %s agent can't be asked directly", c.Tool)
+	}
+	base = strings.TrimSuffix(strings.ReplaceAll(base, "{user_id}", userID), "/")
+
+	if c.Tool == "visual_analyser" {
+		return a.analyze(ctx, base, c.Demand(), imageData)
+	}
+
+	var resp struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+	}
+	if err := a.post(ctx, base+"/agent", map[string]string{"message": c.Demand()}, &resp); err != nil {
+		return "", fmt.Errorf("%s agent: %v", c.Tool, err)
+	}
+	if resp.Error != "" {
+		return "", fmt.Errorf("%s agent: %s", c.Tool, resp.Error)
+	}
+	return resp.Response, nil
+}
+
+// analyze asks the visual analyser to describe an image
+func (a *agentClient) analyze(ctx context.Context, base, demand, imageData string) (string, error) {
+	var resp struct {
+		Success     bool   `json:"success"`
+		Description string `json:"description"`
+		Elements    []struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+			Text        string `json:"text"`
+		} `json:"elements"`
+		Error string `json:"error"`
+	}
+	request := map[string]string{
+		"action":      "describe_screen",
+		"screenshot":  imageData,
+		"query":       demand,
+		"description": demand,
+	}
+	if err := a.post(ctx, base+"/analyze", request, &resp); err != nil {
+		return "", fmt.Errorf("visual analyser: %v", err)
+	}
+	if !resp.Success {
+		return "", fmt.Errorf("visual analyser: %s", resp.Error)
+	}
+
+	var out strings.Builder
+	out.WriteString(resp.Description)
+	for _, element := range resp.Elements {
+		fmt.Fprintf(&out, "\n- %s", element.Name)
+		if element.Description != "" {
+			fmt.Fprintf(&out, ": %s", element.Description)
+		}
+		if element.Text != "" {
+			fmt.Fprintf(&out, " (%q)", element.Text)
+		}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// post sends body as JSON and decodes the JSON response into out
+func (a *agentClient) post(ctx context.Context, url string, body any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		// Agents put their failures in an "error" field when they can
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &failure) != nil || failure.Error == "" {
+			failure.Error = strings.TrimSpace(string(respBody))
+		}
+		return fmt.Errorf("status %d: %s", resp.StatusCode, failure.Error)
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,710 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"jarvis/agent/utils"
+	"jarvis/agent/utils/kafka"
+)
+
+// EmailChannel lets users talk to Jarvis by email: new messages in a
+// mailbox become router requests and the answer is sent back on the same
+// thread. The general, GUI and visual agents are asked directly and
+// answer at once. Coding requests go to the coder agent over Kafka; the
+// sender gets an acknowledgement, and the result is mailed on the thread
+// once it appears on the coder result topic. Threads waiting for a result
+// are kept in memory, so results of requests made before a restart are
+// not mailed. Only senders mapped to a user ID are served, and only once the
+// sender is authenticated, since the From header alone is easily forged.
+// A sender is authenticated by an Authentication-Results header from the
+// receiving server named in EMAIL_AUTHSERV_ID that shows DKIM or SPF passing
+// for the From domain, or by including the token EMAIL_USER_TOKENS assigns
+// to their address in the subject or body.
+//
+// The mailbox must be trusted: its server has to remove
+// Authentication-Results headers carrying its authserv-id from incoming
+// mail, and nobody else may be able to write to it.
+type EmailChannel struct {
+	router   *RouterService
+	agents   *agentClient
+	results  *kafka.Consumer
+	box      mailbox
+	users    map[string]string
+	tokens   map[string]string
+	authserv string
+	from     string
+	interval time.Duration
+
+	mu sync.Mutex
+	// threads are the conversations waiting for a coder result, by the ID
+	// of the routed message
+	threads map[string]emailThread
+}
+
+// emailThread is what's needed to answer a message on its thread
+type emailThread struct {
+	to         string
+	subject    string
+	messageID  string
+	references []string
+	created    time.Time
+}
+
+const (
+	// emailAgentTimeout bounds routing and asking an agent for one email
+	emailAgentTimeout = 10 * time.Minute
+	// emailThreadTTL is how long a thread waits for its coder result; it
+	// is well above the coder's default task timeout
+	emailThreadTTL = 24 * time.Hour
+)
+
+// NewEmailChannelFromEnv creates the channel configured by EMAIL_CHANNEL
+// ("imap" or "maildir"). It returns nil if the channel is disabled.
+func NewEmailChannelFromEnv(router *RouterService) (*EmailChannel, error) {
+	var box mailbox
+	var err error
+
+	switch strings.ToLower(os.Getenv("EMAIL_CHANNEL")) {
+	case "":
+		return nil, nil
+	case "imap":
+		box, err = newIMAPMailbox()
+	case "maildir":
+		box, err = newMaildirMailbox(os.Getenv("MAILDIR_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_CHANNEL %q; use imap or maildir", os.Getenv("EMAIL_CHANNEL"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := loadEmailUsers()
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("the email channel needs EMAIL_USER_MAP or EMAIL_USER_MAP_FILE to know who may use it")
+	}
+
+	tokens, err := loadEmailTokens()
+	if err != nil {
+		return nil, err
+	}
+	authserv := strings.TrimSpace(os.Getenv("EMAIL_AUTHSERV_ID"))
+	if authserv == "" && len(tokens) == 0 {
+		return nil, fmt.Errorf("the email channel needs EMAIL_AUTHSERV_ID or EMAIL_USER_TOKENS to authenticate senders")
+	}
+
+	interval, err := strconv.Atoi(getEnvOrDefault("EMAIL_POLL_INTERVAL", "30"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid EMAIL_POLL_INTERVAL")
+	}
+
+	results, err := kafka.NewConsumer(kafka.CoderResultTopic, getEnvOrDefault("EMAIL_RESULTS_GROUP", "router-email"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EmailChannel{
+		router:   router,
+		agents:   newAgentClientFromEnv(),
+		results:  results,
+		box:      box,
+		users:    users,
+		tokens:   tokens,
+		authserv: authserv,
+		from:     utils.SMTPConfigFromEnv().From,
+		interval: time.Duration(interval) * time.Second,
+		threads:  make(map[string]emailThread),
+	}, nil
+}
+
+// loadEmailUsers reads the sender address to user ID mapping from
+// EMAIL_USER_MAP ("alice@example.com=alice,bob@example.com=bob") and
+// EMAIL_USER_MAP_FILE (a JSON object of address to user ID)
+func loadEmailUsers() (map[string]string, error) {
+	users := make(map[string]string)
+
+	for _, pair := range strings.Split(os.Getenv("EMAIL_USER_MAP"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		address, userID, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(userID) == "" {
+			return nil, fmt.Errorf("invalid EMAIL_USER_MAP entry %q; expected address=user_id", pair)
+		}
+		users[strings.ToLower(strings.TrimSpace(address))] = strings.TrimSpace(userID)
+	}
+
+	if path := os.Getenv("EMAIL_USER_MAP_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read EMAIL_USER_MAP_FILE: %v", err)
+		}
+		var fromFile map[string]string
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return nil, fmt.Errorf("invalid EMAIL_USER_MAP_FILE: %v", err)
+		}
+		for address, userID := range fromFile {
+			users[strings.ToLower(strings.TrimSpace(address))] = userID
+		}
+	}
+
+	return users, nil
+}
+
+// loadEmailTokens reads the per-sender secrets from EMAIL_USER_TOKENS
+// ("alice@example.com=secret1,bob@example.com=secret2")
+func loadEmailTokens() (map[string]string, error) {
+	tokens := make(map[string]string)
+
+	for _, pair := range strings.Split(os.Getenv("EMAIL_USER_TOKENS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		address, token, ok := strings.Cut(pair, "=")
+		if !ok || len(strings.TrimSpace(token)) < 8 {
+			return nil, fmt.Errorf("invalid EMAIL_USER_TOKENS entry for %q; expected address=token with a token of at least 8 characters", strings.TrimSpace(address))
+		}
+		tokens[strings.ToLower(strings.TrimSpace(address))] = strings.TrimSpace(token)
+	}
+
+	return tokens, nil
+}
+
+// Run polls the mailbox and mails coder results until ctx is cancelled
+func (c *EmailChannel) Run(ctx context.Context) {
+	log.Printf("Email channel polling every %s", c.interval)
+
+	go func() {
+		defer c.results.Close()
+		if err := c.results.ConsumeCoderResults(ctx, c.deliverResult); err != nil {
+			log.Printf("Email channel: coder results: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *EmailChannel) poll(ctx context.Context) {
+	mails, err := c.box.fetch(ctx)
+	if err != nil {
+		log.Printf("Email channel: %v", err)
+		return
+	}
+
+	for _, m := range mails {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.handle(ctx, m.raw); err != nil {
+			log.Printf("Email channel: message %s: %v", m.id, err)
+		}
+		// Mark even failed messages done; retrying would only repeat the
+		// failure and could send duplicate replies
+		if err := c.box.markDone(ctx, m.id); err != nil {
+			log.Printf("Email channel: %v", err)
+		}
+	}
+}
+
+// inboundRequest is what the channel takes from an email
+type inboundRequest struct {
+	from       string
+	messageID  string
+	references []string
+	subject    string
+	text       string
+	imageData  string
+	// authResults are the message's Authentication-Results headers
+	authResults []string
+}
+
+func (c *EmailChannel) handle(ctx context.Context, raw []byte) error {
+	req, skip, err := parseInbound(raw)
+	if err != nil {
+		return err
+	}
+	if skip != "" {
+		log.Printf("Email channel: ignoring message from %s: %s", req.from, skip)
+		return nil
+	}
+	if c.from != "" && strings.EqualFold(req.from, c.from) {
+		return nil
+	}
+
+	userID, ok := c.users[strings.ToLower(req.from)]
+	if !ok {
+		// Don't reply to unknown senders; that would turn Jarvis into a
+		// source of backscatter
+		log.Printf("Email channel: ignoring message from unknown sender %s", req.from)
+		return nil
+	}
+
+	// Like unknown senders, unauthenticated ones get no reply: the real
+	// owner of the address never sent the message
+	if !c.authenticate(req) {
+		log.Printf("Email channel: ignoring unauthenticated message claiming to be from %s", req.from)
+		return nil
+	}
+
+	message := strings.TrimSpace(req.text)
+	if message == "" {
+		message = req.subject
+	}
+	if message == "" {
+		return fmt.Errorf("empty message from %s", req.from)
+	}
+
+	log.Printf("Email channel: request from %s (user %s)", req.from, userID)
+
+	thread := emailThread{
+		to:         req.from,
+		subject:    replySubject(req.subject),
+		messageID:  req.messageID,
+		references: req.references,
+		created:    time.Now(),
+	}
+
+	processCtx, cancel := context.WithTimeout(ctx, emailAgentTimeout)
+	defer cancel()
+
+	answer, err := c.process(processCtx, userID, message, req.imageData, thread)
+	if err != nil {
+		answer = fmt.Sprintf("Sorry, I couldn't handle your request: %v", err)
+	}
+	return c.reply(thread, answer)
+}
+
+// process routes a message and returns the text to reply with. The
+// general, GUI and visual agents are asked directly; a coding request is
+// only acknowledged, and its thread waits for the result.
+func (c *EmailChannel) process(ctx context.Context, userID, message, imageData string, thread emailThread) (string, error) {
+	call, err := c.router.Route(ctx, message, imageData)
+	if err != nil {
+		return "", err
+	}
+	if call == nil {
+		return "", fmt.Errorf("couldn't work out which agent should handle it")
+	}
+
+	if call.Tool != "coder" {
+		return c.agents.ask(ctx, call, userID, imageData)
+	}
+
+	// Register the thread before the request is sent so a fast result
+	// can't arrive first. The ID is only known after dispatching, so keep
+	// the lock until then.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneThreads(time.Now())
+
+	id, err := c.router.Dispatch(ctx, call, userID, imageData)
+	if err != nil {
+		return "", err
+	}
+	c.threads[id] = thread
+
+	return fmt.Sprintf("Your coding request has been passed to the coder agent (request %s). "+
+		"This is only an acknowledgement: I'll reply on this thread with the result when the work is done.", id), nil
+}
+
+// deliverResult mails a coder result to the thread waiting for it
+func (c *EmailChannel) deliverResult(ctx context.Context, result kafka.CoderResult) error {
+	c.mu.Lock()
+	thread, ok := c.threads[result.RequestID]
+	delete(c.threads, result.RequestID)
+	c.mu.Unlock()
+
+	if !ok {
+		// Requests from other channels, or made before a restart
+		return nil
+	}
+	return c.reply(thread, formatCoderResult(result))
+}
+
+// pruneThreads forgets threads whose result never came. c.mu must be held.
+func (c *EmailChannel) pruneThreads(now time.Time) {
+	for id, thread := range c.threads {
+		if now.Sub(thread.created) > emailThreadTTL {
+			log.Printf("Email channel: gave up waiting for the result of %s for %s", id, thread.to)
+			delete(c.threads, id)
+		}
+	}
+}
+
+func (c *EmailChannel) reply(thread emailThread, body string) error {
+	var opts []utils.EmailOption
+	if thread.messageID != "" {
+		opts = append(opts, utils.InReplyTo(thread.messageID, thread.references...))
+	}
+
+	if err := utils.SendStyledEmail(c.from, []string{thread.to}, thread.subject, body, opts...); err != nil {
+		return fmt.Errorf("failed to reply to %s: %v", thread.to, err)
+	}
+	return nil
+}
+
+// formatCoderResult describes a coder result in markdown
+func formatCoderResult(result kafka.CoderResult) string {
+	var out strings.Builder
+
+	switch result.Status {
+	case "committed":
+		out.WriteString("The coder agent finished your request and committed the changes.\n\n")
+	case "tests_failed":
+		out.WriteString("The coder agent committed its changes, but the tests still fail.\n\n")
+	case "no_changes":
+		out.WriteString("The coder agent finished your request without changing any files.\n\n")
+	default:
+		out.WriteString("The coder agent couldn't complete your request.\n\n")
+	}
+
+	if result.Error != "" {
+		fmt.Fprintf(&out, "Error: %s\n\n", result.Error)
+	}
+	if result.Summary != "" {
+		fmt.Fprintf(&out, "%s\n\n", result.Summary)
+	}
+	for _, field := range []struct{ name, value string }{
+		{"Workspace", result.Workspace},
+		{"Branch", result.Branch},
+		{"Commit", result.Commit},
+		{"Tests", result.Tests},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(&out, "- **%s:** `%s`\n", field.name, field.value)
+		}
+	}
+
+	if result.Diff != "" {
+		out.WriteString("\n")
+		if result.DiffTruncated {
+			out.WriteString("The diff was truncated.\n\n")
+		}
+		fmt.Fprintf(&out, "```diff\n%s\n```\n", strings.TrimRight(result.Diff, "\n"))
+	}
+
+	return strings.TrimSpace(out.String())
+}
+
+// authenticate checks that a message really comes from its From address.
+// A token found in the message is removed so it isn't passed on.
+func (c *EmailChannel) authenticate(req *inboundRequest) bool {
+	if c.authserv != "" && authResultsPass(req.authResults, c.authserv, req.from) {
+		return true
+	}
+
+	token := c.tokens[strings.ToLower(req.from)]
+	if token == "" {
+		return false
+	}
+	if !strings.Contains(req.subject, token) && !strings.Contains(req.text, token) {
+		return false
+	}
+	req.subject = strings.TrimSpace(strings.ReplaceAll(req.subject, token, ""))
+	req.text = strings.TrimSpace(strings.ReplaceAll(req.text, token, ""))
+	return true
+}
+
+// authResultsPass reports whether an Authentication-Results header (RFC
+// 8601) from authserv shows DKIM passing for the domain of from, or SPF
+// passing for a sender in that domain. Headers from other servers are
+// ignored; anyone can add those.
+func authResultsPass(headers []string, authserv, from string) bool {
+	_, domain, ok := strings.Cut(strings.ToLower(from), "@")
+	if !ok {
+		return false
+	}
+
+	for _, header := range headers {
+		parts := splitAuthResults(header)
+		if len(parts[0]) == 0 || !strings.EqualFold(parts[0][0], authserv) {
+			continue
+		}
+
+		for _, resinfo := range parts[1:] {
+			if len(resinfo) == 0 {
+				continue
+			}
+			// The first value of a property counts; later ones can't
+			// override what the server reported
+			props := make(map[string]string)
+			for _, field := range resinfo[1:] {
+				key, value, ok := strings.Cut(strings.ToLower(field), "=")
+				if _, seen := props[key]; ok && !seen {
+					props[key] = strings.Trim(value, `"`)
+				}
+			}
+
+			switch strings.ToLower(resinfo[0]) {
+			case "dkim=pass":
+				if alignedDomain(props["header.d"], domain) {
+					return true
+				}
+			case "spf=pass":
+				_, mailFrom, _ := strings.Cut(props["smtp.mailfrom"], "@")
+				if alignedDomain(mailFrom, domain) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// splitAuthResults splits an Authentication-Results header into its
+// ";"-separated parts, each a list of words. Comments, nested ones
+// included, are dropped and quoted strings are kept whole, so neither can
+// smuggle a result into the header.
+func splitAuthResults(header string) [][]string {
+	var parts [][]string
+	var words []string
+	var word strings.Builder
+	endWord := func() {
+		if word.Len() > 0 {
+			words = append(words, word.String())
+			word.Reset()
+		}
+	}
+
+	depth, quoted, escaped := 0, false, false
+	for _, r := range header {
+		switch {
+		case escaped:
+			escaped = false
+			if depth == 0 {
+				word.WriteRune(r)
+			}
+		case r == '\\' && (quoted || depth > 0):
+			escaped = true
+			if depth == 0 {
+				word.WriteRune(r)
+			}
+		case quoted:
+			word.WriteRune(r)
+			quoted = r != '"'
+		case r == '(':
+			endWord()
+			depth++
+		case depth > 0:
+			if r == ')' {
+				depth--
+			}
+		case r == '"':
+			quoted = true
+			word.WriteRune(r)
+		case r == ';':
+			endWord()
+			parts = append(parts, words)
+			words = nil
+		case unicode.IsSpace(r):
+			endWord()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	endWord()
+	return append(parts, words)
+}
+
+// alignedDomain reports whether an authenticated domain covers the From
+// domain: the same domain or a parent of it, but never a bare TLD
+func alignedDomain(authenticated, from string) bool {
+	if authenticated == "" || !strings.Contains(authenticated, ".") {
+		return false
+	}
+	return from == authenticated || strings.HasSuffix(from, "."+authenticated)
+}
+
+var messageIDs = regexp.MustCompile(`<[^<>\s]+>`)
+
+// parseInbound extracts the request from a raw email. skip is set to the
+// reason when the message should be ignored, e.g. auto-replies.
+func parseInbound(raw []byte) (req *inboundRequest, skip string, err error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse email: %v", err)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil || len(from) == 0 {
+		return nil, "", fmt.Errorf("email has no valid From address")
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	req = &inboundRequest{
+		from:        from[0].Address,
+		messageID:   messageIDs.FindString(msg.Header.Get("Message-ID")),
+		references:  messageIDs.FindAllString(msg.Header.Get("References"), -1),
+		subject:     strings.TrimSpace(subject),
+		authResults: msg.Header["Authentication-Results"],
+	}
+
+	// Never answer automatic mail, or two robots will talk forever
+	if auto := strings.ToLower(msg.Header.Get("Auto-Submitted")); auto != "" && auto != "no" {
+		return req, "auto-submitted", nil
+	}
+	switch strings.ToLower(msg.Header.Get("Precedence")) {
+	case "bulk", "junk", "list", "auto_reply":
+		return req, "bulk mail", nil
+	}
+
+	var plain, htmlText string
+	if err := walkParts(msg.Header, msg.Body, func(contentType, disposition string, body []byte) {
+		switch {
+		case contentType == "text/plain" && disposition != "attachment" && plain == "":
+			plain = string(body)
+		case contentType == "text/html" && disposition != "attachment" && htmlText == "":
+			htmlText = string(body)
+		case strings.HasPrefix(contentType, "image/") && req.imageData == "":
+			req.imageData = base64.StdEncoding.EncodeToString(body)
+		}
+	}); err != nil {
+		return nil, "", err
+	}
+
+	if plain == "" && htmlText != "" {
+		plain = htmlToText(htmlText)
+	}
+	req.text = stripQuotedReply(plain)
+
+	return req, "", nil
+}
+
+// partHeader is the subset of a MIME header walkParts needs
+type partHeader interface {
+	Get(key string) string
+}
+
+// walkParts calls visit for every leaf part of a message with its decoded body
+func walkParts(header partHeader, body io.Reader, visit func(contentType, disposition string, body []byte)) error {
+	contentType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		contentType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(contentType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read MIME part: %v", err)
+			}
+			if err := walkParts(part.Header, part, visit); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineSkipper{r: body})
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, 20<<20))
+	if err != nil {
+		return fmt.Errorf("failed to decode MIME part: %v", err)
+	}
+
+	disposition, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	visit(contentType, disposition, data)
+	return nil
+}
+
+// newlineSkipper drops line breaks so base64 bodies can be decoded
+type newlineSkipper struct {
+	r io.Reader
+}
+
+func (n *newlineSkipper) Read(p []byte) (int, error) {
+	read, err := n.r.Read(p)
+	kept := 0
+	for _, b := range p[:read] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText is a rough conversion for HTML-only mail
+func htmlToText(s string) string {
+	s = htmlBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	return html.UnescapeString(s)
+}
+
+var replyHeader = regexp.MustCompile(`^(On .+ wrote:|-+ ?Original Message ?-+|From: .+)$`)
+
+// stripQuotedReply keeps only what the sender wrote: quoted text of
+// earlier messages and the signature are dropped
+func stripQuotedReply(text string) string {
+	var kept []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if replyHeader.MatchString(trimmed) || line == "-- " {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+func replySubject(subject string) string {
+	if subject == "" {
+		return "Re: your request to Jarvis"
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
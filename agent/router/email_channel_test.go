@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"jarvis/agent/utils/kafka"
+	"jarvis/agent/utils/smtpstub"
+)
+
+// routeTo is a model that always routes to tool
+type routeTo string
+
+func (m routeTo) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	content := `{"tool": "` + string(m) + `", "tool_input": {"demand": "what is the capital of France?"}}`
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: content}}}, nil
+}
+
+func (m routeTo) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+// newTestEmailChannel returns a channel that routes to tool, serves
+// alice@example.com with a token and replies through an smtpstub server
+func newTestEmailChannel(t *testing.T, tool string) (*EmailChannel, *smtpstub.Server) {
+	t.Helper()
+
+	server, err := smtpstub.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", strconv.Itoa(server.Port()))
+	t.Setenv("SMTP_TLS", "none")
+	t.Setenv("SMTP_AUTH", "none")
+
+	return &EmailChannel{
+		router:   &RouterService{llm: routeTo(tool)},
+		agents:   &agentClient{urls: map[string]string{}, client: http.DefaultClient},
+		users:    map[string]string{"alice@example.com": "alice"},
+		tokens:   map[string]string{"alice@example.com": "s3cret-token"},
+		authserv: "mx.example.net",
+		from:     "jarvis@example.com",
+		threads:  make(map[string]emailThread),
+	}, server
+}
+
+const testRequest = "From: Alice <alice@example.com>\r\n" +
+	"To: jarvis@example.com\r\n" +
+	"Subject: Question s3cret-token\r\n" +
+	"Message-ID: <q1@example.com>\r\n" +
+	"\r\n" +
+	"What is the capital of France?\r\n"
+
+func TestEmailChannelAnswersFromAgent(t *testing.T) {
+	channel, server := newTestEmailChannel(t, "general")
+
+	var got struct {
+		Message string `json:"message"`
+	}
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The agent is the one serving the sender's user
+		if r.URL.Path != "/alice/agent" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		json.NewEncoder(w).Encode(map[string]string{"response": "Paris is the capital of France."})
+	}))
+	defer agent.Close()
+	channel.agents.urls["general"] = agent.URL + "/{user_id}/"
+
+	if err := channel.handle(context.Background(), []byte(testRequest)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got.Message != "what is the capital of France?" {
+		t.Errorf("agent got %q", got.Message)
+	}
+
+	body, header := onlyReply(t, server)
+	if !strings.Contains(body, "Paris is the capital of France.") {
+		t.Errorf("reply does not contain the answer:\n%s", body)
+	}
+	if strings.Contains(body, "Successfully routed") {
+		t.Errorf("reply is a routing acknowledgement:\n%s", body)
+	}
+	if header.Get("In-Reply-To") != "<q1@example.com>" {
+		t.Errorf("got In-Reply-To %q", header.Get("In-Reply-To"))
+	}
+	if header.Get("Subject") != "Re: Question" {
+		t.Errorf("got Subject %q", header.Get("Subject"))
+	}
+}
+
+func TestEmailChannelReportsAgentFailure(t *testing.T) {
+	channel, server := newTestEmailChannel(t, "gui")
+
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"error": "display not available"})
+	}))
+	defer agent.Close()
+	channel.agents.urls["gui"] = agent.URL
+
+	if err := channel.handle(context.Background(), []byte(testRequest)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, _ := onlyReply(t, server)
+	if !strings.Contains(body, "couldn't handle your request") || !strings.Contains(body, "display not available") {
+		t.Errorf("reply does not report the failure:\n%s", body)
+	}
+}
+
+func TestEmailChannelDeliversCoderResult(t *testing.T) {
+	channel, server := newTestEmailChannel(t, "coder")
+	channel.threads["msg_1"] = emailThread{
+		to:         "alice@example.com",
+		subject:    "Re: Add a flag",
+		messageID:  "<q2@example.com>",
+		references: []string{"<q1@example.com>"},
+	}
+
+	// Results of requests that didn't come by email are ignored
+	if err := channel.deliverResult(context.Background(), kafka.CoderResult{RequestID: "msg_0", Status: "committed"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("%d messages sent for an unknown request", n)
+	}
+
+	result := kafka.CoderResult{
+		RequestID: "msg_1",
+		Status:    "committed",
+		Summary:   "Added the --verbose flag.",
+		Branch:    "coder/msg_1",
+		Commit:    "abc123",
+		Tests:     "go: 3 passed, 0 failed, 0 skipped",
+		Diff:      "+verbose := flag.Bool(\"verbose\", false, \"\")\n",
+	}
+	if err := channel.deliverResult(context.Background(), result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, header := onlyReply(t, server)
+	for _, want := range []string{"committed the changes", "Added the --verbose flag.", "coder/msg_1", "abc123", "3 passed", "flag.Bool"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("reply does not contain %q:\n%s", want, body)
+		}
+	}
+	if header.Get("In-Reply-To") != "<q2@example.com>" {
+		t.Errorf("got In-Reply-To %q", header.Get("In-Reply-To"))
+	}
+	if header.Get("References") != "<q1@example.com> <q2@example.com>" {
+		t.Errorf("got References %q", header.Get("References"))
+	}
+
+	// A result is mailed once
+	if _, ok := channel.threads["msg_1"]; ok {
+		t.Error("thread still waiting after its result was delivered")
+	}
+}
+
+// onlyReply returns the plain-text body and header of the single message
+// server received
+func onlyReply(t *testing.T, server *smtpstub.Server) (string, mail.Header) {
+	t.Helper()
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	if want := []string{"alice@example.com"}; !reflect.DeepEqual(messages[0].To, want) {
+		t.Errorf("got recipients %v, want %v", messages[0].To, want)
+	}
+
+	msg, err := messages[0].Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plain string
+	if err := walkParts(msg.Header, msg.Body, func(contentType, disposition string, body []byte) {
+		if contentType == "text/plain" && plain == "" {
+			plain = string(body)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return plain, msg.Header
+}
+
+func TestAuthResultsPass(t *testing.T) {
+	const authserv = "mx.example.net"
+
+	tests := []struct {
+		name    string
+		from    string
+		headers []string
+		want    bool
+	}{
+		{
+			name:    "dkim pass for the from domain",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=example.com header.s=sel"},
+			want:    true,
+		},
+		{
+			name:    "authserv-id is case-insensitive and may carry a version",
+			from:    "alice@example.com",
+			headers: []string{"MX.Example.NET 1; DKIM=Pass header.d=Example.com"},
+			want:    true,
+		},
+		{
+			name:    "foreign authserv-id",
+			from:    "alice@example.com",
+			headers: []string{"mx.attacker.org; dkim=pass header.d=example.com"},
+		},
+		{
+			name:    "authserv-id only in a comment",
+			from:    "alice@example.com",
+			headers: []string{"(mx.example.net) mx.attacker.org; dkim=pass header.d=example.com"},
+		},
+		{
+			name:    "foreign header next to a failing one of ours",
+			from:    "alice@example.com",
+			headers: []string{"mx.attacker.org; dkim=pass header.d=example.com", "mx.example.net; dkim=fail header.d=example.com"},
+		},
+		{
+			name:    "dkim pass for a parent domain",
+			from:    "alice@mail.example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=example.com"},
+			want:    true,
+		},
+		{
+			name:    "dkim pass for a subdomain",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=mail.example.com"},
+		},
+		{
+			name:    "dkim pass for a bare TLD",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=com"},
+		},
+		{
+			name:    "dkim pass for a domain with the same suffix",
+			from:    "alice@myexample.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=example.com"},
+		},
+		{
+			name:    "dkim pass for another domain",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=attacker.org"},
+		},
+		{
+			name:    "dkim fail",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=fail header.d=example.com; spf=softfail smtp.mailfrom=alice@example.com"},
+		},
+		{
+			name:    "spf pass for the from domain",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=none; spf=pass smtp.mailfrom=bounces@example.com"},
+			want:    true,
+		},
+		{
+			name:    "spf pass for another mailfrom domain",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; spf=pass smtp.mailfrom=alice@attacker.org"},
+		},
+		{
+			name:    "spf pass for a helo identity only",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; spf=pass smtp.helo=example.com"},
+		},
+		{
+			name:    "comment hiding dkim=pass",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=fail (dkim=pass header.d=example.com) header.d=attacker.org"},
+		},
+		{
+			name:    "comment hiding a whole result",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=none (; dkim=pass header.d=example.com)"},
+		},
+		{
+			name:    "nested comment hiding a result",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=none (; dkim=pass header.d=example.com ( ) )"},
+		},
+		{
+			name:    "escaped parenthesis inside a comment",
+			from:    "alice@example.com",
+			headers: []string{`mx.example.net; dkim=none (\); dkim=pass header.d=example.com)`},
+		},
+		{
+			name:    "quoted string hiding a result",
+			from:    "alice@example.com",
+			headers: []string{`mx.example.net; spf=pass smtp.mailfrom="x;dkim=pass header.d=example.com"@attacker.org`},
+		},
+		{
+			name:    "quoted string repeating a property",
+			from:    "alice@example.com",
+			headers: []string{`mx.example.net; dkim=pass header.d=attacker.org header.i="x header.d=example.com"`},
+		},
+		{
+			name:    "later property can't override the first",
+			from:    "alice@example.com",
+			headers: []string{"mx.example.net; dkim=pass header.d=attacker.org header.d=example.com"},
+		},
+		{
+			name:    "no headers",
+			from:    "alice@example.com",
+			headers: nil,
+		},
+		{
+			name:    "from without a domain",
+			from:    "alice",
+			headers: []string{"mx.example.net; dkim=pass header.d=example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authResultsPass(tt.headers, authserv, tt.from); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlignedDomain(t *testing.T) {
+	tests := []struct {
+		authenticated string
+		from          string
+		want          bool
+	}{
+		{authenticated: "example.com", from: "example.com", want: true},
+		{authenticated: "example.com", from: "a.b.example.com", want: true},
+		{authenticated: "a.example.com", from: "example.com"},
+		{authenticated: "com", from: "example.com"},
+		{authenticated: "", from: "example.com"},
+		{authenticated: "le.com", from: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.authenticated+"/"+tt.from, func(t *testing.T) {
+			if got := alignedDomain(tt.authenticated, tt.from); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailChannelAuthenticate(t *testing.T) {
+	const token = "s3cret-token"
+
+	tests := []struct {
+		name        string
+		req         inboundRequest
+		authserv    string
+		want        bool
+		wantSubject string
+		wantText    string
+	}{
+		{
+			name:        "token in the subject is removed",
+			req:         inboundRequest{from: "alice@example.com", subject: "Deploy " + token, text: "please deploy"},
+			want:        true,
+			wantSubject: "Deploy",
+			wantText:    "please deploy",
+		},
+		{
+			name:        "token in the body is removed",
+			req:         inboundRequest{from: "Alice@Example.com", subject: "Deploy", text: token + "\nplease deploy " + token},
+			want:        true,
+			wantSubject: "Deploy",
+			wantText:    "please deploy",
+		},
+		{
+			name: "another user's token",
+			req:  inboundRequest{from: "bob@example.com", subject: "Deploy " + token, text: "please deploy"},
+		},
+		{
+			name: "wrong token",
+			req:  inboundRequest{from: "alice@example.com", subject: "Deploy s3cret-tokex", text: "please deploy"},
+		},
+		{
+			name: "no token",
+			req:  inboundRequest{from: "alice@example.com", subject: "Deploy", text: "please deploy"},
+		},
+		{
+			name:        "authentication results",
+			req:         inboundRequest{from: "alice@example.com", subject: "Deploy", text: "please deploy", authResults: []string{"mx.example.net; dkim=pass header.d=example.com"}},
+			authserv:    "mx.example.net",
+			want:        true,
+			wantSubject: "Deploy",
+			wantText:    "please deploy",
+		},
+		{
+			name: "authentication results without an authserv-id configured",
+			req:  inboundRequest{from: "alice@example.com", subject: "Deploy", text: "please deploy", authResults: []string{" ; dkim=pass header.d=example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := &EmailChannel{
+				tokens:   map[string]string{"alice@example.com": token},
+				authserv: tt.authserv,
+			}
+
+			req := tt.req
+			if got := channel.authenticate(&req); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if req.subject != tt.wantSubject || req.text != tt.wantText {
+				t.Errorf("got subject %q and text %q, want %q and %q", req.subject, req.text, tt.wantSubject, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestParseInbound(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		skip string
+		text string
+	}{
+		{
+			name: "plain text",
+			raw:  "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello Jarvis\r\n",
+			text: "Hello Jarvis",
+		},
+		{
+			name: "quoted reply and signature are dropped",
+			raw: "From: alice@example.com\r\nSubject: Re: Hi\r\n\r\n" +
+				"Thanks, now deploy it\r\n\r\n" +
+				"On Mon, 4 Mar 2024, Jarvis wrote:\r\n> Done. s3cret-token\r\n\r\n-- \r\nAlice\r\n",
+			text: "Thanks, now deploy it",
+		},
+		{
+			name: "quoted lines are dropped",
+			raw:  "From: alice@example.com\r\nSubject: Hi\r\n\r\n> s3cret-token\r\nHello\r\n",
+			text: "Hello",
+		},
+		{
+			name: "auto-submitted",
+			raw:  "From: alice@example.com\r\nAuto-Submitted: auto-replied\r\nSubject: Out of office\r\n\r\nAway\r\n",
+			skip: "auto-submitted",
+		},
+		{
+			name: "auto-submitted no",
+			raw:  "From: alice@example.com\r\nAuto-Submitted: no\r\nSubject: Hi\r\n\r\nHello\r\n",
+			text: "Hello",
+		},
+		{
+			name: "precedence bulk",
+			raw:  "From: alice@example.com\r\nPrecedence: bulk\r\nSubject: Newsletter\r\n\r\nNews\r\n",
+			skip: "bulk mail",
+		},
+		{
+			name: "precedence list",
+			raw:  "From: alice@example.com\r\nPrecedence: List\r\nSubject: Digest\r\n\r\nNews\r\n",
+			skip: "bulk mail",
+		},
+		{
+			name: "html only",
+			raw: "From: alice@example.com\r\nSubject: Hi\r\nContent-Type: text/html; charset=utf-8\r\n\r\n" +
+				"<p>Hello <b>Jarvis</b></p><p>Fish &amp; chips</p>",
+			text: "Hello Jarvis\nFish & chips",
+		},
+		{
+			name: "multipart with an html part only",
+			raw: "From: alice@example.com\r\nSubject: Hi\r\nMIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n" +
+				"<div>Deploy the <i>staging</i> build</div><div>s3cret-token</div>\r\n" +
+				"--b1--\r\n",
+			text: "Deploy the staging build\ns3cret-token",
+		},
+		{
+			name: "multipart prefers the plain part",
+			raw: "From: alice@example.com\r\nSubject: Hi\r\nMIME-Version: 1.0\r\n" +
+				"Content-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<p>html</p>\r\n" +
+				"--b1\r\nContent-Type: text/plain\r\n\r\nplain\r\n" +
+				"--b1--\r\n",
+			text: "plain",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, skip, err := parseInbound([]byte(tt.raw))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if skip != tt.skip {
+				t.Fatalf("got skip %q, want %q", skip, tt.skip)
+			}
+			if skip != "" {
+				return
+			}
+			if req.text != tt.text {
+				t.Errorf("got text %q, want %q", req.text, tt.text)
+			}
+		})
+	}
+}
+
+func TestParseInboundHeaders(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"Subject: =?utf-8?q?Caf=C3=A9?=\r\n" +
+		"Message-ID: <q3@example.com>\r\n" +
+		"References: <q1@example.com>\r\n <q2@example.com>\r\n" +
+		"Authentication-Results: mx.example.net; dkim=pass header.d=example.com\r\n" +
+		"Authentication-Results: mx.attacker.org; spf=pass smtp.mailfrom=alice@example.com\r\n" +
+		"\r\nHello\r\n"
+
+	req, _, err := parseInbound([]byte(raw))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := inboundRequest{
+		from:       "alice@example.com",
+		messageID:  "<q3@example.com>",
+		references: []string{"<q1@example.com>", "<q2@example.com>"},
+		subject:    "Café",
+		text:       "Hello",
+		authResults: []string{
+			"mx.example.net; dkim=pass header.d=example.com",
+			"mx.attacker.org; spf=pass smtp.mailfrom=alice@example.com",
+		},
+	}
+	if !reflect.DeepEqual(*req, want) {
+		t.Errorf("got %+v\nwant %+v", *req, want)
+	}
+
+	if _, _, err := parseInbound([]byte("Subject: no sender\r\n\r\nHello\r\n")); err == nil {
+		t.Error("expected an error for a message without From")
+	}
+}
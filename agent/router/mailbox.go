@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// inboundMail is a raw message waiting in a mailbox
+type inboundMail struct {
+	id  string
+	raw []byte
+}
+
+// mailbox is where the email channel picks up new messages
+type mailbox interface {
+	// fetch returns the messages not yet marked done
+	fetch(ctx context.Context) ([]inboundMail, error)
+	// markDone marks a message as handled so it isn't fetched again
+	markDone(ctx context.Context, id string) error
+}
+
+// maildirMailbox reads a local Maildir: new messages are in new/ and move
+// to cur/ with the Seen flag once handled
+type maildirMailbox struct {
+	dir string
+}
+
+func newMaildirMailbox(dir string) (*maildirMailbox, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("MAILDIR_PATH is not set")
+	}
+	for _, sub := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create maildir: %v", err)
+		}
+	}
+	return &maildirMailbox{dir: dir}, nil
+}
+
+func (m *maildirMailbox) fetch(ctx context.Context) ([]inboundMail, error) {
+	entries, err := os.ReadDir(filepath.Join(m.dir, "new"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maildir: %v", err)
+	}
+
+	var mails []inboundMail
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(m.dir, "new", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", entry.Name(), err)
+		}
+		mails = append(mails, inboundMail{id: entry.Name(), raw: raw})
+	}
+	return mails, nil
+}
+
+func (m *maildirMailbox) markDone(ctx context.Context, id string) error {
+	name := filepath.Base(id)
+	if i := strings.Index(name, ":2,"); i >= 0 {
+		name = name[:i]
+	}
+	return os.Rename(filepath.Join(m.dir, "new", filepath.Base(id)), filepath.Join(m.dir, "cur", name+":2,S"))
+}
+
+// imapMailbox polls a mailbox over IMAP. Unseen messages are fetched
+// without setting \Seen, which is only added once a message is handled.
+type imapMailbox struct {
+	addr     string
+	host     string
+	tlsMode  string
+	username string
+	password string
+	folder   string
+}
+
+func newIMAPMailbox() (*imapMailbox, error) {
+	box := &imapMailbox{
+		host:     os.Getenv("IMAP_HOST"),
+		tlsMode:  strings.ToLower(getEnvOrDefault("IMAP_TLS", "tls")),
+		username: os.Getenv("IMAP_USERNAME"),
+		password: os.Getenv("IMAP_PASSWORD"),
+		folder:   getEnvOrDefault("IMAP_MAILBOX", "INBOX"),
+	}
+	if box.host == "" || box.username == "" {
+		return nil, fmt.Errorf("IMAP_HOST and IMAP_USERNAME are required")
+	}
+
+	port := os.Getenv("IMAP_PORT")
+	if port == "" {
+		port = "993"
+		if box.tlsMode != "tls" {
+			port = "143"
+		}
+	}
+	box.addr = net.JoinHostPort(box.host, port)
+
+	return box, nil
+}
+
+// connect opens and logs in a new session; sessions are short-lived, one
+// per poll, so a dropped connection never wedges the channel
+func (m *imapMailbox) connect() (*client.Client, error) {
+	tlsConfig := &tls.Config{ServerName: m.host}
+
+	var c *client.Client
+	var err error
+	if m.tlsMode == "tls" {
+		c, err = client.DialTLS(m.addr, tlsConfig)
+	} else {
+		c, err = client.Dial(m.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", m.addr, err)
+	}
+
+	if m.tlsMode == "starttls" {
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Logout()
+			return nil, fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	}
+
+	if err := c.Login(m.username, m.password); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("IMAP login failed: %v", err)
+	}
+
+	if _, err := c.Select(m.folder, false); err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("failed to select %s: %v", m.folder, err)
+	}
+
+	return c, nil
+}
+
+func (m *imapMailbox) fetch(ctx context.Context) ([]inboundMail, error) {
+	c, err := m.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Logout()
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag, imap.DeletedFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return nil, fmt.Errorf("IMAP search failed: %v", err)
+	}
+	if len(uids) == 0 {
+		return nil, nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+
+	messages := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+
+	var mails []inboundMail
+	for msg := range messages {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		var raw bytes.Buffer
+		if _, err := io.Copy(&raw, body); err != nil {
+			continue
+		}
+		mails = append(mails, inboundMail{id: strconv.FormatUint(uint64(msg.Uid), 10), raw: raw.Bytes()})
+	}
+	if err := <-done; err != nil {
+		return nil, fmt.Errorf("IMAP fetch failed: %v", err)
+	}
+
+	// Handle in arrival order
+	sort.Slice(mails, func(i, j int) bool {
+		a, _ := strconv.Atoi(mails[i].id)
+		b, _ := strconv.Atoi(mails[j].id)
+		return a < b
+	})
+
+	return mails, nil
+}
+
+func (m *imapMailbox) markDone(ctx context.Context, id string) error {
+	uid, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid UID %q", id)
+	}
+
+	c, err := m.connect()
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uint32(uid))
+	item := imap.FormatFlagsOp(imap.AddFlags, true)
+	if err := c.UidStore(seqset, item, []interface{}{imap.SeenFlag}, nil); err != nil {
+		return fmt.Errorf("failed to mark message %s as seen: %v", id, err)
+	}
+	return nil
+}
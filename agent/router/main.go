@@ -50,7 +50,7 @@ func (s *RouterServer) handleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
 	defer cancel()
 
 	response, err := s.routerService.ProcessMessage(ctx, req.Message, req.ImageData)
@@ -84,7 +84,7 @@ func (s *RouterServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 	// Try a quick test to see if the LLM is responsive
 	// We can check this by testing if Ollama is accessible
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	// Simple check - if we can't process messages, we're not healthy
@@ -118,6 +118,15 @@ func main() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
+	// Serve requests arriving by email if configured
+	emailChannel, err := NewEmailChannelFromEnv(server.routerService)
+	if err != nil {
+		log.Fatalf("Failed to create email channel: %v", err)
+	}
+	if emailChannel != nil {
+		go emailChannel.Run(context.Background())
+	}
+
 	r.Post("/message", server.handleMessage)
 	r.Get("/health", server.handleHealth)
 
@@ -178,6 +178,41 @@ func pullModel(modelName string) error {
 }
 
 func (rs *RouterService) ProcessMessage(ctx context.Context, userMessage string, imageData string) (string, error) {
+	return rs.ProcessMessageForUser(ctx, os.Getenv("USER_ID"), userMessage, imageData)
+}
+
+// ProcessMessageForUser routes a message on behalf of userID, for channels
+// that serve more than the service's own user. The request is handed to the
+// chosen agent over Kafka; the returned text only confirms that.
+func (rs *RouterService) ProcessMessageForUser(ctx context.Context, userID string, userMessage string, imageData string) (string, error) {
+	c, err := rs.Route(ctx, userMessage, imageData)
+	if err != nil {
+		return "", err
+	}
+	if c == nil {
+		return "Unable to process request after retries", nil
+	}
+
+	id, err := rs.Dispatch(ctx, c, userID, imageData)
+	if err != nil {
+		return "", err
+	}
+
+	switch c.Tool {
+	case "coder":
+		return fmt.Sprintf("Successfully routed coding request to coder agent (Message ID: %s)", id), nil
+	case "general":
+		return fmt.Sprintf("Successfully routed general request to general agent (Message ID: %s)", id), nil
+	case "visual_analyser":
+		return fmt.Sprintf("Successfully routed image analysis request to visual analyser (Message ID: %s, Image size: %d bytes)", id, len(imageData)), nil
+	default:
+		return fmt.Sprintf("Successfully routed GUI automation request to GUI agent (Message ID: %s)", id), nil
+	}
+}
+
+// Route asks the model which agent should handle a message. It returns nil
+// if the model gave no usable answer after a few tries.
+func (rs *RouterService) Route(ctx context.Context, userMessage string, imageData string) (*Call, error) {
 	var msgs []llms.MessageContent
 
 	// system message defines the available tools.
@@ -185,9 +220,13 @@ func (rs *RouterService) ProcessMessage(ctx context.Context, userMessage string,
 	msgs = append(msgs, llms.TextParts(llms.ChatMessageTypeHuman, userMessage))
 
 	for retries := 3; retries > 0; retries = retries - 1 {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("routing cancelled: %v", err)
+		}
+
 		resp, err := rs.llm.GenerateContent(ctx, msgs)
 		if err != nil {
-			return "", fmt.Errorf("failed to generate content: %v", err)
+			return nil, fmt.Errorf("failed to generate content: %v", err)
 		}
 
 		choice1 := resp.Choices[0]
@@ -198,11 +237,11 @@ func (rs *RouterService) ProcessMessage(ctx context.Context, userMessage string,
 			if *flagVerbose {
 				log.Printf("Call: %v (raw: %v)", c.Tool, choice1.Content)
 			}
-			msg, cont, result := rs.dispatchCall(c, imageData)
-			if !cont {
-				return result, nil
+			if retry := checkCall(c, imageData); retry != "" {
+				msgs = append(msgs, llms.TextParts(llms.ChatMessageTypeHuman, retry))
+				continue
 			}
-			msgs = append(msgs, msg)
+			return c, nil
 		} else {
 			// Ollama doesn't always respond with a function call, let it try again.
 			log.Printf("Not a call: %v", choice1.Content)
@@ -210,7 +249,7 @@ func (rs *RouterService) ProcessMessage(ctx context.Context, userMessage string,
 		}
 	}
 
-	return "Unable to process request after retries", nil
+	return nil, nil
 }
 
 type Call struct {
@@ -218,6 +257,12 @@ type Call struct {
 	Input map[string]any `json:"tool_input"`
 }
 
+// Demand is the request the model passes on to the agent
+func (c *Call) Demand() string {
+	demand, _ := c.Input["demand"].(string)
+	return demand
+}
+
 func unmarshalCall(input string) *Call {
 	var c Call
 	if err := json.Unmarshal([]byte(input), &c); err == nil && c.Tool != "" {
@@ -226,144 +271,74 @@ func unmarshalCall(input string) *Call {
 	return nil
 }
 
-func (rs *RouterService) dispatchCall(c *Call, imageData string) (llms.MessageContent, bool, string) {
+// checkCall returns what to tell the model when its call can't be
+// dispatched, or "" if it can
+func checkCall(c *Call, imageData string) string {
 	// ollama doesn't always respond with a *valid* function call. As we're using prompt
 	// engineering to inject the tools, it may hallucinate.
 	if !validTool(c.Tool) {
 		log.Printf("invalid function call: %#v, prompting model to try again", c)
-		return llms.TextParts(llms.ChatMessageTypeHuman,
-			"Tool does not exist, please try again."), true, ""
+		return "Tool does not exist, please try again."
 	}
 
-	// we could make this more dynamic, by parsing the function schema.
-	switch c.Tool {
-	case "coder":
-		demand, ok := c.Input["demand"].(string)
-		if !ok {
-			log.Printf("invalid input for coder: %v", c.Input)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Invalid input format"), true, ""
-		}
+	if _, ok := c.Input["demand"].(string); !ok {
+		log.Printf("invalid input for %s: %v", c.Tool, c.Input)
+		return "Invalid input format"
+	}
 
-		log.Printf("Routing to coder agent: %s", demand)
+	// Validate image data for visual analyser
+	if c.Tool == "visual_analyser" && imageData == "" {
+		log.Printf("No image data provided for visual analyser")
+		return "Image data is required for visual analysis"
+	}
 
-		// Send message to coder agent via Kafka
-		message := kafka.AgentMessage{
-			ID:        fmt.Sprintf("msg_%d", time.Now().Unix()),
-			UserID:    os.Getenv("USER_ID"),
-			Demand:    demand,
-			Timestamp: time.Now().Unix(),
-		}
+	return ""
+}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+// Dispatch sends a routed call to its agent over Kafka and returns the
+// message ID, which the agent's results refer to
+func (rs *RouterService) Dispatch(ctx context.Context, c *Call, userID string, imageData string) (string, error) {
+	message := kafka.AgentMessage{
+		// Nanoseconds, so requests arriving in the same second get
+		// different IDs and their results can't be mixed up
+		ID:        fmt.Sprintf("msg_%d", time.Now().UnixNano()),
+		UserID:    userID,
+		Demand:    c.Demand(),
+		Timestamp: time.Now().Unix(),
+	}
 
-		err := kafka.SendToCoderAgent(ctx, message)
-		if err != nil {
-			log.Printf("Failed to send message to coder agent: %v", err)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Failed to route to coder agent"), true, ""
-		}
+	sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
 
-		response := fmt.Sprintf("Successfully routed coding request to coder agent (Message ID: %s)", message.ID)
-		return llms.MessageContent{}, false, response
+	// we could make this more dynamic, by parsing the function schema.
+	var err error
+	switch c.Tool {
+	case "coder":
+		log.Printf("Routing to coder agent: %s", message.Demand)
+		err = kafka.SendToCoderAgent(sendCtx, message)
 
 	case "general":
-		demand, ok := c.Input["demand"].(string)
-		if !ok {
-			log.Printf("invalid input for general: %v", c.Input)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Invalid input format"), true, ""
-		}
-
-		log.Printf("Routing to general agent: %s", demand)
-
-		// Send message to general agent via Kafka
-		message := kafka.AgentMessage{
-			ID:        fmt.Sprintf("msg_%d", time.Now().Unix()),
-			UserID:    os.Getenv("USER_ID"),
-			Demand:    demand,
-			Timestamp: time.Now().Unix(),
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		err := kafka.SendToGeneralAgent(ctx, message)
-		if err != nil {
-			log.Printf("Failed to send message to general agent: %v", err)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Failed to route to general agent"), true, ""
-		}
-
-		response := fmt.Sprintf("Successfully routed general request to general agent (Message ID: %s)", message.ID)
-		return llms.MessageContent{}, false, response
+		log.Printf("Routing to general agent: %s", message.Demand)
+		err = kafka.SendToGeneralAgent(sendCtx, message)
 
 	case "visual_analyser":
-		demand, ok := c.Input["demand"].(string)
-		if !ok {
-			log.Printf("invalid input for visual_analyser: %v", c.Input)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Invalid input format"), true, ""
-		}
-
-		// Validate image data for visual analyser
-		if imageData == "" {
-			log.Printf("No image data provided for visual analyser")
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Image data is required for visual analysis"), true, ""
-		}
-
-		log.Printf("Routing to visual analyser: %s (image size: %d bytes)", demand, len(imageData))
-
-		// Send message to visual analyser via Kafka with image data
-		message := kafka.AgentMessage{
-			ID:        fmt.Sprintf("msg_%d", time.Now().Unix()),
-			UserID:    os.Getenv("USER_ID"),
-			Demand:    demand,
-			ImageData: imageData,
-			Timestamp: time.Now().Unix(),
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		err := kafka.SendToVisualAnalyser(ctx, message)
-		if err != nil {
-			log.Printf("Failed to send message to visual analyser: %v", err)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Failed to route to visual analyser"), true, ""
-		}
-
-		response := fmt.Sprintf("Successfully routed image analysis request to visual analyser (Message ID: %s, Image size: %d bytes)", message.ID, len(imageData))
-		return llms.MessageContent{}, false, response
+		log.Printf("Routing to visual analyser: %s (image size: %d bytes)", message.Demand, len(imageData))
+		message.ImageData = imageData
+		err = kafka.SendToVisualAnalyser(sendCtx, message)
 
 	case "gui":
-		demand, ok := c.Input["demand"].(string)
-		if !ok {
-			log.Printf("invalid input for gui: %v", c.Input)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Invalid input format"), true, ""
-		}
-
-		log.Printf("Routing to GUI agent: %s", demand)
-
-		// Send message to GUI agent via Kafka
-		message := kafka.AgentMessage{
-			ID:        fmt.Sprintf("msg_%d", time.Now().Unix()),
-			UserID:    os.Getenv("USER_ID"),
-			Demand:    demand,
-			Timestamp: time.Now().Unix(),
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		err := kafka.SendToGUIAgent(ctx, message)
-		if err != nil {
-			log.Printf("Failed to send message to GUI agent: %v", err)
-			return llms.TextParts(llms.ChatMessageTypeHuman, "Failed to route to GUI agent"), true, ""
-		}
-
-		response := fmt.Sprintf("Successfully routed GUI automation request to GUI agent (Message ID: %s)", message.ID)
-		return llms.MessageContent{}, false, response
+		log.Printf("Routing to GUI agent: %s", message.Demand)
+		err = kafka.SendToGUIAgent(sendCtx, message)
 
 	default:
-		// we already checked above if we had a valid tool.
-		panic("unreachable")
+		return "", fmt.Errorf("unknown agent %q", c.Tool)
+	}
+	if err != nil {
+		log.Printf("Failed to send message to %s agent: %v", c.Tool, err)
+		return "", fmt.Errorf("failed to route to %s agent: %v", c.Tool, err)
 	}
+
+	return message.ID, nil
 }
 
 func validTool(name string) bool {
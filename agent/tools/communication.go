@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os/exec"
 	"strings"
 	"time"
 
@@ -18,35 +17,41 @@ func (t CommitToGitTool) Name() string {
 }
 
 func (t CommitToGitTool) Description() string {
-	return "Commit changes to git repository. Input should be JSON with 'message', optional 'files' array, and optional 'add_all' boolean."
+	return "Commit changes to git repository. Input should be JSON with 'working_dir', 'message', optional 'files' array, and optional 'add_all' boolean."
 }
 
 func (t CommitToGitTool) Call(ctx context.Context, input string) (string, error) {
 	var args struct {
-		Message string   `json:"message"`
-		Files   []string `json:"files"`
-		AddAll  bool     `json:"add_all"`
+		WorkingDir string   `json:"working_dir"`
+		Message    string   `json:"message"`
+		Files      []string `json:"files"`
+		AddAll     bool     `json:"add_all"`
 	}
 
 	if err := json.Unmarshal([]byte(input), &args); err != nil {
 		return "", fmt.Errorf("invalid input JSON: %v", err)
 	}
 
-	return commitToGit(args.Message, args.Files, args.AddAll)
+	return commitToGit(ctx, args.WorkingDir, args.Message, args.Files, args.AddAll)
 }
 
-type CreatePullRequestTool struct{}
+// CreatePullRequestTool opens pull requests through a Forge. A nil Forge
+// is chosen from the environment and the repository's origin remote.
+type CreatePullRequestTool struct {
+	Forge Forge
+}
 
 func (t CreatePullRequestTool) Name() string {
 	return "create_pull_request"
 }
 
 func (t CreatePullRequestTool) Description() string {
-	return "Create a pull request on GitHub/GitLab. Input should be JSON with 'title', 'body', optional 'base_branch', optional 'head_branch', and optional 'repository' fields."
+	return "Create a pull request on GitHub or a merge request on GitLab. Input should be JSON with 'working_dir', 'title', 'body', optional 'base_branch' (default main), optional 'head_branch' (default current branch), and optional 'repository' (owner/repo; default from the origin remote) fields."
 }
 
 func (t CreatePullRequestTool) Call(ctx context.Context, input string) (string, error) {
 	var args struct {
+		WorkingDir string `json:"working_dir"`
 		Title      string `json:"title"`
 		Body       string `json:"body"`
 		BaseBranch string `json:"base_branch"`
@@ -62,21 +67,114 @@ func (t CreatePullRequestTool) Call(ctx context.Context, input string) (string,
 		args.BaseBranch = "main"
 	}
 
-	return createPullRequest(args.Title, args.Body, args.BaseBranch, args.HeadBranch, args.Repository)
+	return createPullRequest(ctx, t.Forge, args.WorkingDir, args.Title, args.Body, args.BaseBranch, args.HeadBranch, args.Repository)
+}
+
+// ListPullRequestsTool lists pull requests through a Forge
+type ListPullRequestsTool struct {
+	Forge Forge
+}
+
+func (t ListPullRequestsTool) Name() string {
+	return "list_pull_requests"
+}
+
+func (t ListPullRequestsTool) Description() string {
+	return "List pull requests of a repository. Input should be JSON with 'working_dir', optional 'state' (open, closed or all; default open) and optional 'repository' fields."
 }
 
-type CommentDiffTool struct{}
+func (t ListPullRequestsTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string `json:"working_dir"`
+		State      string `json:"state"`
+		Repository string `json:"repository"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	forge, repo, err := resolveForge(ctx, t.Forge, args.WorkingDir, args.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	pulls, err := forge.ListPullRequests(ctx, repo, args.State)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pulls) == 0 {
+		return fmt.Sprintf("No pull requests in %s", repo), nil
+	}
+
+	var b strings.Builder
+	for _, pr := range pulls {
+		fmt.Fprintf(&b, "#%d [%s] %s (%s -> %s) %s\n", pr.Number, pr.State, pr.Title, pr.Head, pr.Base, pr.URL)
+	}
+	return b.String(), nil
+}
+
+// GetPullRequestDiffTool fetches the diff of a pull request through a Forge
+type GetPullRequestDiffTool struct {
+	Forge Forge
+}
+
+func (t GetPullRequestDiffTool) Name() string {
+	return "get_pull_request_diff"
+}
+
+func (t GetPullRequestDiffTool) Description() string {
+	return "Fetch the unified diff of a pull request. Input should be JSON with 'working_dir', 'pr_number' and optional 'repository' fields."
+}
+
+func (t GetPullRequestDiffTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string `json:"working_dir"`
+		PRNumber   int    `json:"pr_number"`
+		Repository string `json:"repository"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if args.PRNumber <= 0 {
+		return "", fmt.Errorf("pr_number is required")
+	}
+
+	forge, repo, err := resolveForge(ctx, t.Forge, args.WorkingDir, args.Repository)
+	if err != nil {
+		return "", err
+	}
+
+	diff, err := forge.GetPullRequestDiff(ctx, repo, args.PRNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if diff == "" {
+		return fmt.Sprintf("Pull request #%d has no changes", args.PRNumber), nil
+	}
+	return diff, nil
+}
+
+// CommentDiffTool comments on pull requests through a Forge
+type CommentDiffTool struct {
+	Forge Forge
+}
 
 func (t CommentDiffTool) Name() string {
 	return "comment_diff"
 }
 
 func (t CommentDiffTool) Description() string {
-	return "Add comments to a diff or pull request. Input should be JSON with 'comment', optional 'file_path', optional 'line_number', optional 'pr_number', and optional 'repository' fields."
+	return "Comment on a pull request. With 'file_path' and 'line_number' the comment is attached inline to that line of the new version; otherwise it is a general comment. Input should be JSON with 'working_dir', 'pr_number', 'comment', optional 'file_path', optional 'line_number', and optional 'repository' fields."
 }
 
 func (t CommentDiffTool) Call(ctx context.Context, input string) (string, error) {
 	var args struct {
+		WorkingDir string `json:"working_dir"`
 		Comment    string `json:"comment"`
 		FilePath   string `json:"file_path"`
 		LineNumber int    `json:"line_number"`
@@ -88,139 +186,146 @@ func (t CommentDiffTool) Call(ctx context.Context, input string) (string, error)
 		return "", fmt.Errorf("invalid input JSON: %v", err)
 	}
 
-	return commentDiff(args.Comment, args.FilePath, args.LineNumber, args.PRNumber, args.Repository)
+	return commentDiff(ctx, t.Forge, args.WorkingDir, args.Comment, args.FilePath, args.LineNumber, args.PRNumber, args.Repository)
 }
 
-func commitToGit(message string, files []string, addAll bool) (string, error) {
+func commitToGit(ctx context.Context, workingDir, message string, files []string, addAll bool) (string, error) {
 	var output strings.Builder
 
 	if addAll {
-		cmd := exec.Command("git", "add", ".")
-		out, err := cmd.CombinedOutput()
+		files = []string{"."}
+	}
+
+	if len(files) > 0 {
+		result, err := runGit(ctx, workingDir, append([]string{"add", "--"}, files...)...)
 		if err != nil {
-			return "", fmt.Errorf("failed to add files: %v", err)
+			return "", err
 		}
-		output.WriteString("Added all files\n")
-		output.WriteString(string(out))
-	} else if len(files) > 0 {
-		args := []string{"add"}
-		args = append(args, files...)
-		cmd := exec.Command("git", args...)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			return "", fmt.Errorf("failed to add specified files: %v", err)
+		if !result.Success() {
+			return "Failed to add files\n" + result.Render(), nil
+		}
+		if addAll {
+			output.WriteString("Added all files\n")
+		} else {
+			output.WriteString("Added specified files\n")
 		}
-		output.WriteString("Added specified files\n")
-		output.WriteString(string(out))
 	}
 
-	cmd := exec.Command("git", "commit", "-m", message)
-	out, err := cmd.CombinedOutput()
+	result, err := runGit(ctx, workingDir, "commit", "-m", message)
 	if err != nil {
-		return output.String(), fmt.Errorf("failed to commit: %v", err)
+		return "", err
 	}
-
-	output.WriteString("Committed successfully\n")
-	output.WriteString(string(out))
+	if !result.Success() {
+		output.WriteString("Commit failed\n")
+	} else {
+		output.WriteString("Committed successfully\n")
+	}
+	output.WriteString(result.Render())
 	return output.String(), nil
 }
 
-func createPullRequest(title, body, baseBranch, headBranch, repository string) (string, error) {
-	if headBranch == "" {
-		cmd := exec.Command("git", "branch", "--show-current")
-		out, err := cmd.Output()
-		if err != nil {
-			return "", fmt.Errorf("failed to get current branch: %v", err)
-		}
-		headBranch = strings.TrimSpace(string(out))
-	}
-
-	var cmd *exec.Cmd
-	if repository != "" {
-		cmd = exec.Command("gh", "pr", "create",
-			"--title", title,
-			"--body", body,
-			"--base", baseBranch,
-			"--head", headBranch,
-			"--repo", repository)
-	} else {
-		cmd = exec.Command("gh", "pr", "create",
-			"--title", title,
-			"--body", body,
-			"--base", baseBranch,
-			"--head", headBranch)
+// resolveForge returns the forge and repository path to use. An injected
+// forge is used as is; otherwise one is chosen from the environment.
+func resolveForge(ctx context.Context, forge Forge, workingDir, repository string) (Forge, string, error) {
+	if forge == nil {
+		return forgeForRepo(ctx, workingDir, repository)
 	}
 
-	done := make(chan error, 1)
-	var output []byte
-
-	go func() {
-		var err error
-		output, err = cmd.CombinedOutput()
-		done <- err
-	}()
-
-	select {
-	case err := <-done:
+	if repository == "" {
+		remote, err := originURL(ctx, workingDir)
 		if err != nil {
-			return string(output), fmt.Errorf("failed to create pull request: %v", err)
+			return nil, "", err
 		}
-		return string(output), nil
-	case <-time.After(30 * time.Second):
-		if cmd.Process != nil {
-			cmd.Process.Kill()
+		if _, repository, err = parseRemoteURL(remote); err != nil {
+			return nil, "", err
 		}
-		return "", fmt.Errorf("pull request creation timed out")
 	}
+
+	return forge, repository, nil
 }
 
-func commentDiff(comment, filePath string, lineNumber, prNumber int, repository string) (string, error) {
-	if prNumber > 0 {
-		var cmd *exec.Cmd
-		if repository != "" {
-			cmd = exec.Command("gh", "pr", "comment", fmt.Sprintf("%d", prNumber),
-				"--body", comment,
-				"--repo", repository)
-		} else {
-			cmd = exec.Command("gh", "pr", "comment", fmt.Sprintf("%d", prNumber),
-				"--body", comment)
-		}
+func createPullRequest(ctx context.Context, forge Forge, workingDir, title, body, baseBranch, headBranch, repository string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
 
-		output, err := cmd.CombinedOutput()
+	if title == "" {
+		return "", fmt.Errorf("title is required")
+	}
+
+	if headBranch == "" {
+		branch, err := currentBranch(ctx, workingDir)
 		if err != nil {
-			return string(output), fmt.Errorf("failed to comment on pull request: %v", err)
+			return "", err
 		}
-		return string(output), nil
+		headBranch = branch
 	}
 
-	statusCmd := exec.Command("git", "status", "--porcelain")
-	statusOut, err := statusCmd.Output()
+	forge, repo, err := resolveForge(ctx, forge, workingDir, repository)
 	if err != nil {
-		return "", fmt.Errorf("failed to check git status: %v", err)
+		return "", err
 	}
 
-	if len(statusOut) == 0 {
-		return "No changes to comment on", nil
+	pr, err := forge.CreatePullRequest(ctx, repo, NewPullRequest{
+		Title: title,
+		Body:  body,
+		Base:  baseBranch,
+		Head:  headBranch,
+	})
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("pull request creation timed out")
+	}
+	if err != nil {
+		return "", err
 	}
 
-	diffCmd := exec.Command("git", "diff", "--cached")
-	if filePath != "" {
-		diffCmd = exec.Command("git", "diff", "--cached", filePath)
+	return fmt.Sprintf("Created pull request #%d on %s (%s -> %s): %s", pr.Number, forge.Name(), pr.Head, pr.Base, pr.URL), nil
+}
+
+func commentDiff(ctx context.Context, forge Forge, workingDir, comment, filePath string, lineNumber, prNumber int, repository string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if prNumber <= 0 {
+		return "", fmt.Errorf("pr_number is required; use git_diff to inspect local changes")
+	}
+	if comment == "" {
+		return "", fmt.Errorf("comment is required")
+	}
+	if (filePath == "") != (lineNumber <= 0) {
+		return "", fmt.Errorf("inline comments need both file_path and line_number")
 	}
 
-	diffOut, err := diffCmd.Output()
+	forge, repo, err := resolveForge(ctx, forge, workingDir, repository)
 	if err != nil {
-		return "", fmt.Errorf("failed to get diff: %v", err)
+		return "", err
 	}
 
-	result := fmt.Sprintf("Comment: %s\n\nDiff:\n%s", comment, string(diffOut))
-	return result, nil
+	if filePath == "" {
+		if err := forge.Comment(ctx, repo, prNumber, comment); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Commented on %s#%d", repo, prNumber), nil
+	}
+
+	err = forge.ReviewComment(ctx, repo, prNumber, ReviewComment{Path: filePath, Line: lineNumber, Body: comment})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Added review comment on %s:%d of %s#%d", filePath, lineNumber, repo, prNumber), nil
 }
 
 func GetCommunicationTools() []tools.Tool {
 	return []tools.Tool{
 		CommitToGitTool{},
 		CreatePullRequestTool{},
+		ListPullRequestsTool{},
+		GetPullRequestDiffTool{},
 		CommentDiffTool{},
+		GitStatusTool{},
+		GitDiffTool{},
+		GitLogTool{},
+		GitBranchTool{},
+		GitStashTool{},
+		GitCloneTool{},
 	}
 }
@@ -0,0 +1,110 @@
+package jarvisTools
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// diffFile is one file's section of a unified diff
+type diffFile struct {
+	Path  string
+	Hunks []diffHunk
+}
+
+// diffHunk is a single @@ hunk
+type diffHunk struct {
+	Header string
+	Lines  []diffLine
+}
+
+// diffLine is a line of a hunk. Kind is '+', '-' or ' '; NewLine is the
+// line number in the new version and 0 for removed lines.
+type diffLine struct {
+	Kind    byte
+	Text    string
+	NewLine int
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseUnifiedDiff splits a unified diff (as produced by git diff) into files
+// and hunks. Deleted files are skipped since nothing in them can be commented on.
+func parseUnifiedDiff(diff string) []diffFile {
+	var files []diffFile
+	var file *diffFile
+	var hunk *diffHunk
+
+	line, oldLeft, newLeft := 0, 0, 0
+	for _, text := range strings.Split(diff, "\n") {
+		// Inside a hunk every line is content, even one that looks like a header
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(text, "-"):
+				hunk.Lines = append(hunk.Lines, diffLine{Kind: '-', Text: text[1:]})
+				oldLeft--
+			case strings.HasPrefix(text, "+"):
+				hunk.Lines = append(hunk.Lines, diffLine{Kind: '+', Text: text[1:], NewLine: line})
+				line++
+				newLeft--
+			case strings.HasPrefix(text, "\\"):
+				// "\ No newline at end of file"
+			default:
+				hunk.Lines = append(hunk.Lines, diffLine{Kind: ' ', Text: strings.TrimPrefix(text, " "), NewLine: line})
+				line++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			path := strings.TrimPrefix(text, "+++ ")
+			if path == "/dev/null" {
+				file = nil
+				continue
+			}
+			files = append(files, diffFile{Path: strings.TrimPrefix(path, "b/")})
+			file = &files[len(files)-1]
+		case file != nil && hunkHeader.MatchString(text):
+			m := hunkHeader.FindStringSubmatch(text)
+			line, _ = strconv.Atoi(m[2])
+			oldLeft, newLeft = hunkCount(m[1]), hunkCount(m[3])
+			file.Hunks = append(file.Hunks, diffHunk{Header: text})
+			hunk = &file.Hunks[len(file.Hunks)-1]
+		}
+	}
+
+	return files
+}
+
+// hunkCount parses a hunk range length, which defaults to 1 when omitted
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffNewLines returns, per file, the lines of the new version that appear
+// in a unified diff, i.e. the lines an inline comment may target
+func diffNewLines(diff string) map[string]map[int]bool {
+	lines := make(map[string]map[int]bool)
+
+	for _, file := range parseUnifiedDiff(diff) {
+		if lines[file.Path] == nil {
+			lines[file.Path] = make(map[int]bool)
+		}
+		for _, hunk := range file.Hunks {
+			for _, l := range hunk.Lines {
+				if l.NewLine > 0 {
+					lines[file.Path][l.NewLine] = true
+				}
+			}
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,145 @@
+package jarvisTools
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []diffFile
+	}{
+		{
+			name: "empty",
+			diff: "",
+			want: nil,
+		},
+		{
+			name: "added and removed lines",
+			diff: `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,4 +10,4 @@ func main() {
+ 	a := 1
+-	b := 2
++	b := 3
+ 	fmt.Println(a, b)
+ }
+`,
+			want: []diffFile{{Path: "main.go", Hunks: []diffHunk{{
+				Header: "@@ -10,4 +10,4 @@ func main() {",
+				Lines: []diffLine{
+					{Kind: ' ', Text: "\ta := 1", NewLine: 10},
+					{Kind: '-', Text: "\tb := 2"},
+					{Kind: '+', Text: "\tb := 3", NewLine: 11},
+					{Kind: ' ', Text: "\tfmt.Println(a, b)", NewLine: 12},
+					{Kind: ' ', Text: "}", NewLine: 13},
+				},
+			}}}},
+		},
+		{
+			name: "new file with omitted counts",
+			diff: `diff --git a/README b/README
+new file mode 100644
+--- /dev/null
++++ b/README
+@@ -0,0 +1 @@
++hello
+\ No newline at end of file
+`,
+			want: []diffFile{{Path: "README", Hunks: []diffHunk{{
+				Header: "@@ -0,0 +1 @@",
+				Lines:  []diffLine{{Kind: '+', Text: "hello", NewLine: 1}},
+			}}}},
+		},
+		{
+			name: "deleted file is skipped",
+			diff: `diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-one
+-two
+diff --git a/keep.txt b/keep.txt
+--- a/keep.txt
++++ b/keep.txt
+@@ -1 +1,2 @@
+ one
++two
+`,
+			want: []diffFile{{Path: "keep.txt", Hunks: []diffHunk{{
+				Header: "@@ -1 +1,2 @@",
+				Lines: []diffLine{
+					{Kind: ' ', Text: "one", NewLine: 1},
+					{Kind: '+', Text: "two", NewLine: 2},
+				},
+			}}}},
+		},
+		{
+			name: "content that looks like headers",
+			diff: `--- a/notes.md
++++ b/notes.md
+@@ -1,2 +1,2 @@
+---- a/quoted
++++++ b/quoted
+ @@ -1 +1 @@
+@@ -20 +20 @@
+-x
++y
+`,
+			want: []diffFile{{Path: "notes.md", Hunks: []diffHunk{
+				{
+					Header: "@@ -1,2 +1,2 @@",
+					Lines: []diffLine{
+						{Kind: '-', Text: "--- a/quoted"},
+						{Kind: '+', Text: "++++ b/quoted", NewLine: 1},
+						{Kind: ' ', Text: "@@ -1 +1 @@", NewLine: 2},
+					},
+				},
+				{
+					Header: "@@ -20 +20 @@",
+					Lines: []diffLine{
+						{Kind: '-', Text: "x"},
+						{Kind: '+', Text: "y", NewLine: 20},
+					},
+				},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseUnifiedDiff(tt.diff)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffNewLines(t *testing.T) {
+	diff := `--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+--- a/b.go
++++ b/b.go
+@@ -7 +7,2 @@
+ seven
++eight
+`
+	want := map[string]map[int]bool{
+		"a.go": {1: true, 2: true, 3: true},
+		"b.go": {7: true, 8: true},
+	}
+	if got := diffNewLines(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
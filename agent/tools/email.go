@@ -2,28 +2,311 @@ package jarvisTools
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
 	"jarvis/agent/utils"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/langchaingo/tools"
 )
 
-type EmailTool struct{}
+// maxAttachmentBytes caps the total size of an email's attachments
+const maxAttachmentBytes = 10 * 1024 * 1024
+
+// EmailTool sends email on behalf of a user. Recipients must be on the
+// user's allow-list; the owner's address (EMAIL_OWNER) is always allowed
+// and is the default recipient. Attached files must be regular files in
+// one of EMAIL_ATTACHMENT_DIRS (a path list, by default the working
+// directory).
+type EmailTool struct {
+	UserID string
+	// SMTP overrides the SMTP_* environment settings when set
+	SMTP *utils.SMTPConfig
+	// AttachmentDirs overrides EMAIL_ATTACHMENT_DIRS when set
+	AttachmentDirs []string
+}
+
+func NewEmailTool(userID string) EmailTool {
+	return EmailTool{UserID: userID}
+}
 
 func (t EmailTool) Name() string {
 	return "email_tool"
 }
 
 func (t EmailTool) Description() string {
-	return "This tool must be used to send an email to owner as the result of what is wanted, if specifically the owner wants"
+	return "Send an email, e.g. to notify the owner of a result, only if the owner asks for it. Input should be JSON with 'body' (Markdown: lists, tables and code blocks are rendered), optional 'subject', optional 'to' and 'cc' arrays (default: the owner; only allow-listed addresses are accepted) and optional 'attachments' array of objects with 'path' (a file in the attachment directories, such as a saved screenshot) or 'filename' and 'content_base64', plus optional 'content_type'. Plain text input is sent to the owner as the body."
+}
+
+// emailAttachment is an attachment in the tool input
+type emailAttachment struct {
+	Path          string `json:"path"`
+	Filename      string `json:"filename"`
+	ContentBase64 string `json:"content_base64"`
+	ContentType   string `json:"content_type"`
 }
 
 func (t EmailTool) Call(ctx context.Context, input string) (string, error) {
-	from := "dan_jarvis@gmail.com"
-	to := []string{"dogukangundogan5@gmail.com"} // TODO: Replace with owner's email
-	subject := "Jarvis Agent Notification"
+	var args struct {
+		To          []string          `json:"to"`
+		Cc          []string          `json:"cc"`
+		Subject     string            `json:"subject"`
+		Body        string            `json:"body"`
+		Attachments []emailAttachment `json:"attachments"`
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(input), "{") {
+		if err := json.Unmarshal([]byte(input), &args); err != nil {
+			return "", fmt.Errorf("invalid input JSON: %v", err)
+		}
+	} else {
+		args.Body = input
+	}
 
-	err := utils.SendStyledEmail(from, to, subject, input)
+	if strings.TrimSpace(args.Body) == "" {
+		return "", fmt.Errorf("body is required")
+	}
+	if args.Subject == "" {
+		args.Subject = "Jarvis Agent Notification"
+	}
+
+	allowList := loadEmailAllowList(t.UserID)
+	if len(args.To) == 0 {
+		if allowList.owner == "" {
+			return "", fmt.Errorf("no recipient given and EMAIL_OWNER is not set")
+		}
+		args.To = []string{allowList.owner}
+	}
+
+	to, err := allowList.check(args.To)
+	if err != nil {
+		return "", err
+	}
+	cc, err := allowList.check(args.Cc)
 	if err != nil {
 		return "", err
 	}
 
-	return "Email sent successfully", nil
+	dirs := t.AttachmentDirs
+	if dirs == nil {
+		dirs = attachmentDirsFromEnv()
+	}
+	attachments, err := loadAttachments(args.Attachments, dirs)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := utils.SMTPConfigFromEnv()
+	if t.SMTP != nil {
+		cfg = *t.SMTP
+	}
+
+	err = utils.SendEmail(cfg, utils.Email{
+		To:          to,
+		Cc:          cc,
+		Subject:     args.Subject,
+		Body:        args.Body,
+		Attachments: attachments,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to send email: %v", err)
+	}
+
+	return fmt.Sprintf("Email sent successfully to %s", strings.Join(append(to, cc...), ", ")), nil
+}
+
+// emailAllowList holds the addresses a user may send to. Entries are full
+// addresses or "@domain" to allow a whole domain.
+type emailAllowList struct {
+	owner   string
+	entries []string
+}
+
+// loadEmailAllowList builds the allow-list for userID from EMAIL_OWNER,
+// EMAIL_ALLOWED_RECIPIENTS (comma separated) and EMAIL_ALLOWLIST_FILE, a
+// JSON object mapping user IDs (or "*" for everyone) to lists of entries
+func loadEmailAllowList(userID string) emailAllowList {
+	list := emailAllowList{owner: strings.TrimSpace(os.Getenv("EMAIL_OWNER"))}
+
+	for _, entry := range strings.Split(os.Getenv("EMAIL_ALLOWED_RECIPIENTS"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list.entries = append(list.entries, entry)
+		}
+	}
+
+	if path := os.Getenv("EMAIL_ALLOWLIST_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var perUser map[string][]string
+			if err := json.Unmarshal(data, &perUser); err == nil {
+				list.entries = append(list.entries, perUser["*"]...)
+				list.entries = append(list.entries, perUser[userID]...)
+			}
+		}
+	}
+
+	return list
+}
+
+// check validates addresses and returns them in bare form, failing if any
+// isn't allowed
+func (l emailAllowList) check(addresses []string) ([]string, error) {
+	var result []string
+	for _, raw := range addresses {
+		addr, err := mail.ParseAddress(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q: %v", raw, err)
+		}
+		if !l.allows(addr.Address) {
+			return nil, fmt.Errorf("recipient %s is not on the allow-list; ask the owner to add it to EMAIL_ALLOWED_RECIPIENTS", addr.Address)
+		}
+		result = append(result, addr.Address)
+	}
+	return result, nil
+}
+
+func (l emailAllowList) allows(address string) bool {
+	address = strings.ToLower(address)
+	if l.owner != "" && address == strings.ToLower(l.owner) {
+		return true
+	}
+	for _, entry := range l.entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if strings.HasPrefix(entry, "@") {
+			if strings.HasSuffix(address, entry) {
+				return true
+			}
+		} else if address == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// attachmentDirsFromEnv returns the directories files may be attached from
+func attachmentDirsFromEnv() []string {
+	if dirs := os.Getenv("EMAIL_ATTACHMENT_DIRS"); dirs != "" {
+		return filepath.SplitList(dirs)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		return []string{wd}
+	}
+	return nil
+}
+
+// readAttachmentFile reads a regular file that lies in one of dirs.
+// Symlinks are refused, and the file is opened through os.Root so no
+// parent directory can lead out of dirs either.
+func readAttachmentFile(path string, dirs []string) ([]byte, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attachment path %s: %v", path, err)
+	}
+
+	for _, dir := range dirs {
+		dir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(dir, abs)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+		defer root.Close()
+
+		info, err := root.Lstat(rel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("attachment %s is not a regular file", path)
+		}
+
+		file, err := root.Open(rel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+		defer file.Close()
+
+		// Read one byte past the limit so oversized files are caught
+		data, err := io.ReadAll(io.LimitReader(file, maxAttachmentBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %v", err)
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("attachment %s is outside the allowed directories (EMAIL_ATTACHMENT_DIRS)", path)
+}
+
+// loadAttachments reads attachments from files in dirs or inline base64
+// content
+func loadAttachments(specs []emailAttachment, dirs []string) ([]utils.Attachment, error) {
+	var attachments []utils.Attachment
+	total := 0
+
+	for _, spec := range specs {
+		var a utils.Attachment
+		switch {
+		case spec.Path != "":
+			data, err := readAttachmentFile(spec.Path, dirs)
+			if err != nil {
+				return nil, err
+			}
+			a.Data = data
+			a.Filename = filepath.Base(spec.Path)
+		case spec.ContentBase64 != "":
+			// Tolerate data URLs as produced by screenshot tools
+			content := spec.ContentBase64
+			if i := strings.Index(content, ";base64,"); i >= 0 {
+				content = content[i+len(";base64,"):]
+			}
+			data, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 content for attachment %q: %v", spec.Filename, err)
+			}
+			a.Data = data
+			a.Filename = spec.Filename
+		default:
+			return nil, fmt.Errorf("attachment needs 'path' or 'content_base64'")
+		}
+
+		if spec.Filename != "" {
+			a.Filename = filepath.Base(spec.Filename)
+		}
+		if a.Filename == "" {
+			a.Filename = fmt.Sprintf("attachment-%d", len(attachments)+1)
+		}
+
+		a.ContentType = spec.ContentType
+		if a.ContentType == "" {
+			a.ContentType = http.DetectContentType(a.Data)
+		}
+
+		total += len(a.Data)
+		if total > maxAttachmentBytes {
+			return nil, fmt.Errorf("attachments exceed %d MB", maxAttachmentBytes/(1024*1024))
+		}
+		attachments = append(attachments, a)
+	}
+
+	return attachments, nil
+}
+
+// GetEmailTools returns the email tools for a user
+func GetEmailTools(userID string) []tools.Tool {
+	return []tools.Tool{
+		NewEmailTool(userID),
+	}
 }
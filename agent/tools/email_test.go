@@ -0,0 +1,261 @@
+package jarvisTools
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"jarvis/agent/utils"
+	"jarvis/agent/utils/smtpstub"
+)
+
+// newTestEmailTool returns an email tool that sends to a fresh smtpstub
+// server and may attach files from dir
+func newTestEmailTool(t *testing.T, dir string) (EmailTool, *smtpstub.Server) {
+	t.Helper()
+
+	server, err := smtpstub.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	t.Setenv("EMAIL_OWNER", "owner@example.com")
+	t.Setenv("EMAIL_ALLOWED_RECIPIENTS", "friend@example.com,@team.example.com")
+	t.Setenv("EMAIL_ALLOWLIST_FILE", "")
+
+	tool := NewEmailTool("user-1")
+	tool.SMTP = &utils.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: server.Port(),
+		TLS:  "none",
+		Auth: "none",
+		From: "jarvis@example.com",
+	}
+	tool.AttachmentDirs = []string{dir}
+	return tool, server
+}
+
+func TestEmailToolAllowList(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		rcpt  []string
+		err   string
+	}{
+		{
+			name:  "plain text goes to the owner",
+			input: "Build finished",
+			rcpt:  []string{"owner@example.com"},
+		},
+		{
+			name:  "listed address",
+			input: `{"to": ["Friend <friend@example.com>"], "body": "hi"}`,
+			rcpt:  []string{"friend@example.com"},
+		},
+		{
+			name:  "listed domain",
+			input: `{"to": ["dev@team.example.com"], "body": "hi"}`,
+			rcpt:  []string{"dev@team.example.com"},
+		},
+		{
+			name:  "unlisted recipient",
+			input: `{"to": ["stranger@example.org"], "body": "hi"}`,
+			err:   "not on the allow-list",
+		},
+		{
+			name:  "domain suffix is not the domain",
+			input: `{"to": ["dev@evilteam.example.com"], "body": "hi"}`,
+			err:   "not on the allow-list",
+		},
+		{
+			name:  "unlisted cc",
+			input: `{"cc": ["stranger@example.org"], "body": "hi"}`,
+			err:   "not on the allow-list",
+		},
+		{
+			name:  "invalid address",
+			input: `{"to": ["not an address"], "body": "hi"}`,
+			err:   "invalid email address",
+		},
+		{
+			name:  "empty body",
+			input: `{"to": ["friend@example.com"]}`,
+			err:   "body is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, server := newTestEmailTool(t, t.TempDir())
+
+			_, err := tool.Call(context.Background(), tt.input)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				if n := len(server.Messages()); n != 0 {
+					t.Errorf("%d messages sent despite the error", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			messages := server.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			if !reflect.DeepEqual(messages[0].To, tt.rcpt) {
+				t.Errorf("got recipients %v, want %v", messages[0].To, tt.rcpt)
+			}
+		})
+	}
+}
+
+func TestEmailToolCc(t *testing.T) {
+	tool, server := newTestEmailTool(t, t.TempDir())
+
+	_, err := tool.Call(context.Background(), `{"to": ["friend@example.com"], "cc": ["owner@example.com", "lead@team.example.com"], "subject": "Report", "body": "done"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	rcpt := append([]string(nil), messages[0].To...)
+	sort.Strings(rcpt)
+	if want := []string{"friend@example.com", "lead@team.example.com", "owner@example.com"}; !reflect.DeepEqual(rcpt, want) {
+		t.Errorf("got recipients %v, want %v", rcpt, want)
+	}
+
+	msg, err := messages[0].Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("To"); got != "<friend@example.com>" {
+		t.Errorf("got To %q", got)
+	}
+	if got := msg.Header.Get("Cc"); got != "<owner@example.com>, <lead@team.example.com>" {
+		t.Errorf("got Cc %q", got)
+	}
+	if got := msg.Header.Get("Subject"); got != "Report" {
+		t.Errorf("got Subject %q", got)
+	}
+}
+
+func TestEmailToolAttachments(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+
+	png := []byte("\x89PNG\r\n\x1a\n fake image")
+	if err := os.WriteFile(filepath.Join(dir, "shot.png"), png, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("file and inline content", func(t *testing.T) {
+		tool, server := newTestEmailTool(t, dir)
+
+		input := `{"body": "see attached", "attachments": [
+			{"path": "` + filepath.Join(dir, "shot.png") + `"},
+			{"filename": "notes.txt", "content_base64": "data:text/plain;base64,` + base64.StdEncoding.EncodeToString([]byte("some notes")) + `", "content_type": "text/plain"}
+		]}`
+		if _, err := tool.Call(context.Background(), input); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		messages := server.Messages()
+		if len(messages) != 1 {
+			t.Fatalf("got %d messages, want 1", len(messages))
+		}
+		got := attachmentsOf(t, messages[0])
+		want := map[string]string{"shot.png": string(png), "notes.txt": "some notes"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got attachments %q, want %q", got, want)
+		}
+	})
+
+	rejected := []struct {
+		name string
+		path string
+		err  string
+	}{
+		{name: "outside the directories", path: filepath.Join(outside, "secret.txt"), err: "outside the allowed directories"},
+		{name: "traversal", path: filepath.Join(dir, "..", filepath.Base(outside), "secret.txt"), err: "outside the allowed directories"},
+		{name: "symlink", path: filepath.Join(dir, "link.txt"), err: "not a regular file"},
+		{name: "symlinked directory", path: filepath.Join(dir, "linkdir", "secret.txt"), err: "failed to read attachment"},
+		{name: "directory", path: filepath.Join(dir, "sub"), err: "not a regular file"},
+		{name: "missing", path: filepath.Join(dir, "missing.png"), err: "failed to read attachment"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, server := newTestEmailTool(t, dir)
+
+			_, err := tool.Call(context.Background(), `{"body": "x", "attachments": [{"path": "`+tt.path+`"}]}`)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+			if n := len(server.Messages()); n != 0 {
+				t.Errorf("%d messages sent despite the error", n)
+			}
+		})
+	}
+}
+
+// attachmentsOf returns the attachments of a message by filename
+func attachmentsOf(t *testing.T, m smtpstub.Message) map[string]string {
+	t.Helper()
+
+	msg, err := m.Parsed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("got Content-Type %q, want multipart/mixed", msg.Header.Get("Content-Type"))
+	}
+
+	attachments := map[string]string{}
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		attachments[part.FileName()] = string(data)
+	}
+	return attachments
+}
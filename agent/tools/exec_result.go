@@ -0,0 +1,196 @@
+package jarvisTools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// outputHeadBytes and outputTailBytes bound how much of each stream is
+	// kept; the middle of longer output is dropped so it doesn't flood the
+	// model's context.
+	outputHeadBytes = 4 * 1024
+	outputTailBytes = 4 * 1024
+)
+
+// ExecResult is the structured outcome of a command run by a tool
+type ExecResult struct {
+	Command   string        `json:"command"`
+	Stdout    string        `json:"stdout"`
+	Stderr    string        `json:"stderr"`
+	ExitCode  int           `json:"exit_code"`
+	Duration  time.Duration `json:"duration"`
+	TimedOut  bool          `json:"timed_out"`
+	Truncated bool          `json:"truncated"`
+	// Stage names the setup step that failed, e.g. "install" or "build"
+	Stage string `json:"stage,omitempty"`
+}
+
+// Success reports whether the command exited with code 0 in time
+func (r *ExecResult) Success() bool {
+	return r.ExitCode == 0 && !r.TimedOut
+}
+
+// Render formats the result for the model
+func (r *ExecResult) Render() string {
+	var b strings.Builder
+
+	status := fmt.Sprintf("exit code: %d", r.ExitCode)
+	if r.TimedOut {
+		status = "timed out"
+	}
+	if r.Stage != "" {
+		fmt.Fprintf(&b, "%s failed (%s) | ", r.Stage, r.Command)
+	}
+	fmt.Fprintf(&b, "%s | duration: %s", status, r.Duration.Round(time.Millisecond))
+	if r.Truncated {
+		b.WriteString(" | output truncated")
+	}
+	b.WriteString("\n")
+
+	if r.Stdout == "" && r.Stderr == "" {
+		b.WriteString("(no output)\n")
+		return b.String()
+	}
+
+	renderSection(&b, "stdout", r.Stdout)
+	renderSection(&b, "stderr", r.Stderr)
+	return b.String()
+}
+
+func renderSection(b *strings.Builder, name, content string) {
+	if content == "" {
+		return
+	}
+	fmt.Fprintf(b, "--- %s ---\n", name)
+	b.WriteString(content)
+	if !strings.HasSuffix(content, "\n") {
+		b.WriteString("\n")
+	}
+}
+
+// runCommand runs cmd, which must have been created with
+// exec.CommandContext(ctx, ...), and collects its output. Non-zero exits and
+// deadline expiry are reported in the result; an error is returned when the
+// command could not be started or ctx was cancelled. If cmd.Stdout or
+// cmd.Stderr is already set it receives the complete stream as well, for
+// callers that parse it.
+func runCommand(ctx context.Context, cmd *exec.Cmd) (*ExecResult, error) {
+	stdout := newHeadTailBuffer(outputHeadBytes, outputTailBytes)
+	stderr := newHeadTailBuffer(outputHeadBytes, outputTailBytes)
+	if cmd.Stdout != nil {
+		cmd.Stdout = io.MultiWriter(stdout, cmd.Stdout)
+	} else {
+		cmd.Stdout = stdout
+	}
+	if cmd.Stderr != nil {
+		cmd.Stderr = io.MultiWriter(stderr, cmd.Stderr)
+	} else {
+		cmd.Stderr = stderr
+	}
+
+	// Kill the whole process group so that children of shell commands stop too
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		signalProcessGroup(cmd, true)
+		return nil
+	}
+	cmd.WaitDelay = 2 * time.Second
+
+	result := &ExecResult{Command: strings.Join(cmd.Args, " ")}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", cmd.Path, err)
+	}
+
+	err := cmd.Wait()
+
+	result.Duration = time.Since(start)
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+	result.Truncated = stdout.Truncated() || stderr.Truncated()
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case ctx.Err() != nil:
+		result.ExitCode = -1
+	default:
+		result.ExitCode = -1
+		if result.Stderr != "" && !strings.HasSuffix(result.Stderr, "\n") {
+			result.Stderr += "\n"
+		}
+		result.Stderr += err.Error()
+	}
+
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		result.TimedOut = true
+	case context.Canceled:
+		return result, fmt.Errorf("command cancelled: %v", ctx.Err())
+	}
+
+	return result, nil
+}
+
+// headTailBuffer keeps the first head and the last tail bytes written to it
+type headTailBuffer struct {
+	head    []byte
+	tail    []byte
+	maxHead int
+	maxTail int
+	total   int64
+}
+
+func newHeadTailBuffer(maxHead, maxTail int) *headTailBuffer {
+	return &headTailBuffer{maxHead: maxHead, maxTail: maxTail}
+}
+
+func (b *headTailBuffer) Write(p []byte) (int, error) {
+	b.total += int64(len(p))
+
+	rest := p
+	if room := b.maxHead - len(b.head); room > 0 {
+		if room > len(rest) {
+			room = len(rest)
+		}
+		b.head = append(b.head, rest[:room]...)
+		rest = rest[room:]
+	}
+
+	if len(rest) > 0 {
+		b.tail = append(b.tail, rest...)
+		if over := len(b.tail) - b.maxTail; over > 0 {
+			b.tail = append([]byte(nil), b.tail[over:]...)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Truncated reports whether any output was dropped
+func (b *headTailBuffer) Truncated() bool {
+	return b.total > int64(len(b.head)+len(b.tail))
+}
+
+func (b *headTailBuffer) String() string {
+	if !b.Truncated() {
+		return string(b.head) + string(b.tail)
+	}
+
+	omitted := b.total - int64(len(b.head)+len(b.tail))
+	var buf bytes.Buffer
+	buf.Write(b.head)
+	fmt.Fprintf(&buf, "\n... [%d bytes omitted] ...\n", omitted)
+	buf.Write(b.tail)
+	return buf.String()
+}
@@ -22,15 +22,11 @@ func (t RunCodeTool) Name() string {
 }
 
 func (t RunCodeTool) Description() string {
-	return "Execute code in a specified language (supports Go, Python, JavaScript, etc.). Input should be JSON with 'code', 'language', and optional 'timeout' fields."
+	return "Execute code in a sandbox directory. Supports go, python, javascript, typescript, ruby, rust, c, cpp, java and bash. Input should be JSON with 'language' and either 'code' or 'files' (a map of relative path to content for multi-file programs), plus optional 'entrypoint', 'stdin' and 'timeout' fields. Dependency manifests in 'files' (requirements.txt, package.json, go.mod, Gemfile, Cargo.toml) are installed in the sandbox before running. Returns the exit code, duration, stdout and stderr."
 }
 
 func (t RunCodeTool) Call(ctx context.Context, input string) (string, error) {
-	var args struct {
-		Code     string `json:"code"`
-		Language string `json:"language"`
-		Timeout  int    `json:"timeout"`
-	}
+	var args codeRequest
 
 	if err := json.Unmarshal([]byte(input), &args); err != nil {
 		return "", fmt.Errorf("invalid input JSON: %v", err)
@@ -40,7 +36,12 @@ func (t RunCodeTool) Call(ctx context.Context, input string) (string, error) {
 		args.Timeout = 30
 	}
 
-	return executeCode(args.Code, args.Language, args.Timeout)
+	result, err := executeCode(ctx, args)
+	if err != nil {
+		return "", err
+	}
+
+	return result.Render(), nil
 }
 
 type ExecuteTerminalTool struct{}
@@ -50,7 +51,7 @@ func (t ExecuteTerminalTool) Name() string {
 }
 
 func (t ExecuteTerminalTool) Description() string {
-	return "Execute terminal/shell commands. Input should be JSON with 'command', optional 'working_dir', and optional 'timeout' fields."
+	return "Execute terminal/shell commands. Input should be JSON with 'command', optional 'working_dir', and optional 'timeout' fields. Returns the exit code, duration, stdout and stderr."
 }
 
 func (t ExecuteTerminalTool) Call(ctx context.Context, input string) (string, error) {
@@ -68,7 +69,12 @@ func (t ExecuteTerminalTool) Call(ctx context.Context, input string) (string, er
 		args.Timeout = 30
 	}
 
-	return executeTerminalCommand(args.Command, args.WorkingDir, args.Timeout)
+	result, err := executeTerminalCommand(ctx, args.Command, args.WorkingDir, args.Timeout)
+	if err != nil {
+		return "", fmt.Errorf("command failed: %v", err)
+	}
+
+	return result.Render(), nil
 }
 
 type EvaluateExpressionTool struct{}
@@ -95,131 +101,158 @@ func (t EvaluateExpressionTool) Call(ctx context.Context, input string) (string,
 		args.Language = "python"
 	}
 
-	return evaluateExpression(args.Expression, args.Language)
+	return evaluateExpression(ctx, args.Expression, args.Language)
+}
+
+// setupTimeout bounds each install or build step, separately from the
+// program's own timeout, since fetching dependencies can be slow
+const setupTimeout = 5 * time.Minute
+
+// codeRequest is the payload accepted by run_code
+type codeRequest struct {
+	Code       string            `json:"code"`
+	Language   string            `json:"language"`
+	Files      map[string]string `json:"files"`
+	Entrypoint string            `json:"entrypoint"`
+	Stdin      string            `json:"stdin"`
+	Timeout    int               `json:"timeout"`
 }
 
-func executeCode(code, language string, timeout int) (string, error) {
+func executeCode(ctx context.Context, req codeRequest) (*ExecResult, error) {
+	language, spec, ok := lookupLanguage(req.Language)
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", req.Language)
+	}
+
 	tempDir, err := ioutil.TempDir("", "jarvis_exec_")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %v", err)
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
 	}
 	defer os.RemoveAll(tempDir)
 
-	var cmd *exec.Cmd
-	var fileName string
+	entry, err := writeSandboxFiles(tempDir, spec, req)
+	if err != nil {
+		return nil, err
+	}
 
-	switch strings.ToLower(language) {
-	case "go":
-		fileName = filepath.Join(tempDir, "main.go")
-		err = ioutil.WriteFile(fileName, []byte(code), 0644)
+	for _, step := range spec.prepare(tempDir, entry) {
+		result, err := runSandboxStep(ctx, tempDir, step.args, setupTimeout, "")
 		if err != nil {
-			return "", fmt.Errorf("failed to write Go file: %v", err)
+			return nil, err
 		}
-		cmd = exec.Command("go", "run", fileName)
-
-	case "python":
-		fileName = filepath.Join(tempDir, "script.py")
-		err = ioutil.WriteFile(fileName, []byte(code), 0644)
-		if err != nil {
-			return "", fmt.Errorf("failed to write Python file: %v", err)
+		if !result.Success() {
+			result.Stage = step.stage
+			return result, nil
 		}
-		cmd = exec.Command("python3", fileName)
+	}
 
-	case "javascript", "js":
-		fileName = filepath.Join(tempDir, "script.js")
-		err = ioutil.WriteFile(fileName, []byte(code), 0644)
-		if err != nil {
-			return "", fmt.Errorf("failed to write JavaScript file: %v", err)
-		}
-		cmd = exec.Command("node", fileName)
+	result, err := runSandboxStep(ctx, tempDir, spec.run(tempDir, entry), time.Duration(req.Timeout)*time.Second, req.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s code: %v", language, err)
+	}
 
-	case "bash", "sh":
-		fileName = filepath.Join(tempDir, "script.sh")
-		err = ioutil.WriteFile(fileName, []byte(code), 0755)
-		if err != nil {
-			return "", fmt.Errorf("failed to write shell script: %v", err)
-		}
-		cmd = exec.Command("bash", fileName)
+	return result, nil
+}
 
-	default:
-		return "", fmt.Errorf("unsupported language: %s", language)
+// writeSandboxFiles writes the request's files into dir and returns the entrypoint
+func writeSandboxFiles(dir string, spec languageSpec, req codeRequest) (string, error) {
+	entry := req.Entrypoint
+	if entry == "" {
+		entry = spec.entryFor(req.Files)
 	}
+	entry = filepath.Clean(entry)
 
-	cmd.Dir = tempDir
+	files := make(map[string]string, len(req.Files)+1)
+	for path, content := range req.Files {
+		files[filepath.Clean(path)] = content
+	}
 
-	done := make(chan error, 1)
-	var output []byte
+	if req.Code != "" {
+		if _, exists := files[entry]; exists {
+			return "", fmt.Errorf("both 'code' and files[%q] were given", entry)
+		}
+		files[entry] = req.Code
+	}
 
-	go func() {
-		output, err = cmd.CombinedOutput()
-		done <- err
-	}()
+	if _, exists := files[entry]; !exists {
+		return "", fmt.Errorf("entrypoint %s not found: provide 'code' or include it in 'files'", entry)
+	}
 
-	select {
-	case err := <-done:
-		if err != nil {
-			return string(output), fmt.Errorf("execution failed: %v", err)
+	for path, content := range files {
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("file path %s must be relative to the sandbox", path)
 		}
-		return string(output), nil
-	case <-time.After(time.Duration(timeout) * time.Second):
-		if cmd.Process != nil {
-			cmd.Process.Kill()
+
+		mode := os.FileMode(0644)
+		if path == entry && spec.mode != 0 {
+			mode = spec.mode
+		}
+
+		fullPath := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create directory for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(fullPath, []byte(content), mode); err != nil {
+			return "", fmt.Errorf("failed to write %s: %v", path, err)
 		}
-		return "", fmt.Errorf("execution timed out after %d seconds", timeout)
 	}
+
+	return entry, nil
 }
 
-func executeTerminalCommand(command, workingDir string, timeout int) (string, error) {
-	cmd := exec.Command("bash", "-c", command)
+func runSandboxStep(ctx context.Context, dir string, args []string, timeout time.Duration, stdin string) (*ExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	if workingDir != "" {
-		cmd.Dir = workingDir
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
 	}
 
-	done := make(chan error, 1)
-	var output []byte
+	return runCommand(ctx, cmd)
+}
 
-	go func() {
-		var err error
-		output, err = cmd.CombinedOutput()
-		done <- err
-	}()
+func executeTerminalCommand(ctx context.Context, command, workingDir string, timeout int) (*ExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
 
-	select {
-	case err := <-done:
-		if err != nil {
-			return string(output), fmt.Errorf("command failed: %v", err)
-		}
-		return string(output), nil
-	case <-time.After(time.Duration(timeout) * time.Second):
-		if cmd.Process != nil {
-			cmd.Process.Kill()
-		}
-		return "", fmt.Errorf("command timed out after %d seconds", timeout)
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+
+	if workingDir != "" {
+		cmd.Dir = workingDir
 	}
+
+	return runCommand(ctx, cmd)
 }
 
-func evaluateExpression(expression, language string) (string, error) {
+func evaluateExpression(ctx context.Context, expression, language string) (string, error) {
+	var code string
+
 	switch strings.ToLower(language) {
 	case "python":
-		code := fmt.Sprintf("print(%s)", expression)
-		return executeCode(code, "python", 10)
+		code = fmt.Sprintf("print(%s)", expression)
 	case "javascript", "js":
-		code := fmt.Sprintf("console.log(%s)", expression)
-		return executeCode(code, "javascript", 10)
+		code = fmt.Sprintf("console.log(%s)", expression)
 	case "go":
-		code := fmt.Sprintf(`package main
+		code = fmt.Sprintf(`package main
 import "fmt"
 func main() {
 	fmt.Println(%s)
 }`, expression)
-		return executeCode(code, "go", 10)
 	default:
 		if num, err := strconv.ParseFloat(expression, 64); err == nil {
 			return fmt.Sprintf("%g", num), nil
 		}
 		return "", fmt.Errorf("unsupported language for expression evaluation: %s", language)
 	}
+
+	result, err := executeCode(ctx, codeRequest{Code: code, Language: language, Timeout: 10})
+	if err != nil {
+		return "", err
+	}
+
+	return result.Render(), nil
 }
 
 func GetExecutionTools() []tools.Tool {
@@ -0,0 +1,237 @@
+package jarvisTools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Forge is a code hosting service that pull requests are opened on.
+// Repositories are identified by their path on the forge, e.g. "owner/repo"
+// on GitHub or "group/subgroup/project" on GitLab.
+type Forge interface {
+	// Name identifies the forge in tool output
+	Name() string
+	CreatePullRequest(ctx context.Context, repo string, pr NewPullRequest) (*PullRequest, error)
+	// ListPullRequests lists pull requests in state "open", "closed" or "all"
+	ListPullRequests(ctx context.Context, repo, state string) ([]PullRequest, error)
+	// GetPullRequestDiff returns the unified diff of a pull request
+	GetPullRequestDiff(ctx context.Context, repo string, number int) (string, error)
+	// Comment adds a general comment to a pull request
+	Comment(ctx context.Context, repo string, number int, body string) error
+	// ReviewComment adds an inline comment on a line of the pull request's new version
+	ReviewComment(ctx context.Context, repo string, number int, comment ReviewComment) error
+}
+
+// NewPullRequest describes a pull request to open
+type NewPullRequest struct {
+	Title string
+	Body  string
+	Base  string
+	Head  string
+}
+
+// PullRequest is a pull request (a merge request on GitLab)
+type PullRequest struct {
+	Number int    `json:"number"`
+	Title  string `json:"title"`
+	State  string `json:"state"`
+	URL    string `json:"url"`
+	Base   string `json:"base"`
+	Head   string `json:"head"`
+	Author string `json:"author,omitempty"`
+}
+
+// ReviewComment is an inline comment on a file and line of a pull request
+type ReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Body string `json:"body"`
+}
+
+// forgeClient is the HTTP plumbing shared by the REST forges
+type forgeClient struct {
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newForgeClient(baseURL string, headers map[string]string) forgeClient {
+	return forgeClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		headers: headers,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request with an optional JSON body and returns the response
+// body, failing on non-2xx statuses with the forge's error message
+func (c forgeClient) do(ctx context.Context, method, path string, body interface{}, accept string) ([]byte, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg := strings.TrimSpace(string(respBody))
+		if len(msg) > 500 {
+			msg = msg[:500] + "..."
+		}
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, msg)
+	}
+
+	return respBody, nil
+}
+
+// doJSON is do with the response decoded into out
+func (c forgeClient) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	data, err := c.do(ctx, method, path, body, "")
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// defaultMemoryForge backs FORGE_PROVIDER=memory so pull requests persist
+// across tool calls within one process
+var defaultMemoryForge = NewMemoryForge()
+
+// forgeForRepo picks the forge for a repository and resolves its path. An
+// empty repository is derived from the origin remote of workingDir. The
+// provider comes from FORGE_PROVIDER, falling back to the remote's host.
+func forgeForRepo(ctx context.Context, workingDir, repository string) (Forge, string, error) {
+	provider := strings.ToLower(os.Getenv("FORGE_PROVIDER"))
+
+	host := ""
+	if repository == "" {
+		remote, err := originURL(ctx, workingDir)
+		if err != nil {
+			return nil, "", err
+		}
+		host, repository, err = parseRemoteURL(remote)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	if provider == "" {
+		switch {
+		case strings.Contains(host, "gitlab"):
+			provider = "gitlab"
+		case host == "" || strings.Contains(host, "github"):
+			provider = "github"
+		default:
+			return nil, "", fmt.Errorf("cannot tell which forge hosts %s; set FORGE_PROVIDER to github, gitlab or memory", host)
+		}
+	}
+
+	switch provider {
+	case "github":
+		forge, err := NewGitHubForge(os.Getenv("GITHUB_API_URL"), os.Getenv("GITHUB_TOKEN"))
+		return forge, repository, err
+	case "gitlab":
+		forge, err := NewGitLabForge(os.Getenv("GITLAB_API_URL"), os.Getenv("GITLAB_TOKEN"))
+		return forge, repository, err
+	case "memory":
+		return defaultMemoryForge, repository, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported FORGE_PROVIDER: %s", provider)
+	}
+}
+
+func originURL(ctx context.Context, workingDir string) (string, error) {
+	dir, err := resolveWorkingDir(workingDir)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "remote", "get-url", "origin")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("no repository given and no origin remote in %s: %v", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// scpRemote matches scp-style remotes such as git@github.com:owner/repo.git
+var scpRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// parseRemoteURL splits a git remote into its host and repository path
+func parseRemoteURL(remote string) (string, string, error) {
+	var host, path string
+
+	if u, err := url.Parse(remote); err == nil && u.Scheme != "" && u.Host != "" {
+		host, path = u.Hostname(), u.Path
+	} else if m := scpRemote.FindStringSubmatch(remote); m != nil {
+		host, path = m[1], m[2]
+	} else {
+		return "", "", fmt.Errorf("unrecognised remote URL: %s", remote)
+	}
+
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("remote %s does not name an owner and repository", remote)
+	}
+
+	return host, path, nil
+}
+
+// currentBranch returns the branch checked out in workingDir
+func currentBranch(ctx context.Context, workingDir string) (string, error) {
+	result, err := runGit(ctx, workingDir, "branch", "--show-current")
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimSpace(result.Stdout)
+	if !result.Success() || branch == "" {
+		return "", fmt.Errorf("failed to get current branch: %s", strings.TrimSpace(result.Stderr))
+	}
+	return branch, nil
+}
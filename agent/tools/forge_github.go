@@ -0,0 +1,137 @@
+package jarvisTools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// GitHubForge talks to the GitHub REST API
+type GitHubForge struct {
+	api forgeClient
+}
+
+// NewGitHubForge creates a GitHub forge. apiURL defaults to
+// https://api.github.com; set it for GitHub Enterprise.
+func NewGitHubForge(apiURL, token string) (*GitHubForge, error) {
+	if token == "" {
+		return nil, fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+
+	return &GitHubForge{
+		api: newForgeClient(apiURL, map[string]string{
+			"Authorization":        "Bearer " + token,
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		}),
+	}, nil
+}
+
+func (f *GitHubForge) Name() string {
+	return "github"
+}
+
+type githubPull struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+}
+
+func (p githubPull) toPullRequest() PullRequest {
+	return PullRequest{
+		Number: p.Number,
+		Title:  p.Title,
+		State:  p.State,
+		URL:    p.HTMLURL,
+		Base:   p.Base.Ref,
+		Head:   p.Head.Ref,
+		Author: p.User.Login,
+	}
+}
+
+func (f *GitHubForge) CreatePullRequest(ctx context.Context, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created githubPull
+	err := f.api.doJSON(ctx, "POST", fmt.Sprintf("/repos/%s/pulls", repo), map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"base":  pr.Base,
+		"head":  pr.Head,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pull request: %v", err)
+	}
+
+	result := created.toPullRequest()
+	return &result, nil
+}
+
+func (f *GitHubForge) ListPullRequests(ctx context.Context, repo, state string) ([]PullRequest, error) {
+	if state == "" {
+		state = "open"
+	}
+
+	var pulls []githubPull
+	path := fmt.Sprintf("/repos/%s/pulls?state=%s&per_page=50", repo, url.QueryEscape(state))
+	if err := f.api.doJSON(ctx, "GET", path, nil, &pulls); err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %v", err)
+	}
+
+	result := make([]PullRequest, 0, len(pulls))
+	for _, p := range pulls {
+		result = append(result, p.toPullRequest())
+	}
+	return result, nil
+}
+
+func (f *GitHubForge) GetPullRequestDiff(ctx context.Context, repo string, number int) (string, error) {
+	diff, err := f.api.do(ctx, "GET", fmt.Sprintf("/repos/%s/pulls/%d", repo, number), nil, "application/vnd.github.diff")
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch pull request diff: %v", err)
+	}
+	return string(diff), nil
+}
+
+func (f *GitHubForge) Comment(ctx context.Context, repo string, number int, body string) error {
+	// Pull request conversation comments go through the issues API
+	err := f.api.doJSON(ctx, "POST", fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), map[string]string{
+		"body": body,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to comment on pull request: %v", err)
+	}
+	return nil
+}
+
+func (f *GitHubForge) ReviewComment(ctx context.Context, repo string, number int, comment ReviewComment) error {
+	// Inline comments are anchored to the pull request's head commit
+	var pull githubPull
+	if err := f.api.doJSON(ctx, "GET", fmt.Sprintf("/repos/%s/pulls/%d", repo, number), nil, &pull); err != nil {
+		return fmt.Errorf("failed to fetch pull request: %v", err)
+	}
+
+	err := f.api.doJSON(ctx, "POST", fmt.Sprintf("/repos/%s/pulls/%d/comments", repo, number), map[string]interface{}{
+		"body":      comment.Body,
+		"commit_id": pull.Head.SHA,
+		"path":      comment.Path,
+		"line":      comment.Line,
+		"side":      "RIGHT",
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add review comment: %v", err)
+	}
+	return nil
+}
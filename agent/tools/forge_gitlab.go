@@ -0,0 +1,171 @@
+package jarvisTools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// GitLabForge talks to the GitLab REST API, where pull requests are merge requests
+type GitLabForge struct {
+	api forgeClient
+}
+
+// NewGitLabForge creates a GitLab forge. apiURL defaults to
+// https://gitlab.com/api/v4; set it for self-managed instances.
+func NewGitLabForge(apiURL, token string) (*GitLabForge, error) {
+	if token == "" {
+		return nil, fmt.Errorf("GITLAB_TOKEN is not set")
+	}
+	if apiURL == "" {
+		apiURL = "https://gitlab.com/api/v4"
+	}
+
+	return &GitLabForge{
+		api: newForgeClient(apiURL, map[string]string{
+			"PRIVATE-TOKEN": token,
+		}),
+	}, nil
+}
+
+func (f *GitLabForge) Name() string {
+	return "gitlab"
+}
+
+type gitlabMergeRequest struct {
+	IID          int    `json:"iid"`
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	WebURL       string `json:"web_url"`
+	SourceBranch string `json:"source_branch"`
+	TargetBranch string `json:"target_branch"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	DiffRefs struct {
+		BaseSHA  string `json:"base_sha"`
+		HeadSHA  string `json:"head_sha"`
+		StartSHA string `json:"start_sha"`
+	} `json:"diff_refs"`
+}
+
+func (mr gitlabMergeRequest) toPullRequest() PullRequest {
+	return PullRequest{
+		Number: mr.IID,
+		Title:  mr.Title,
+		State:  mr.State,
+		URL:    mr.WebURL,
+		Base:   mr.TargetBranch,
+		Head:   mr.SourceBranch,
+		Author: mr.Author.Username,
+	}
+}
+
+// projectPath returns the API path of a project given as "group/project"
+func (f *GitLabForge) projectPath(repo string) string {
+	return "/projects/" + url.PathEscape(repo)
+}
+
+func (f *GitLabForge) CreatePullRequest(ctx context.Context, repo string, pr NewPullRequest) (*PullRequest, error) {
+	var created gitlabMergeRequest
+	err := f.api.doJSON(ctx, "POST", f.projectPath(repo)+"/merge_requests", map[string]string{
+		"title":         pr.Title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+	}, &created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create merge request: %v", err)
+	}
+
+	result := created.toPullRequest()
+	return &result, nil
+}
+
+func (f *GitLabForge) ListPullRequests(ctx context.Context, repo, state string) ([]PullRequest, error) {
+	// GitLab calls open merge requests "opened"
+	switch state {
+	case "", "open":
+		state = "opened"
+	}
+
+	var mrs []gitlabMergeRequest
+	path := fmt.Sprintf("%s/merge_requests?state=%s&per_page=50", f.projectPath(repo), url.QueryEscape(state))
+	if err := f.api.doJSON(ctx, "GET", path, nil, &mrs); err != nil {
+		return nil, fmt.Errorf("failed to list merge requests: %v", err)
+	}
+
+	result := make([]PullRequest, 0, len(mrs))
+	for _, mr := range mrs {
+		result = append(result, mr.toPullRequest())
+	}
+	return result, nil
+}
+
+func (f *GitLabForge) GetPullRequestDiff(ctx context.Context, repo string, number int) (string, error) {
+	var diffs []struct {
+		OldPath     string `json:"old_path"`
+		NewPath     string `json:"new_path"`
+		Diff        string `json:"diff"`
+		NewFile     bool   `json:"new_file"`
+		DeletedFile bool   `json:"deleted_file"`
+	}
+	path := fmt.Sprintf("%s/merge_requests/%d/diffs?per_page=100", f.projectPath(repo), number)
+	if err := f.api.doJSON(ctx, "GET", path, nil, &diffs); err != nil {
+		return "", fmt.Errorf("failed to fetch merge request diff: %v", err)
+	}
+
+	// GitLab returns per-file hunks; add the headers of a unified diff
+	var b strings.Builder
+	for _, d := range diffs {
+		oldPath, newPath := "a/"+d.OldPath, "b/"+d.NewPath
+		if d.NewFile {
+			oldPath = "/dev/null"
+		}
+		if d.DeletedFile {
+			newPath = "/dev/null"
+		}
+		fmt.Fprintf(&b, "diff --git a/%s b/%s\n--- %s\n+++ %s\n", d.OldPath, d.NewPath, oldPath, newPath)
+		b.WriteString(d.Diff)
+		if !strings.HasSuffix(d.Diff, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+func (f *GitLabForge) Comment(ctx context.Context, repo string, number int, body string) error {
+	err := f.api.doJSON(ctx, "POST", fmt.Sprintf("%s/merge_requests/%d/notes", f.projectPath(repo), number), map[string]string{
+		"body": body,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to comment on merge request: %v", err)
+	}
+	return nil
+}
+
+func (f *GitLabForge) ReviewComment(ctx context.Context, repo string, number int, comment ReviewComment) error {
+	// Diff discussions are positioned against the merge request's diff refs
+	var mr gitlabMergeRequest
+	if err := f.api.doJSON(ctx, "GET", fmt.Sprintf("%s/merge_requests/%d", f.projectPath(repo), number), nil, &mr); err != nil {
+		return fmt.Errorf("failed to fetch merge request: %v", err)
+	}
+
+	err := f.api.doJSON(ctx, "POST", fmt.Sprintf("%s/merge_requests/%d/discussions", f.projectPath(repo), number), map[string]interface{}{
+		"body": comment.Body,
+		"position": map[string]interface{}{
+			"position_type": "text",
+			"base_sha":      mr.DiffRefs.BaseSHA,
+			"start_sha":     mr.DiffRefs.StartSHA,
+			"head_sha":      mr.DiffRefs.HeadSHA,
+			"new_path":      comment.Path,
+			"old_path":      comment.Path,
+			"new_line":      comment.Line,
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to add review comment: %v", err)
+	}
+	return nil
+}
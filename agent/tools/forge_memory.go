@@ -0,0 +1,163 @@
+package jarvisTools
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// MemoryForge is an in-process Forge for exercising pull request workflows
+// without a real forge. Diffs are supplied with SetDiff; inline comments are
+// checked against them the way GitHub rejects comments outside the diff.
+type MemoryForge struct {
+	mu    sync.Mutex
+	pulls map[string][]*memoryPull
+}
+
+type memoryPull struct {
+	PullRequest
+	diff           string
+	comments       []string
+	reviewComments []ReviewComment
+}
+
+// NewMemoryForge creates an empty in-memory forge
+func NewMemoryForge() *MemoryForge {
+	return &MemoryForge{pulls: make(map[string][]*memoryPull)}
+}
+
+func (f *MemoryForge) Name() string {
+	return "memory"
+}
+
+func (f *MemoryForge) find(repo string, number int) (*memoryPull, error) {
+	for _, p := range f.pulls[repo] {
+		if p.Number == number {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("pull request %s#%d not found", repo, number)
+}
+
+func (f *MemoryForge) CreatePullRequest(ctx context.Context, repo string, pr NewPullRequest) (*PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if pr.Title == "" || pr.Base == "" || pr.Head == "" {
+		return nil, fmt.Errorf("title, base and head are required")
+	}
+	for _, p := range f.pulls[repo] {
+		if p.State == "open" && p.Head == pr.Head && p.Base == pr.Base {
+			return nil, fmt.Errorf("a pull request for %s into %s already exists: #%d", pr.Head, pr.Base, p.Number)
+		}
+	}
+
+	number := len(f.pulls[repo]) + 1
+	p := &memoryPull{PullRequest: PullRequest{
+		Number: number,
+		Title:  pr.Title,
+		State:  "open",
+		URL:    fmt.Sprintf("memory://%s/pull/%d", repo, number),
+		Base:   pr.Base,
+		Head:   pr.Head,
+		Author: "jarvis",
+	}}
+	f.pulls[repo] = append(f.pulls[repo], p)
+
+	result := p.PullRequest
+	return &result, nil
+}
+
+func (f *MemoryForge) ListPullRequests(ctx context.Context, repo, state string) ([]PullRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if state == "" {
+		state = "open"
+	}
+
+	result := []PullRequest{}
+	for _, p := range f.pulls[repo] {
+		if state == "all" || p.State == state {
+			result = append(result, p.PullRequest)
+		}
+	}
+	return result, nil
+}
+
+func (f *MemoryForge) GetPullRequestDiff(ctx context.Context, repo string, number int) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return "", err
+	}
+	return p.diff, nil
+}
+
+func (f *MemoryForge) Comment(ctx context.Context, repo string, number int, body string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return err
+	}
+	p.comments = append(p.comments, body)
+	return nil
+}
+
+func (f *MemoryForge) ReviewComment(ctx context.Context, repo string, number int, comment ReviewComment) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return err
+	}
+
+	if p.diff != "" && !diffNewLines(p.diff)[comment.Path][comment.Line] {
+		return fmt.Errorf("%s:%d is not part of the diff of %s#%d", comment.Path, comment.Line, repo, number)
+	}
+
+	p.reviewComments = append(p.reviewComments, comment)
+	return nil
+}
+
+// SetDiff sets the diff returned for a pull request
+func (f *MemoryForge) SetDiff(repo string, number int, diff string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return err
+	}
+	p.diff = diff
+	return nil
+}
+
+// Comments returns the general comments posted on a pull request
+func (f *MemoryForge) Comments(repo string, number int) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return nil
+	}
+	return append([]string(nil), p.comments...)
+}
+
+// ReviewComments returns the inline comments posted on a pull request
+func (f *MemoryForge) ReviewComments(repo string, number int) []ReviewComment {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.find(repo, number)
+	if err != nil {
+		return nil
+	}
+	return append([]ReviewComment(nil), p.reviewComments...)
+}
@@ -0,0 +1,359 @@
+package jarvisTools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitTimeout bounds a single git command; clones of large local
+// repositories are the slowest operation
+const gitTimeout = 2 * time.Minute
+
+// resolveWorkingDir checks that a git tool was given an existing directory
+// to run in, rather than falling back to the process working directory
+func resolveWorkingDir(workingDir string) (string, error) {
+	if workingDir == "" {
+		return "", fmt.Errorf("working_dir is required")
+	}
+
+	dir, err := filepath.Abs(workingDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid working_dir: %v", err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("working_dir %s does not exist", dir)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("working_dir %s is not a directory", dir)
+	}
+
+	return dir, nil
+}
+
+// checkRef rejects a ref that git would parse as an option
+func checkRef(field, ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid %s %q: must not start with '-'", field, ref)
+	}
+	return nil
+}
+
+// runGit runs git with args in workingDir
+func runGit(ctx context.Context, workingDir string, args ...string) (*ExecResult, error) {
+	dir, err := resolveWorkingDir(workingDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Never block on a credential or editor prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true")
+
+	result, err := runCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %v", args[0], err)
+	}
+
+	return result, nil
+}
+
+// gitOutput runs git and returns its rendered result
+func gitOutput(ctx context.Context, workingDir string, args ...string) (string, error) {
+	result, err := runGit(ctx, workingDir, args...)
+	if err != nil {
+		return "", err
+	}
+	return result.Render(), nil
+}
+
+type GitStatusTool struct{}
+
+func (t GitStatusTool) Name() string {
+	return "git_status"
+}
+
+func (t GitStatusTool) Description() string {
+	return "Show the current branch and changed files of a git repository. Input should be JSON with 'working_dir'."
+}
+
+func (t GitStatusTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string `json:"working_dir"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	return gitOutput(ctx, args.WorkingDir, "status", "--short", "--branch")
+}
+
+type GitDiffTool struct{}
+
+func (t GitDiffTool) Name() string {
+	return "git_diff"
+}
+
+func (t GitDiffTool) Description() string {
+	return "Show changes in a git repository. Input should be JSON with 'working_dir', optional 'staged' (show staged changes), optional 'ref' (compare against a branch or commit), optional 'paths' array and optional 'stat' (summary only) fields."
+}
+
+func (t GitDiffTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string   `json:"working_dir"`
+		Staged     bool     `json:"staged"`
+		Ref        string   `json:"ref"`
+		Paths      []string `json:"paths"`
+		Stat       bool     `json:"stat"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	gitArgs := []string{"diff"}
+	if args.Staged {
+		gitArgs = append(gitArgs, "--cached")
+	}
+	if args.Stat {
+		gitArgs = append(gitArgs, "--stat")
+	}
+	if args.Ref != "" {
+		if err := checkRef("ref", args.Ref); err != nil {
+			return "", err
+		}
+		gitArgs = append(gitArgs, args.Ref)
+	}
+	gitArgs = append(gitArgs, "--")
+	gitArgs = append(gitArgs, args.Paths...)
+
+	result, err := runGit(ctx, args.WorkingDir, gitArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	if result.Success() && result.Stdout == "" && result.Stderr == "" {
+		return "No changes", nil
+	}
+
+	return result.Render(), nil
+}
+
+type GitLogTool struct{}
+
+func (t GitLogTool) Name() string {
+	return "git_log"
+}
+
+func (t GitLogTool) Description() string {
+	return "Show commit history of a git repository. Input should be JSON with 'working_dir', optional 'max_count' (default 10), optional 'ref' (branch or range) and optional 'path' fields."
+}
+
+func (t GitLogTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string `json:"working_dir"`
+		MaxCount   int    `json:"max_count"`
+		Ref        string `json:"ref"`
+		Path       string `json:"path"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if args.MaxCount <= 0 {
+		args.MaxCount = 10
+	}
+
+	gitArgs := []string{"log", fmt.Sprintf("--max-count=%d", args.MaxCount), "--date=short", "--pretty=format:%h %ad %an: %s"}
+	if args.Ref != "" {
+		if err := checkRef("ref", args.Ref); err != nil {
+			return "", err
+		}
+		gitArgs = append(gitArgs, args.Ref)
+	}
+	if args.Path != "" {
+		gitArgs = append(gitArgs, "--", args.Path)
+	}
+
+	return gitOutput(ctx, args.WorkingDir, gitArgs...)
+}
+
+type GitBranchTool struct{}
+
+func (t GitBranchTool) Name() string {
+	return "git_branch"
+}
+
+func (t GitBranchTool) Description() string {
+	return "List, create or switch git branches. Input should be JSON with 'working_dir', 'action' (list, create or switch; default list), 'name' for create/switch, optional 'start_point' for create and optional 'checkout' (switch to the branch after creating it) fields."
+}
+
+func (t GitBranchTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir string `json:"working_dir"`
+		Action     string `json:"action"`
+		Name       string `json:"name"`
+		StartPoint string `json:"start_point"`
+		Checkout   bool   `json:"checkout"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if err := checkRef("name", args.Name); err != nil {
+		return "", err
+	}
+	if err := checkRef("start_point", args.StartPoint); err != nil {
+		return "", err
+	}
+
+	var gitArgs []string
+	switch strings.ToLower(args.Action) {
+	case "", "list":
+		gitArgs = []string{"branch", "--list", "-vv"}
+	case "create":
+		if args.Name == "" {
+			return "", fmt.Errorf("name is required to create a branch")
+		}
+		if args.Checkout {
+			gitArgs = []string{"switch", "-c", args.Name}
+		} else {
+			gitArgs = []string{"branch", args.Name}
+		}
+		if args.StartPoint != "" {
+			gitArgs = append(gitArgs, args.StartPoint)
+		}
+	case "switch":
+		if args.Name == "" {
+			return "", fmt.Errorf("name is required to switch branches")
+		}
+		gitArgs = []string{"switch", args.Name}
+	default:
+		return "", fmt.Errorf("unsupported branch action: %s", args.Action)
+	}
+
+	return gitOutput(ctx, args.WorkingDir, gitArgs...)
+}
+
+type GitStashTool struct{}
+
+func (t GitStashTool) Name() string {
+	return "git_stash"
+}
+
+func (t GitStashTool) Description() string {
+	return "Stash or restore uncommitted changes. Input should be JSON with 'working_dir', 'action' (push, pop, apply, list or drop; default push), optional 'message' and 'include_untracked' for push, and optional 'index' (stash entry number) for pop, apply and drop."
+}
+
+func (t GitStashTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		WorkingDir       string `json:"working_dir"`
+		Action           string `json:"action"`
+		Message          string `json:"message"`
+		IncludeUntracked bool   `json:"include_untracked"`
+		Index            *int   `json:"index"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	var gitArgs []string
+	switch action := strings.ToLower(args.Action); action {
+	case "", "push", "save":
+		gitArgs = []string{"stash", "push"}
+		if args.IncludeUntracked {
+			gitArgs = append(gitArgs, "--include-untracked")
+		}
+		if args.Message != "" {
+			gitArgs = append(gitArgs, "-m", args.Message)
+		}
+	case "pop", "apply", "drop":
+		gitArgs = []string{"stash", action}
+		if args.Index != nil {
+			gitArgs = append(gitArgs, fmt.Sprintf("stash@{%d}", *args.Index))
+		}
+	case "list":
+		gitArgs = []string{"stash", "list"}
+	default:
+		return "", fmt.Errorf("unsupported stash action: %s", args.Action)
+	}
+
+	return gitOutput(ctx, args.WorkingDir, gitArgs...)
+}
+
+type GitCloneTool struct{}
+
+func (t GitCloneTool) Name() string {
+	return "git_clone"
+}
+
+func (t GitCloneTool) Description() string {
+	return "Clone a git repository from a local path. Input should be JSON with 'source' (path to an existing repository), 'destination' (resolved against working_dir when relative), 'working_dir', optional 'branch' and optional 'depth' fields."
+}
+
+func (t GitCloneTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		Source      string `json:"source"`
+		Destination string `json:"destination"`
+		WorkingDir  string `json:"working_dir"`
+		Branch      string `json:"branch"`
+		Depth       int    `json:"depth"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if args.Source == "" || args.Destination == "" {
+		return "", fmt.Errorf("source and destination are required")
+	}
+
+	// Only local repositories can be cloned; remote URLs are rejected so
+	// the agent can't pull arbitrary code from the network
+	source := args.Source
+	if !filepath.IsAbs(source) && args.WorkingDir != "" {
+		source = filepath.Join(args.WorkingDir, source)
+	}
+	info, err := os.Stat(source)
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("source %s is not a local directory", args.Source)
+	}
+	source, err = filepath.Abs(source)
+	if err != nil {
+		return "", fmt.Errorf("invalid source: %v", err)
+	}
+
+	if err := checkRef("branch", args.Branch); err != nil {
+		return "", err
+	}
+
+	gitArgs := []string{"clone"}
+	if args.Branch != "" {
+		gitArgs = append(gitArgs, "--branch", args.Branch)
+	}
+	if args.Depth > 0 {
+		// --depth is ignored for plain local paths, file:// honours it
+		gitArgs = append(gitArgs, fmt.Sprintf("--depth=%d", args.Depth))
+		source = "file://" + source
+	}
+	// git clone keeps parsing options after the repository, so "--" stops
+	// a destination such as --upload-pack=... from being read as one
+	gitArgs = append(gitArgs, "--", source, args.Destination)
+
+	return gitOutput(ctx, args.WorkingDir, gitArgs...)
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/tmc/langchaingo/tools"
@@ -28,7 +30,8 @@ func NewGUIControlTool() *GUIControlTool {
 	return &GUIControlTool{
 		daemonURL: daemonURL,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			// Long enough for wait_until, which the daemon caps at 2 minutes
+			Timeout: 150 * time.Second,
 		},
 	}
 }
@@ -47,13 +50,34 @@ Available actions:
 - scroll: Scroll in direction. Params: {"direction": "down", "scrollCount": 3}
 - type_text: Type text string. Params: {"text": "Hello World", "delay": 0}
 - type_keys: Press key combination. Params: {"keys": ["ctrl", "c"]}
-- paste_text: Paste text via clipboard. Params: {"text": "Hello World"}
-- screenshot: Capture screen (returns base64 PNG)
+- paste_text: Paste text via clipboard. Params: {"text": "Hello World", "restore": true} (restore puts the previous clipboard back)
+- clipboard_get: Read the clipboard. Optional params: {"format": "text"|"image"|"files"} (default: whatever it holds; copy in the app first with type_keys ctrl+c)
+- clipboard_set: Set the clipboard. Params: {"text": "..."} or {"image": "base64png"} or {"files": ["report.pdf"]} (paths in the file root, as for read_file)
+- screenshot: Capture screen (returns base64 image). Optional params: {"region": {"x": 0, "y": 0, "width": 800, "height": 600}} or {"window": {"title": "Firefox"}}, "format": "png"|"jpeg", "quality": 80, "maxWidth": 1280, "maxHeight": 800. The result includes the scale factor and screen size; screen coordinates are region origin + image coordinates / scale
 - cursor_position: Get current cursor position
-- application: Launch application. Params: {"application": "firefox"} (firefox|vscode|terminal|directory)
+- find_image: Locate a known icon or image on screen. Params: {"template": "base64png", "tolerance": 0.05, "region": {"x": 0, "y": 0, "width": 800, "height": 600}, "maxMatches": 20} (returns matches with center coordinates and scores)
+- pixel_color: Get the color of a pixel. Params: {"coordinates": {"x": 100, "y": 200}}
+- wait_for_pixel: Wait until a pixel has a color. Params: {"coordinates": {"x": 100, "y": 200}, "color": "#ffffff", "tolerance": 10, "timeout": 10000}
+- list_windows: List open windows with id, title, pid, geometry and focus
+- activate_window: Focus a window. Params: {"title": "Firefox"} or {"pid": 1234} or {"windowId": "0x01e00003"}
+- move_window: Move a window (default: focused window). Params: {"title": "Firefox", "coordinates": {"x": 0, "y": 0}}
+- resize_window: Resize a window (default: focused window). Params: {"title": "Firefox", "width": 1280, "height": 720}
+- minimize_window, maximize_window, close_window: Params: {"title": "Firefox"} (default: focused window)
+- application: Launch application. Params: {"application": "firefox", "args": ["https://example.com"], "wait": true, "timeout": 30000} (firefox|thunderbird|vscode|terminal|directory|desktop or a name from the daemon's apps.json) or {"desktopEntry": "org.gnome.Calculator", "wait": true}. Returns the PID and, with wait, the new window
 - write_file: Write file. Params: {"path": "test.txt", "data": "base64encodeddata"}
 - read_file: Read file. Params: {"path": "test.txt"}
+- list_dir: List a directory. Params: {"path": "reports"} (default: the file root)
+- stat: Get size, type and modification time of a file or directory. Params: {"path": "test.txt"}
+- delete_file: Delete a file or empty directory. Params: {"path": "test.txt", "recursive": false}
+  File paths are relative to the daemon's file root (default ~/Desktop); paths outside it are rejected
 - wait: Delay execution. Params: {"duration": 1000} (milliseconds)
+- wait_until: Wait until a condition holds (prefer this over wait). Params: {"condition": "...", "timeout": 10000} plus, per condition:
+  region_changed / region_stable: optional "region", "threshold", "stableFor" (ms)
+  image_appears / image_disappears: "template" (base64 image), optional "tolerance", "region"
+  pixel_color: "coordinates", "color" ("#rrggbb"), optional "tolerance" (0-255)
+  window_exists: "window" ({"title": "Firefox"})
+
+Every action accepts an optional "session" naming a virtual display started with gui_session; without it actions run on the main display.
 
 Example input: {"action": "type_text", "text": "Hello World"}`
 }
@@ -72,7 +96,7 @@ func (t GUIControlTool) Call(ctx context.Context, input string) (string, error)
 	}
 
 	// Send request to GUI daemon
-	response, err := t.sendAction(actionRequest)
+	response, err := t.sendAction(ctx, actionRequest)
 	if err != nil {
 		return "", err
 	}
@@ -82,21 +106,41 @@ func (t GUIControlTool) Call(ctx context.Context, input string) (string, error)
 }
 
 // sendAction sends action to GUI daemon
-func (t *GUIControlTool) sendAction(action map[string]interface{}) (map[string]interface{}, error) {
+func (t *GUIControlTool) sendAction(ctx context.Context, action map[string]interface{}) (map[string]interface{}, error) {
+	return t.post(ctx, "/computer-use", action)
+}
+
+// post sends a request body to a GUI daemon endpoint
+func (t *GUIControlTool) post(ctx context.Context, path string, body interface{}) (map[string]interface{}, error) {
 	// Marshal request
-	requestBody, err := json.Marshal(action)
+	requestBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
 	// Create request
-	req, err := http.NewRequest("POST", t.daemonURL+"/computer-use", bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", t.daemonURL+path, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
+	return t.do(req)
+}
+
+// get fetches a GUI daemon endpoint
+func (t *GUIControlTool) get(ctx context.Context, path string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.daemonURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	return t.do(req)
+}
+
+// do sends a request to the GUI daemon and checks its response
+func (t *GUIControlTool) do(req *http.Request) (map[string]interface{}, error) {
 	// Send request
 	resp, err := t.client.Do(req)
 	if err != nil {
@@ -134,7 +178,9 @@ func (t *GUIControlTool) formatResponse(action string, response map[string]inter
 	case "screenshot":
 		if data, ok := response["data"].(map[string]interface{}); ok {
 			if image, ok := data["image"].(string); ok {
-				return fmt.Sprintf("Screenshot captured successfully (base64 length: %d)", len(image)), nil
+				return fmt.Sprintf("Screenshot captured successfully (%v, %vx%v, scale %v, region %v, screen %vx%v, base64 length: %d)",
+					data["mediaType"], data["width"], data["height"], data["scale"], data["region"],
+					data["screenWidth"], data["screenHeight"], len(image)), nil
 			}
 		}
 		return "Screenshot captured successfully", nil
@@ -147,8 +193,68 @@ func (t *GUIControlTool) formatResponse(action string, response map[string]inter
 		}
 		return "Cursor position retrieved", nil
 
+	case "find_image":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			if found, _ := data["found"].(bool); !found {
+				return "Image not found on screen", nil
+			}
+			matches, _ := json.Marshal(data["matches"])
+			return fmt.Sprintf("Image found: %s", matches), nil
+		}
+		return "Image search completed", nil
+
+	case "pixel_color", "wait_for_pixel":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			return fmt.Sprintf("Pixel (%v, %v) color: %v", data["x"], data["y"], data["color"]), nil
+		}
+		return "Pixel color retrieved", nil
+
+	case "wait_until":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			return fmt.Sprintf("Condition %v met after %v ms", data["condition"], data["elapsed"]), nil
+		}
+		return "Condition met", nil
+
+	case "clipboard_get":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			switch data["format"] {
+			case "text":
+				return fmt.Sprintf("Clipboard text: %v", data["text"]), nil
+			case "image":
+				image, _ := data["image"].(string)
+				return fmt.Sprintf("Clipboard holds a PNG image (base64 length: %d)", len(image)), nil
+			case "files":
+				files, _ := json.Marshal(data["files"])
+				return fmt.Sprintf("Clipboard files: %s", files), nil
+			}
+		}
+		return "Clipboard is empty", nil
+
+	case "clipboard_set":
+		return "Clipboard set successfully", nil
+
+	case "application":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			if window, ok := data["window"].(map[string]interface{}); ok {
+				return fmt.Sprintf("Application %v started (pid %v); window %v %q appeared after %v ms",
+					data["application"], data["pid"], window["id"], window["title"], data["elapsed"]), nil
+			}
+			return fmt.Sprintf("Application %v started (pid %v)", data["application"], data["pid"]), nil
+		}
+		return "Application started", nil
+
+	case "list_windows":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			windows, _ := json.Marshal(data["windows"])
+			return fmt.Sprintf("Open windows: %s", windows), nil
+		}
+		return "No windows found", nil
+
 	case "read_file":
 		if data, ok := response["data"].(map[string]interface{}); ok {
+			if success, ok := data["success"].(bool); ok && !success {
+				return fmt.Sprintf("Failed to read file: %v", data["message"]), nil
+			}
 			name := data["name"]
 			size := data["size"]
 			mediaType := data["mediaType"]
@@ -156,6 +262,30 @@ func (t *GUIControlTool) formatResponse(action string, response map[string]inter
 		}
 		return "File read successfully", nil
 
+	case "list_dir":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			entries, _ := json.Marshal(data["entries"])
+			return fmt.Sprintf("Contents of %v: %s", data["path"], entries), nil
+		}
+		return "Directory listed", nil
+
+	case "stat":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			if isDir, _ := data["isDir"].(bool); isDir {
+				return fmt.Sprintf("%v: directory, modified %v", data["path"], data["modTime"]), nil
+			}
+			return fmt.Sprintf("%v: %v bytes, %v, modified %v", data["path"], data["size"], data["mediaType"], data["modTime"]), nil
+		}
+		return "File info retrieved", nil
+
+	case "delete_file":
+		if data, ok := response["data"].(map[string]interface{}); ok {
+			if message, ok := data["message"].(string); ok {
+				return message, nil
+			}
+		}
+		return "File deleted successfully", nil
+
 	case "write_file":
 		if data, ok := response["data"].(map[string]interface{}); ok {
 			if message, ok := data["message"].(string); ok {
@@ -297,18 +427,216 @@ func (t ScreenshotTool) Name() string {
 }
 
 func (t ScreenshotTool) Description() string {
-	return "Capture a screenshot of the current screen. Returns base64-encoded PNG image. No input required (use empty JSON {})."
+	return "Capture a screenshot of the current screen. Input is JSON (use empty JSON {} for the full screen as PNG) with optional 'region' ({x, y, width, height}), 'window' ({title} or {pid}), 'format' (png or jpeg), 'quality' and 'maxWidth'/'maxHeight' to downscale."
 }
 
 func (t ScreenshotTool) Call(ctx context.Context, input string) (string, error) {
-	action := map[string]interface{}{
-		"action": "screenshot",
+	action := map[string]interface{}{}
+	if strings.TrimSpace(input) != "" {
+		if err := json.Unmarshal([]byte(input), &action); err != nil {
+			return "", fmt.Errorf("invalid input JSON: %v", err)
+		}
+	}
+	action["action"] = "screenshot"
+
+	actionJSON, _ := json.Marshal(action)
+	return t.guiControl.Call(ctx, string(actionJSON))
+}
+
+// WaitUntilTool - Specialized tool for waiting on screen conditions
+type WaitUntilTool struct {
+	guiControl *GUIControlTool
+}
+
+func (t WaitUntilTool) Name() string {
+	return "wait_until"
+}
+
+func (t WaitUntilTool) Description() string {
+	return "Wait until the screen reaches a state instead of sleeping a fixed time. Input should be JSON with 'condition' (region_changed, region_stable, image_appears, image_disappears, pixel_color or window_exists), optional 'timeout' in milliseconds (default 10000), and the condition's parameters: 'region' ({x, y, width, height}), 'template' (base64 image), 'coordinates' and 'color' (#rrggbb), or 'window' ({title})."
+}
+
+func (t WaitUntilTool) Call(ctx context.Context, input string) (string, error) {
+	var action map[string]interface{}
+	if err := json.Unmarshal([]byte(input), &action); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
 	}
+	action["action"] = "wait_until"
 
 	actionJSON, _ := json.Marshal(action)
 	return t.guiControl.Call(ctx, string(actionJSON))
 }
 
+// GUIBatchTool runs several GUI actions in order without other callers'
+// input interleaving
+type GUIBatchTool struct {
+	guiControl *GUIControlTool
+}
+
+func (t GUIBatchTool) Name() string {
+	return "gui_batch"
+}
+
+func (t GUIBatchTool) Description() string {
+	return `Run a sequence of gui_control actions in order as one step, e.g. click a field, type text and press enter. Input should be JSON with 'actions' (array of gui_control action objects), optional 'session' (virtual display from gui_session) and optional 'continueOnError' (default false: stop at the first failing action).
+
+Example input: {"actions": [{"action": "click_mouse", "button": "left", "coordinates": {"x": 400, "y": 300}}, {"action": "type_text", "text": "hello"}, {"action": "type_keys", "keys": ["enter"]}]}`
+}
+
+func (t GUIBatchTool) Call(ctx context.Context, input string) (string, error) {
+	var batch struct {
+		Session         string                   `json:"session,omitempty"`
+		Actions         []map[string]interface{} `json:"actions"`
+		ContinueOnError bool                     `json:"continueOnError,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &batch); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+	if len(batch.Actions) == 0 {
+		return "", fmt.Errorf("actions is empty")
+	}
+
+	response, err := t.guiControl.post(ctx, "/computer-use/batch", batch)
+	if err != nil {
+		return "", err
+	}
+
+	data, _ := response["data"].(map[string]interface{})
+	steps, _ := data["steps"].([]interface{})
+
+	var sb strings.Builder
+	for _, raw := range steps {
+		step, _ := raw.(map[string]interface{})
+		if ok, _ := step["success"].(bool); ok {
+			fmt.Fprintf(&sb, "%v. %v: ok (%v ms)\n", step["index"], step["action"], step["duration"])
+		} else {
+			fmt.Fprintf(&sb, "%v. %v: failed: %v\n", step["index"], step["action"], step["error"])
+		}
+	}
+	if skipped, ok := data["skipped"].(float64); ok && skipped > 0 {
+		fmt.Fprintf(&sb, "%d remaining actions skipped\n", int(skipped))
+	}
+
+	if ok, _ := data["success"].(bool); ok {
+		return "All actions succeeded:\n" + sb.String(), nil
+	}
+	return "Batch did not fully succeed:\n" + sb.String(), nil
+}
+
+// GUIMacroTool lists and replays macros recorded on the GUI daemon
+type GUIMacroTool struct {
+	guiControl *GUIControlTool
+}
+
+func (t GUIMacroTool) Name() string {
+	return "gui_macro"
+}
+
+func (t GUIMacroTool) Description() string {
+	return "Replay a workflow the owner recorded by demonstration. Input should be JSON with 'action' ('list' to see the recorded macros, or 'replay'), 'name' of the macro to replay, optional 'speed' (e.g. 2 for twice as fast) and optional 'session' (virtual display from gui_session; without it the macro replays on the main display)."
+}
+
+func (t GUIMacroTool) Call(ctx context.Context, input string) (string, error) {
+	var params struct {
+		Action  string  `json:"action"`
+		Name    string  `json:"name"`
+		Speed   float64 `json:"speed,omitempty"`
+		Session string  `json:"session,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	switch params.Action {
+	case "list", "":
+		response, err := t.guiControl.get(ctx, "/macros")
+		if err != nil {
+			return "", err
+		}
+		macros, _ := json.Marshal(response["data"])
+		return fmt.Sprintf("Recorded macros: %s", macros), nil
+
+	case "replay":
+		if params.Name == "" {
+			return "", fmt.Errorf("name is required")
+		}
+		response, err := t.guiControl.post(ctx, "/macros/"+url.PathEscape(params.Name)+"/replay", map[string]interface{}{"speed": params.Speed, "session": params.Session})
+		if err != nil {
+			return "", err
+		}
+		data, _ := response["data"].(map[string]interface{})
+		if ok, _ := data["success"].(bool); ok {
+			return fmt.Sprintf("Macro %s replayed successfully", params.Name), nil
+		}
+		steps, _ := json.Marshal(data["steps"])
+		return fmt.Sprintf("Macro %s stopped at a failing step: %s", params.Name, steps), nil
+
+	default:
+		return "", fmt.Errorf("unknown action %q; use list or replay", params.Action)
+	}
+}
+
+// GUISessionTool manages isolated virtual displays on the GUI daemon
+type GUISessionTool struct {
+	guiControl *GUIControlTool
+}
+
+func (t GUISessionTool) Name() string {
+	return "gui_session"
+}
+
+func (t GUISessionTool) Description() string {
+	return "Manage isolated virtual displays so GUI tasks can run side by side without sharing a mouse and keyboard. Input should be JSON with 'action': 'create' (optional 'id', 'width', 'height'; returns the session id to pass as 'session' to gui_control and gui_batch), 'list', or 'close' with 'id'. Close sessions when the task is done."
+}
+
+func (t GUISessionTool) Call(ctx context.Context, input string) (string, error) {
+	var params struct {
+		Action string `json:"action"`
+		ID     string `json:"id,omitempty"`
+		Width  int    `json:"width,omitempty"`
+		Height int    `json:"height,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(input), &params); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	switch params.Action {
+	case "list", "":
+		response, err := t.guiControl.get(ctx, "/sessions")
+		if err != nil {
+			return "", err
+		}
+		sessions, _ := json.Marshal(response["data"])
+		return fmt.Sprintf("Active sessions: %s", sessions), nil
+
+	case "create":
+		response, err := t.guiControl.post(ctx, "/sessions", map[string]interface{}{
+			"id": params.ID, "width": params.Width, "height": params.Height,
+		})
+		if err != nil {
+			return "", err
+		}
+		data, _ := response["data"].(map[string]interface{})
+		return fmt.Sprintf("Session %v started on display %v (%vx%v)", data["id"], data["display"], data["width"], data["height"]), nil
+
+	case "close":
+		if params.ID == "" {
+			return "", fmt.Errorf("id is required")
+		}
+		req, err := http.NewRequestWithContext(ctx, "DELETE", t.guiControl.daemonURL+"/sessions/"+url.PathEscape(params.ID), nil)
+		if err != nil {
+			return "", fmt.Errorf("failed to create request: %v", err)
+		}
+		if _, err := t.guiControl.do(req); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Session %s closed", params.ID), nil
+
+	default:
+		return "", fmt.Errorf("unknown action %q; use create, list or close", params.Action)
+	}
+}
+
 // GetGUITools returns all GUI control tools
 func GetGUITools() []tools.Tool {
 	guiControl := NewGUIControlTool()
@@ -319,5 +647,9 @@ func GetGUITools() []tools.Tool {
 		ClickMouseTool{guiControl: guiControl},
 		TypeTextTool{guiControl: guiControl},
 		ScreenshotTool{guiControl: guiControl},
+		WaitUntilTool{guiControl: guiControl},
+		GUIBatchTool{guiControl: guiControl},
+		GUIMacroTool{guiControl: guiControl},
+		GUISessionTool{guiControl: guiControl},
 	}
 }
@@ -0,0 +1,237 @@
+package jarvisTools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sandboxBinary is the name compiled languages build their program to
+const sandboxBinary = "jarvis_prog"
+
+// sandboxStep is a command run in the sandbox before the program itself
+type sandboxStep struct {
+	stage string // "install" or "build"
+	args  []string
+}
+
+// languageSpec describes how run_code prepares and runs a language
+type languageSpec struct {
+	// entry is the file the 'code' field is written to
+	entry string
+	// projectEntries overrides entry when a project manifest is present,
+	// e.g. Cargo.toml moves the entry to src/main.rs
+	projectEntries map[string]string
+	// mode is the permission the entry file is written with
+	mode os.FileMode
+	// prepare returns the steps that must succeed before running
+	prepare func(dir, entry string) []sandboxStep
+	// run returns the command that runs the program
+	run func(dir, entry string) []string
+}
+
+var languageSpecs = map[string]languageSpec{
+	"go": {
+		entry:   "main.go",
+		prepare: goPrepare,
+		run: func(dir, entry string) []string {
+			return []string{"go", "run", "./" + filepath.ToSlash(filepath.Dir(entry))}
+		},
+	},
+	"python": {
+		entry:   "main.py",
+		prepare: dependencySteps,
+		run: func(dir, entry string) []string {
+			python := "python3"
+			if fileExists(filepath.Join(dir, ".venv", "bin", "python")) {
+				python = filepath.Join(".venv", "bin", "python")
+			}
+			return []string{python, entry}
+		},
+	},
+	"javascript": {
+		entry:   "main.js",
+		prepare: dependencySteps,
+		run: func(dir, entry string) []string {
+			return []string{"node", entry}
+		},
+	},
+	"typescript": {
+		entry:   "main.ts",
+		prepare: dependencySteps,
+		run: func(dir, entry string) []string {
+			// npx prefers a tsx installed from package.json over downloading one
+			return []string{"npx", "--yes", "tsx", entry}
+		},
+	},
+	"ruby": {
+		entry:   "main.rb",
+		prepare: dependencySteps,
+		run: func(dir, entry string) []string {
+			if fileExists(filepath.Join(dir, "Gemfile")) {
+				return []string{"bundle", "exec", "ruby", entry}
+			}
+			return []string{"ruby", entry}
+		},
+	},
+	"rust": {
+		entry:          "main.rs",
+		projectEntries: map[string]string{"Cargo.toml": "src/main.rs"},
+		prepare: func(dir, entry string) []sandboxStep {
+			if fileExists(filepath.Join(dir, "Cargo.toml")) {
+				return []sandboxStep{{stage: "build", args: []string{"cargo", "build", "--quiet"}}}
+			}
+			return []sandboxStep{{stage: "build", args: []string{"rustc", "-O", "-o", sandboxBinary, entry}}}
+		},
+		run: func(dir, entry string) []string {
+			if fileExists(filepath.Join(dir, "Cargo.toml")) {
+				return []string{"cargo", "run", "--quiet"}
+			}
+			return []string{"./" + sandboxBinary}
+		},
+	},
+	"c": {
+		entry: "main.c",
+		prepare: func(dir, entry string) []sandboxStep {
+			args := []string{"gcc", "-O2", "-o", sandboxBinary}
+			args = append(args, sourceFiles(dir, ".c")...)
+			return []sandboxStep{{stage: "build", args: append(args, "-lm")}}
+		},
+		run: runSandboxBinary,
+	},
+	"cpp": {
+		entry: "main.cpp",
+		prepare: func(dir, entry string) []sandboxStep {
+			args := []string{"g++", "-O2", "-std=c++17", "-o", sandboxBinary}
+			args = append(args, sourceFiles(dir, ".cpp", ".cc", ".cxx")...)
+			return []sandboxStep{{stage: "build", args: args}}
+		},
+		run: runSandboxBinary,
+	},
+	"java": {
+		entry: "Main.java",
+		prepare: func(dir, entry string) []sandboxStep {
+			args := []string{"javac", "-d", "classes"}
+			args = append(args, sourceFiles(dir, ".java")...)
+			return []sandboxStep{{stage: "build", args: args}}
+		},
+		run: func(dir, entry string) []string {
+			// The main class is derived from the entry path, so
+			// com/example/App.java runs com.example.App
+			mainClass := strings.TrimSuffix(filepath.ToSlash(entry), ".java")
+			return []string{"java", "-cp", "classes", strings.ReplaceAll(mainClass, "/", ".")}
+		},
+	},
+	"bash": {
+		entry:   "main.sh",
+		mode:    0755,
+		prepare: dependencySteps,
+		run: func(dir, entry string) []string {
+			return []string{"bash", entry}
+		},
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang":  "go",
+	"py":      "python",
+	"python3": "python",
+	"js":      "javascript",
+	"node":    "javascript",
+	"nodejs":  "javascript",
+	"ts":      "typescript",
+	"rb":      "ruby",
+	"rs":      "rust",
+	"c++":     "cpp",
+	"cxx":     "cpp",
+	"sh":      "bash",
+	"shell":   "bash",
+}
+
+// lookupLanguage resolves a language name or alias to its spec
+func lookupLanguage(language string) (string, languageSpec, bool) {
+	name := strings.ToLower(strings.TrimSpace(language))
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	spec, ok := languageSpecs[name]
+	return name, spec, ok
+}
+
+// entryFor returns the file 'code' is written to given the supplied files
+func (s languageSpec) entryFor(files map[string]string) string {
+	for manifest, entry := range s.projectEntries {
+		if _, ok := files[manifest]; ok {
+			return entry
+		}
+	}
+	return s.entry
+}
+
+func goPrepare(dir, entry string) []sandboxStep {
+	var steps []sandboxStep
+	if !fileExists(filepath.Join(dir, "go.mod")) {
+		steps = append(steps, sandboxStep{stage: "install", args: []string{"go", "mod", "init", "sandbox"}})
+	}
+	// tidy downloads whatever go.mod and the imports require
+	return append(steps, sandboxStep{stage: "install", args: []string{"go", "mod", "tidy"}})
+}
+
+// dependencySteps installs dependencies declared by manifests in dir into the sandbox
+func dependencySteps(dir, entry string) []sandboxStep {
+	var steps []sandboxStep
+
+	if fileExists(filepath.Join(dir, "requirements.txt")) {
+		steps = append(steps,
+			sandboxStep{stage: "install", args: []string{"python3", "-m", "venv", ".venv"}},
+			sandboxStep{stage: "install", args: []string{filepath.Join(".venv", "bin", "pip"), "install", "--quiet", "-r", "requirements.txt"}},
+		)
+	}
+
+	if fileExists(filepath.Join(dir, "package.json")) {
+		steps = append(steps, sandboxStep{stage: "install", args: []string{"npm", "install", "--no-audit", "--no-fund"}})
+	}
+
+	if fileExists(filepath.Join(dir, "Gemfile")) {
+		steps = append(steps, sandboxStep{stage: "install", args: []string{"bundle", "install", "--path", "vendor/bundle"}})
+	}
+
+	return steps
+}
+
+func runSandboxBinary(dir, entry string) []string {
+	return []string{"./" + sandboxBinary}
+}
+
+// sourceFiles lists files in dir with one of exts, relative to dir
+func sourceFiles(dir string, exts ...string) []string {
+	var files []string
+
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			switch info.Name() {
+			case ".venv", "node_modules", "target", "vendor":
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(path, ext) {
+				rel, _ := filepath.Rel(dir, path)
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+
+	return files
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
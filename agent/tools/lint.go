@@ -0,0 +1,618 @@
+package jarvisTools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Diagnostic is a single linter finding in a linter-independent form
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintReport is the structured outcome of lint_code
+type LintReport struct {
+	Linter      string       `json:"linter"`
+	Command     string       `json:"command"`
+	ExitCode    int          `json:"exit_code"`
+	Count       int          `json:"count"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+	// Fixed and Diff are set in fix mode; Diagnostics then lists what is left
+	Fixed bool   `json:"fixed,omitempty"`
+	Diff  string `json:"diff,omitempty"`
+	// Output holds the linter's output when it failed without diagnostics,
+	// e.g. because the target doesn't build
+	Output string `json:"output,omitempty"`
+}
+
+// linterSpec describes how to run and parse one linter
+type linterSpec struct {
+	// packages reports whether the linter takes Go package patterns rather
+	// than files and directories
+	packages bool
+	check    func(target string) []string
+	// fix is nil for linters without an autofix mode
+	fix   func(target string) []string
+	parse func(stdout, stderr []byte) []Diagnostic
+}
+
+var linterSpecs = map[string]linterSpec{
+	"golangci-lint": {
+		packages: true,
+		check: func(target string) []string {
+			return []string{"golangci-lint", "run", "--output.json.path=stdout", "--show-stats=false", target}
+		},
+		fix: func(target string) []string {
+			return []string{"golangci-lint", "run", "--fix", target}
+		},
+		parse: parseGolangciLint,
+	},
+	"govet": {
+		packages: true,
+		check: func(target string) []string {
+			return []string{"go", "vet", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parseLocationLines(stderr, "vet", "error")
+		},
+	},
+	"staticcheck": {
+		packages: true,
+		check: func(target string) []string {
+			return []string{"staticcheck", "-f", "json", target}
+		},
+		parse: parseStaticcheck,
+	},
+	"gofmt": {
+		check: func(target string) []string {
+			return []string{"gofmt", "-l", target}
+		},
+		fix: func(target string) []string {
+			return []string{"gofmt", "-w", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parseFileList(stdout, "gofmt", "file is not gofmt-formatted")
+		},
+	},
+	"ruff": {
+		check: func(target string) []string {
+			return []string{"ruff", "check", "--output-format=json", target}
+		},
+		fix: func(target string) []string {
+			return []string{"ruff", "check", "--fix", target}
+		},
+		parse: parseRuff,
+	},
+	"flake8": {
+		check: func(target string) []string {
+			return []string{"flake8", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parseLocationLines(stdout, "", "warning")
+		},
+	},
+	"pylint": {
+		check: func(target string) []string {
+			return []string{"pylint", "--output-format=json", target}
+		},
+		parse: parsePylint,
+	},
+	"black": {
+		check: func(target string) []string {
+			return []string{"black", "--check", target}
+		},
+		fix: func(target string) []string {
+			return []string{"black", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parsePrefixedFiles(stderr, "would reformat ", "black", "file is not black-formatted")
+		},
+	},
+	"eslint": {
+		check: func(target string) []string {
+			return []string{"npx", "--no-install", "eslint", "-f", "json", target}
+		},
+		fix: func(target string) []string {
+			return []string{"npx", "--no-install", "eslint", "--fix", target}
+		},
+		parse: parseESLint,
+	},
+	"prettier": {
+		check: func(target string) []string {
+			return []string{"npx", "--no-install", "prettier", "--list-different", target}
+		},
+		fix: func(target string) []string {
+			return []string{"npx", "--no-install", "prettier", "--write", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parseFileList(stdout, "prettier", "file is not prettier-formatted")
+		},
+	},
+	"jshint": {
+		check: func(target string) []string {
+			return []string{"jshint", "--reporter=unix", target}
+		},
+		parse: func(stdout, stderr []byte) []Diagnostic {
+			return parseLocationLines(stdout, "jshint", "warning")
+		},
+	},
+}
+
+// lintLanguages lists the linters each language accepts and the file
+// extensions they check
+var lintLanguages = map[string]struct {
+	linters []string
+	exts    []string
+}{
+	"go":         {linters: []string{"golangci-lint", "govet", "staticcheck", "gofmt"}, exts: []string{".go"}},
+	"python":     {linters: []string{"ruff", "flake8", "pylint", "black"}, exts: []string{".py"}},
+	"javascript": {linters: []string{"eslint", "prettier", "jshint"}, exts: []string{".js", ".jsx", ".mjs", ".cjs"}},
+	"typescript": {linters: []string{"eslint", "prettier"}, exts: []string{".ts", ".tsx"}},
+}
+
+// defaultLinter picks the linter used when none is given
+func defaultLinter(language string, fix bool) string {
+	switch language {
+	case "go":
+		if _, err := exec.LookPath("golangci-lint"); err == nil {
+			return "golangci-lint"
+		}
+		if fix {
+			return "gofmt"
+		}
+		return "govet"
+	case "python":
+		return "ruff"
+	default:
+		return "eslint"
+	}
+}
+
+func normaliseLintLanguage(language string) string {
+	switch strings.ToLower(language) {
+	case "go", "golang":
+		return "go"
+	case "python", "py":
+		return "python"
+	case "javascript", "js":
+		return "javascript"
+	case "typescript", "ts":
+		return "typescript"
+	}
+	return strings.ToLower(language)
+}
+
+func lintCode(ctx context.Context, path, workingDir, language, linter string, fix bool) (*LintReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	language = normaliseLintLanguage(language)
+	lang, ok := lintLanguages[language]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language for linting: %s", language)
+	}
+
+	linter = strings.ToLower(linter)
+	switch linter {
+	case "":
+		linter = defaultLinter(language, fix)
+	case "vet", "go vet":
+		linter = "govet"
+	}
+
+	supported := false
+	for _, name := range lang.linters {
+		if name == linter {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, fmt.Errorf("unsupported %s linter: %s (supported: %s)", language, linter, strings.Join(lang.linters, ", "))
+	}
+	spec := linterSpecs[linter]
+
+	target := lintTarget(path, workingDir, spec.packages)
+
+	report := &LintReport{Linter: linter}
+
+	if fix {
+		if spec.fix == nil {
+			return nil, fmt.Errorf("%s has no autofix mode", linter)
+		}
+
+		snapshotPath := strings.TrimSuffix(target, "...")
+		if !filepath.IsAbs(snapshotPath) {
+			snapshotPath = filepath.Join(workingDir, snapshotPath)
+		}
+		before := snapshotFiles(snapshotPath, lang.exts)
+
+		result, err := runLinter(ctx, workingDir, spec.fix(target), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("autofix failed: %v", err)
+		}
+		if result.TimedOut {
+			return nil, fmt.Errorf("autofix with %s timed out", linter)
+		}
+
+		report.Fixed = true
+		report.Diff = diffSnapshot(ctx, workingDir, before)
+	}
+
+	// Linters exit non-zero when they report issues, so the exit code is
+	// part of the report rather than an error.
+	var stdout, stderr bytes.Buffer
+	result, err := runLinter(ctx, workingDir, spec.check(target), &stdout, &stderr)
+	if err != nil {
+		return nil, fmt.Errorf("linting failed: %v", err)
+	}
+
+	report.Command = result.Command
+	report.ExitCode = result.ExitCode
+	report.Diagnostics = spec.parse(stdout.Bytes(), stderr.Bytes())
+	if report.Diagnostics == nil {
+		report.Diagnostics = []Diagnostic{}
+	}
+	report.Count = len(report.Diagnostics)
+
+	if report.Count == 0 && !result.Success() {
+		report.Output = strings.TrimSpace(result.Stdout + "\n" + result.Stderr)
+	}
+
+	return report, nil
+}
+
+// lintTarget resolves what the linter is pointed at. Go package linters
+// need "./dir" rather than "dir", which would be read as an import path.
+func lintTarget(path, workingDir string, packages bool) string {
+	if path == "" {
+		if packages {
+			return "./..."
+		}
+		return "."
+	}
+
+	if packages && !filepath.IsAbs(path) && !strings.HasPrefix(path, ".") {
+		if _, err := os.Stat(filepath.Join(workingDir, strings.TrimSuffix(path, "/..."))); err == nil {
+			return "./" + path
+		}
+	}
+
+	if !packages {
+		// Only package linters understand the recursive pattern
+		path = strings.TrimSuffix(strings.TrimSuffix(path, "..."), "/")
+		if path == "" || path == "." {
+			return "."
+		}
+	}
+
+	return path
+}
+
+func runLinter(ctx context.Context, workingDir string, args []string, stdout, stderr *bytes.Buffer) (*ExecResult, error) {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = workingDir
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	if stderr != nil {
+		cmd.Stderr = stderr
+	}
+	return runCommand(ctx, cmd)
+}
+
+// snapshotFiles reads every file under path with one of exts
+func snapshotFiles(path string, exts []string) map[string][]byte {
+	snapshot := make(map[string][]byte)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return snapshot
+	}
+
+	var files []string
+	if info.IsDir() {
+		for _, rel := range sourceFiles(path, exts...) {
+			files = append(files, filepath.Join(path, rel))
+		}
+	} else {
+		files = []string{path}
+	}
+
+	for _, file := range files {
+		if data, err := ioutil.ReadFile(file); err == nil {
+			snapshot[file] = data
+		}
+	}
+
+	return snapshot
+}
+
+// diffSnapshot returns a unified diff of every snapshotted file that changed
+func diffSnapshot(ctx context.Context, workingDir string, before map[string][]byte) string {
+	var diff strings.Builder
+
+	for _, file := range sortedKeys(before) {
+		after, err := ioutil.ReadFile(file)
+		if err != nil || bytes.Equal(after, before[file]) {
+			continue
+		}
+
+		original, err := ioutil.TempFile("", "jarvis_lint_")
+		if err != nil {
+			continue
+		}
+		original.Write(before[file])
+		original.Close()
+
+		name := file
+		if rel, err := filepath.Rel(workingDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+
+		// diff exits 1 when the files differ, which is expected here
+		out, _ := exec.CommandContext(ctx, "diff", "-u", "-L", "a/"+name, "-L", "b/"+name, original.Name(), file).Output()
+		os.Remove(original.Name())
+		diff.Write(out)
+	}
+
+	return diff.String()
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// locationLine matches "file:line:col: message" and "file:line: message",
+// with an optional leading rule code as printed by flake8
+var locationLine = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (?:([A-Z]+\d+) )?(.*)$`)
+
+// parseLocationLines parses linters that print one "file:line:col: message" per finding
+func parseLocationLines(output []byte, rule, severity string) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		m := locationLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		d := Diagnostic{File: m[1], Severity: severity, Rule: rule, Message: m[5]}
+		d.Line, _ = strconv.Atoi(m[2])
+		d.Column, _ = strconv.Atoi(m[3])
+		if m[4] != "" {
+			d.Rule = m[4]
+			if strings.HasPrefix(m[4], "E") || strings.HasPrefix(m[4], "F") {
+				d.Severity = "error"
+			}
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	return diagnostics
+}
+
+// parseFileList parses formatters that list one unformatted file per line
+func parseFileList(output []byte, rule, message string) []Diagnostic {
+	return parsePrefixedFiles(output, "", rule, message)
+}
+
+func parsePrefixedFiles(output []byte, prefix, rule, message string) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     strings.TrimPrefix(line, prefix),
+			Severity: "warning",
+			Rule:     rule,
+			Message:  message,
+		})
+	}
+
+	return diagnostics
+}
+
+func parseGolangciLint(stdout, stderr []byte) []Diagnostic {
+	var out struct {
+		Issues []struct {
+			FromLinter string `json:"FromLinter"`
+			Text       string `json:"Text"`
+			Severity   string `json:"Severity"`
+			Pos        struct {
+				Filename string `json:"Filename"`
+				Line     int    `json:"Line"`
+				Column   int    `json:"Column"`
+			} `json:"Pos"`
+		} `json:"Issues"`
+	}
+	if err := json.Unmarshal(firstJSONLine(stdout), &out); err != nil {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, issue := range out.Issues {
+		severity := strings.ToLower(issue.Severity)
+		if severity == "" {
+			severity = "warning"
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     issue.Pos.Filename,
+			Line:     issue.Pos.Line,
+			Column:   issue.Pos.Column,
+			Severity: severity,
+			Rule:     issue.FromLinter,
+			Message:  issue.Text,
+		})
+	}
+	return diagnostics
+}
+
+func parseStaticcheck(stdout, stderr []byte) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		var issue struct {
+			Code     string `json:"code"`
+			Severity string `json:"severity"`
+			Message  string `json:"message"`
+			Location struct {
+				File   string `json:"file"`
+				Line   int    `json:"line"`
+				Column int    `json:"column"`
+			} `json:"location"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &issue); err != nil {
+			continue
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     issue.Location.File,
+			Line:     issue.Location.Line,
+			Column:   issue.Location.Column,
+			Severity: issue.Severity,
+			Rule:     issue.Code,
+			Message:  issue.Message,
+		})
+	}
+
+	return diagnostics
+}
+
+func parseRuff(stdout, stderr []byte) []Diagnostic {
+	var issues []struct {
+		Code     string `json:"code"`
+		Message  string `json:"message"`
+		Filename string `json:"filename"`
+		Location struct {
+			Row    int `json:"row"`
+			Column int `json:"column"`
+		} `json:"location"`
+	}
+	if err := json.Unmarshal(stdout, &issues); err != nil {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, issue := range issues {
+		severity := "warning"
+		// Syntax errors have no code; pyflakes (F) and pycodestyle errors (E) are errors
+		if issue.Code == "" || strings.HasPrefix(issue.Code, "E") || strings.HasPrefix(issue.Code, "F") {
+			severity = "error"
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     issue.Filename,
+			Line:     issue.Location.Row,
+			Column:   issue.Location.Column,
+			Severity: severity,
+			Rule:     issue.Code,
+			Message:  issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+func parsePylint(stdout, stderr []byte) []Diagnostic {
+	var issues []struct {
+		Type    string `json:"type"`
+		Path    string `json:"path"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Symbol  string `json:"symbol"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(stdout, &issues); err != nil {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, issue := range issues {
+		severity := "info"
+		switch issue.Type {
+		case "error", "fatal":
+			severity = "error"
+		case "warning":
+			severity = "warning"
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			File:     issue.Path,
+			Line:     issue.Line,
+			Column:   issue.Column,
+			Severity: severity,
+			Rule:     issue.Symbol,
+			Message:  issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+func parseESLint(stdout, stderr []byte) []Diagnostic {
+	var files []struct {
+		FilePath string `json:"filePath"`
+		Messages []struct {
+			RuleID   string `json:"ruleId"`
+			Severity int    `json:"severity"`
+			Message  string `json:"message"`
+			Line     int    `json:"line"`
+			Column   int    `json:"column"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(stdout, &files); err != nil {
+		return nil
+	}
+
+	var diagnostics []Diagnostic
+	for _, file := range files {
+		for _, msg := range file.Messages {
+			severity := "warning"
+			if msg.Severity == 2 {
+				severity = "error"
+			}
+			diagnostics = append(diagnostics, Diagnostic{
+				File:     file.FilePath,
+				Line:     msg.Line,
+				Column:   msg.Column,
+				Severity: severity,
+				Rule:     msg.RuleID,
+				Message:  msg.Message,
+			})
+		}
+	}
+	return diagnostics
+}
+
+// firstJSONLine returns the first line of output that looks like a JSON
+// object, skipping any text a tool prints around it
+func firstJSONLine(output []byte) []byte {
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+			return line
+		}
+	}
+	return output
+}
@@ -0,0 +1,165 @@
+package jarvisTools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// packageMirrors holds the local package sources install_package uses in
+// air-gapped environments. Each is read from an environment variable:
+//
+//	PACKAGE_OFFLINE=true   never reach the network; fail if a mirror lacks a package
+//	PIP_FIND_LINKS_DIR     directory of wheels/sdists passed to pip --find-links
+//	NPM_CACHE_DIR          npm cache populated with the needed tarballs (also used by yarn)
+//	GO_MODULE_MIRROR_DIR   module proxy layout served to go as GOPROXY=file://
+//	CARGO_VENDOR_DIR       directory created by `cargo vendor`
+type packageMirrors struct {
+	offline bool
+	pip     string
+	npm     string
+	goProxy string
+	cargo   string
+}
+
+func loadPackageMirrors() packageMirrors {
+	offline := strings.ToLower(os.Getenv("PACKAGE_OFFLINE"))
+	return packageMirrors{
+		offline: offline == "true" || offline == "1" || offline == "yes",
+		pip:     os.Getenv("PIP_FIND_LINKS_DIR"),
+		npm:     os.Getenv("NPM_CACHE_DIR"),
+		goProxy: os.Getenv("GO_MODULE_MIRROR_DIR"),
+		cargo:   os.Getenv("CARGO_VENDOR_DIR"),
+	}
+}
+
+// mirrorFor returns the configured mirror for a package manager and the
+// variable that configures it
+func (m packageMirrors) mirrorFor(manager string) (string, string) {
+	switch manager {
+	case "pip", "pip3":
+		return m.pip, "PIP_FIND_LINKS_DIR"
+	case "npm", "yarn":
+		return m.npm, "NPM_CACHE_DIR"
+	case "go":
+		return m.goProxy, "GO_MODULE_MIRROR_DIR"
+	case "cargo":
+		return m.cargo, "CARGO_VENDOR_DIR"
+	}
+	return "", ""
+}
+
+// apply points the plan's install step at the local mirror. Only installs
+// fetch packages, so uninstall and list are left untouched.
+func (m packageMirrors) apply(manager string, req packageRequest, plan *packagePlan) error {
+	if req.Operation != "install" || len(plan.steps) == 0 {
+		return nil
+	}
+
+	dir, envVar := m.mirrorFor(manager)
+	if dir == "" {
+		if m.offline {
+			return fmt.Errorf("offline mode: no local mirror is configured for %s (set %s)", manager, envVar)
+		}
+		return nil
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", envVar, err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory: %s", envVar, dir)
+	}
+
+	install := len(plan.steps) - 1
+	step := plan.steps[install]
+
+	switch manager {
+	case "pip", "pip3":
+		flags := []string{"--find-links", dir}
+		if m.offline {
+			flags = append(flags, "--no-index")
+		}
+		step = insertAfter(step, 1, flags...)
+
+	case "npm":
+		flags := []string{"--cache", dir, "--prefer-offline"}
+		if m.offline {
+			flags = []string{"--cache", dir, "--offline"}
+		}
+		step = insertAfter(step, 1, flags...)
+
+	case "yarn":
+		plan.env = append(plan.env, "YARN_YARN_OFFLINE_MIRROR="+dir, "YARN_CACHE_FOLDER="+dir)
+		if m.offline {
+			step = append(step, "--offline")
+		}
+
+	case "go":
+		proxy := "file://" + dir
+		if !m.offline {
+			proxy += ",https://proxy.golang.org,direct"
+		}
+		// The checksum database is unreachable offline, so rely on go.sum alone
+		plan.env = append(plan.env, "GOPROXY="+proxy, "GOSUMDB=off")
+
+	case "cargo":
+		flags := []string{
+			"--config", `source.crates-io.replace-with="jarvis-vendored"`,
+			"--config", fmt.Sprintf("source.jarvis-vendored.directory=%q", dir),
+		}
+		if m.offline {
+			flags = append(flags, "--offline")
+		}
+		step = insertAfter(step, 0, flags...)
+	}
+
+	plan.steps[install] = step
+	plan.mirror = dir
+	return nil
+}
+
+// offlineHint explains a failed install in offline mode when the output
+// shows the package wasn't in the mirror
+func (m packageMirrors) offlineHint(manager string, req packageRequest, output string) string {
+	if !m.offline || req.Operation != "install" {
+		return ""
+	}
+
+	var markers []string
+	switch manager {
+	case "pip", "pip3":
+		markers = []string{"No matching distribution found", "Could not find a version"}
+	case "npm":
+		markers = []string{"ENOTCACHED", "E404", "No matching version"}
+	case "yarn":
+		markers = []string{"Couldn't find any versions", "Couldn't find package", "offline mirror"}
+	case "go":
+		markers = []string{"not found", "no such file or directory", "no matching versions", "unknown revision", "module lookup disabled"}
+	case "cargo":
+		markers = []string{"no matching package", "could not find", "failed to select a version"}
+	}
+
+	for _, marker := range markers {
+		if strings.Contains(output, marker) {
+			spec := req.PackageName
+			if req.Version != "" {
+				spec += "@" + req.Version
+			}
+			dir, _ := m.mirrorFor(manager)
+			return fmt.Sprintf("offline: %s is not available in the local %s mirror at %s; add it to the mirror or pick a version it contains\n", spec, manager, dir)
+		}
+	}
+
+	return ""
+}
+
+// insertAfter returns args with extra inserted after index i
+func insertAfter(args []string, i int, extra ...string) []string {
+	out := make([]string, 0, len(args)+len(extra))
+	out = append(out, args[:i+1]...)
+	out = append(out, extra...)
+	return append(out, args[i+1:]...)
+}
@@ -0,0 +1,373 @@
+package jarvisTools
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// packageRequest is the payload accepted by install_package
+type packageRequest struct {
+	Operation      string `json:"operation"`
+	PackageName    string `json:"package_name"`
+	PackageManager string `json:"package_manager"`
+	Version        string `json:"version"`
+	Workspace      string `json:"workspace"`
+	Global         bool   `json:"global"`
+}
+
+// packagePlan is the list of commands that carry out a package operation.
+// Commands run in the workspace and stop at the first failure.
+type packagePlan struct {
+	environment string
+	steps       [][]string
+	// record updates the workspace manifest once every step has succeeded,
+	// for package managers that don't maintain it themselves
+	record func() error
+	// env is added to the environment of every step
+	env []string
+	// mirror is the local package source in use, if any
+	mirror string
+}
+
+func managePackage(ctx context.Context, req packageRequest) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	req.Operation = strings.ToLower(req.Operation)
+	if req.Operation == "" {
+		req.Operation = "install"
+	}
+	switch req.Operation {
+	case "install", "uninstall":
+		if req.PackageName == "" {
+			return "", fmt.Errorf("package_name is required to %s a package", req.Operation)
+		}
+	case "list":
+	default:
+		return "", fmt.Errorf("unsupported operation: %s (use install, uninstall or list)", req.Operation)
+	}
+	// Both end up in argv; a leading '-' would be parsed as a flag such as
+	// --index-url or --registry and bypass the configured mirrors
+	if err := checkRef("package_name", req.PackageName); err != nil {
+		return "", err
+	}
+	if err := checkRef("version", req.Version); err != nil {
+		return "", err
+	}
+
+	if req.Workspace == "" {
+		req.Workspace = "."
+	}
+	workspace, err := filepath.Abs(req.Workspace)
+	if err != nil {
+		return "", fmt.Errorf("invalid workspace: %v", err)
+	}
+	req.Workspace = workspace
+
+	manager := strings.ToLower(req.PackageManager)
+	mirrors := loadPackageMirrors()
+
+	var plan *packagePlan
+	switch manager {
+	case "pip", "pip3":
+		plan = pipPlan(req)
+	case "npm":
+		plan = npmPlan(req)
+	case "yarn":
+		plan = yarnPlan(req)
+	case "go":
+		plan, err = goPackagePlan(req)
+	case "cargo":
+		plan = cargoPlan(req)
+	default:
+		return "", fmt.Errorf("unsupported package manager: %s", req.PackageManager)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := mirrors.apply(manager, req, plan); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "environment: %s\n", plan.environment)
+	if plan.mirror != "" {
+		fmt.Fprintf(&out, "mirror: %s\n", plan.mirror)
+	}
+
+	for _, step := range plan.steps {
+		cmd := exec.CommandContext(ctx, step[0], step[1:]...)
+		cmd.Dir = req.Workspace
+		if len(plan.env) > 0 {
+			cmd.Env = append(os.Environ(), plan.env...)
+		}
+
+		result, err := runCommand(ctx, cmd)
+		if err != nil {
+			return "", fmt.Errorf("package %s failed: %v", req.Operation, err)
+		}
+
+		fmt.Fprintf(&out, "$ %s\n%s", result.Command, result.Render())
+		if !result.Success() {
+			out.WriteString(mirrors.offlineHint(manager, req, result.Stdout+result.Stderr))
+			return out.String(), nil
+		}
+	}
+
+	if plan.record != nil {
+		if err := plan.record(); err != nil {
+			return "", fmt.Errorf("failed to update manifest: %v", err)
+		}
+	}
+
+	return out.String(), nil
+}
+
+func pipPlan(req packageRequest) *packagePlan {
+	spec := req.PackageName
+	if req.Version != "" {
+		spec = fmt.Sprintf("%s==%s", req.PackageName, req.Version)
+	}
+
+	if req.Global {
+		plan := &packagePlan{environment: "global (pip3)"}
+		switch req.Operation {
+		case "install":
+			plan.steps = [][]string{{"pip3", "install", spec}}
+		case "uninstall":
+			plan.steps = [][]string{{"pip3", "uninstall", "-y", req.PackageName}}
+		case "list":
+			plan.steps = [][]string{{"pip3", "list"}}
+		}
+		return plan
+	}
+
+	venv := filepath.Join(req.Workspace, ".venv")
+	pip := filepath.Join(venv, "bin", "pip")
+	plan := &packagePlan{environment: "python venv " + venv}
+
+	if !fileExists(pip) {
+		plan.steps = append(plan.steps, []string{"python3", "-m", "venv", ".venv"})
+	}
+
+	requirements := filepath.Join(req.Workspace, "requirements.txt")
+	switch req.Operation {
+	case "install":
+		plan.steps = append(plan.steps, []string{pip, "install", spec})
+		plan.record = func() error {
+			return updateRequirements(requirements, req.PackageName, spec)
+		}
+	case "uninstall":
+		plan.steps = append(plan.steps, []string{pip, "uninstall", "-y", req.PackageName})
+		plan.record = func() error {
+			return updateRequirements(requirements, req.PackageName, "")
+		}
+	case "list":
+		plan.steps = append(plan.steps, []string{pip, "list"})
+	}
+
+	return plan
+}
+
+func npmPlan(req packageRequest) *packagePlan {
+	spec := req.PackageName
+	if req.Version != "" {
+		spec = fmt.Sprintf("%s@%s", req.PackageName, req.Version)
+	}
+
+	var flags []string
+	plan := &packagePlan{environment: "node_modules in " + req.Workspace}
+	if req.Global {
+		flags = []string{"-g"}
+		plan.environment = "global (npm -g)"
+	} else if req.Operation == "install" && !fileExists(filepath.Join(req.Workspace, "package.json")) {
+		plan.steps = append(plan.steps, []string{"npm", "init", "-y"})
+	}
+
+	// npm records installs and removals in package.json itself
+	switch req.Operation {
+	case "install":
+		plan.steps = append(plan.steps, append([]string{"npm", "install"}, append(flags, spec)...))
+	case "uninstall":
+		plan.steps = append(plan.steps, append([]string{"npm", "uninstall"}, append(flags, req.PackageName)...))
+	case "list":
+		plan.steps = append(plan.steps, append([]string{"npm", "ls", "--depth=0"}, flags...))
+	}
+
+	return plan
+}
+
+func yarnPlan(req packageRequest) *packagePlan {
+	spec := req.PackageName
+	if req.Version != "" {
+		spec = fmt.Sprintf("%s@%s", req.PackageName, req.Version)
+	}
+
+	if req.Global {
+		plan := &packagePlan{environment: "global (yarn global)"}
+		switch req.Operation {
+		case "install":
+			plan.steps = [][]string{{"yarn", "global", "add", spec}}
+		case "uninstall":
+			plan.steps = [][]string{{"yarn", "global", "remove", req.PackageName}}
+		case "list":
+			plan.steps = [][]string{{"yarn", "global", "list"}}
+		}
+		return plan
+	}
+
+	plan := &packagePlan{environment: "node_modules in " + req.Workspace}
+	if req.Operation == "install" && !fileExists(filepath.Join(req.Workspace, "package.json")) {
+		plan.steps = append(plan.steps, []string{"yarn", "init", "-y"})
+	}
+
+	switch req.Operation {
+	case "install":
+		plan.steps = append(plan.steps, []string{"yarn", "add", spec})
+	case "uninstall":
+		plan.steps = append(plan.steps, []string{"yarn", "remove", req.PackageName})
+	case "list":
+		plan.steps = append(plan.steps, []string{"yarn", "list", "--depth=0"})
+	}
+
+	return plan
+}
+
+func goPackagePlan(req packageRequest) (*packagePlan, error) {
+	if req.Global {
+		// Outside a module the only meaningful operation is installing a binary
+		if req.Operation != "install" {
+			return nil, fmt.Errorf("global %s is not supported for go; binaries live in $(go env GOPATH)/bin", req.Operation)
+		}
+		version := req.Version
+		if version == "" {
+			version = "latest"
+		}
+		return &packagePlan{
+			environment: "global (go install)",
+			steps:       [][]string{{"go", "install", fmt.Sprintf("%s@%s", req.PackageName, version)}},
+		}, nil
+	}
+
+	plan := &packagePlan{environment: "go module in " + req.Workspace}
+	if req.Operation == "install" && !fileExists(filepath.Join(req.Workspace, "go.mod")) {
+		plan.steps = append(plan.steps, []string{"go", "mod", "init", goModuleName(req.Workspace)})
+	}
+
+	// go get records requirements in go.mod itself
+	switch req.Operation {
+	case "install":
+		spec := req.PackageName
+		if req.Version != "" {
+			spec = fmt.Sprintf("%s@%s", req.PackageName, req.Version)
+		}
+		plan.steps = append(plan.steps, []string{"go", "get", spec})
+	case "uninstall":
+		plan.steps = append(plan.steps, []string{"go", "get", req.PackageName + "@none"})
+	case "list":
+		plan.steps = append(plan.steps, []string{"go", "list", "-m", "all"})
+	}
+
+	return plan, nil
+}
+
+func cargoPlan(req packageRequest) *packagePlan {
+	if req.Global {
+		plan := &packagePlan{environment: "global (cargo install)"}
+		switch req.Operation {
+		case "install":
+			args := []string{"cargo", "install"}
+			if req.Version != "" {
+				args = append(args, "--version", req.Version)
+			}
+			plan.steps = [][]string{append(args, req.PackageName)}
+		case "uninstall":
+			plan.steps = [][]string{{"cargo", "uninstall", req.PackageName}}
+		case "list":
+			plan.steps = [][]string{{"cargo", "install", "--list"}}
+		}
+		return plan
+	}
+
+	plan := &packagePlan{environment: "cargo project in " + req.Workspace}
+	if req.Operation == "install" && !fileExists(filepath.Join(req.Workspace, "Cargo.toml")) {
+		plan.steps = append(plan.steps, []string{"cargo", "init"})
+	}
+
+	// cargo add and cargo remove keep Cargo.toml up to date
+	switch req.Operation {
+	case "install":
+		spec := req.PackageName
+		if req.Version != "" {
+			spec = fmt.Sprintf("%s@%s", req.PackageName, req.Version)
+		}
+		plan.steps = append(plan.steps, []string{"cargo", "add", spec})
+	case "uninstall":
+		plan.steps = append(plan.steps, []string{"cargo", "remove", req.PackageName})
+	case "list":
+		plan.steps = append(plan.steps, []string{"cargo", "tree", "--depth", "1"})
+	}
+
+	return plan
+}
+
+var invalidModuleChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// goModuleName derives a module path for a workspace without a go.mod
+func goModuleName(workspace string) string {
+	name := invalidModuleChars.ReplaceAllString(filepath.Base(workspace), "-")
+	name = strings.Trim(name, "-.")
+	if name == "" {
+		return "workspace"
+	}
+	return name
+}
+
+// requirementName extracts the package name from a requirements.txt line
+var requirementName = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// updateRequirements sets the line for name in requirements.txt to spec, or
+// removes it when spec is empty. Names compare case-insensitively and with
+// '-' and '_' treated alike, as pip does.
+func updateRequirements(path, name, spec string) error {
+	var lines []string
+	if data, err := ioutil.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	normalise := func(s string) string {
+		return strings.ReplaceAll(strings.ToLower(s), "_", "-")
+	}
+
+	var updated []string
+	replaced := false
+	for _, line := range lines {
+		m := requirementName.FindStringSubmatch(line)
+		if m == nil || normalise(m[1]) != normalise(name) {
+			updated = append(updated, line)
+			continue
+		}
+		if spec != "" && !replaced {
+			updated = append(updated, spec)
+			replaced = true
+		}
+	}
+	if spec != "" && !replaced {
+		updated = append(updated, spec)
+	}
+
+	content := strings.Join(updated, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	return ioutil.WriteFile(path, []byte(content), 0644)
+}
@@ -0,0 +1,633 @@
+package jarvisTools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+const (
+	defaultMaxProcessesPerUser = 5
+	processOutputLimit         = 1 << 20 // 1 MiB kept per stream
+	defaultReadOutputBytes     = 16 * 1024
+	defaultStopGracePeriod     = 5 * time.Second
+
+	// Exited processes are forgotten once their output has been read and
+	// drainedProcessTTL has passed, or after exitedProcessTTL regardless
+	drainedProcessTTL = time.Minute
+	exitedProcessTTL  = 30 * time.Minute
+	// maxTrackedPerUser caps running and exited entries kept per user
+	maxTrackedPerUser = 20
+)
+
+// DefaultProcessManager is shared by all process tools in this agent
+var DefaultProcessManager = NewProcessManager(maxProcessesFromEnv())
+
+// ProcessManager tracks long-running background processes per user
+type ProcessManager struct {
+	mu         sync.Mutex
+	processes  map[string]*backgroundProcess
+	maxPerUser int
+	nextID     int
+}
+
+// backgroundProcess is a single process started by start_process
+type backgroundProcess struct {
+	id         string
+	userID     string
+	command    string
+	workingDir string
+	startedAt  time.Time
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *outputBuffer
+	stderr *outputBuffer
+
+	done       chan struct{}
+	exitCode   int
+	finishedAt time.Time
+}
+
+// ProcessInfo describes a background process for listing
+type ProcessInfo struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid"`
+	Command    string    `json:"command"`
+	WorkingDir string    `json:"working_dir,omitempty"`
+	Running    bool      `json:"running"`
+	ExitCode   int       `json:"exit_code"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// NewProcessManager creates a process manager allowing maxPerUser running processes per user
+func NewProcessManager(maxPerUser int) *ProcessManager {
+	if maxPerUser <= 0 {
+		maxPerUser = defaultMaxProcessesPerUser
+	}
+
+	return &ProcessManager{
+		processes:  make(map[string]*backgroundProcess),
+		maxPerUser: maxPerUser,
+	}
+}
+
+func maxProcessesFromEnv() int {
+	if v := os.Getenv("MAX_BACKGROUND_PROCESSES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			return n
+		}
+	}
+	return defaultMaxProcessesPerUser
+}
+
+// Start launches command in the background for userID
+func (m *ProcessManager) Start(userID, command, workingDir string, env map[string]string) (ProcessInfo, error) {
+	if strings.TrimSpace(command) == "" {
+		return ProcessInfo{}, fmt.Errorf("command is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+
+	running := 0
+	for _, p := range m.processes {
+		if p.userID == userID && p.running() {
+			running++
+		}
+	}
+	if running >= m.maxPerUser {
+		return ProcessInfo{}, fmt.Errorf("background process limit reached (%d running); stop a process first", m.maxPerUser)
+	}
+	m.evictExited(userID)
+
+	// Background processes deliberately outlive the tool call that started
+	// them, so they are not bound to its context.
+	cmd := exec.Command("bash", "-c", command)
+	if workingDir != "" {
+		cmd.Dir = workingDir
+	}
+	if len(env) > 0 {
+		cmd.Env = os.Environ()
+		for k, v := range env {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	setProcessGroup(cmd)
+	// Children that escape the process group must not keep Wait blocked on the pipes
+	cmd.WaitDelay = 2 * time.Second
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return ProcessInfo{}, fmt.Errorf("failed to open stdin: %v", err)
+	}
+
+	p := &backgroundProcess{
+		userID:     userID,
+		command:    command,
+		workingDir: workingDir,
+		cmd:        cmd,
+		stdin:      stdin,
+		stdout:     newOutputBuffer(processOutputLimit),
+		stderr:     newOutputBuffer(processOutputLimit),
+		done:       make(chan struct{}),
+	}
+	cmd.Stdout = p.stdout
+	cmd.Stderr = p.stderr
+
+	if err := cmd.Start(); err != nil {
+		return ProcessInfo{}, fmt.Errorf("failed to start process: %v", err)
+	}
+
+	m.nextID++
+	p.id = fmt.Sprintf("proc_%d", m.nextID)
+	p.startedAt = time.Now()
+	m.processes[p.id] = p
+
+	go func() {
+		cmd.Wait()
+		p.exitCode = cmd.ProcessState.ExitCode()
+		p.finishedAt = time.Now()
+		close(p.done)
+	}()
+
+	return p.info(), nil
+}
+
+// prune forgets exited processes whose output was read or that exited long
+// ago. The caller holds m.mu.
+func (m *ProcessManager) prune(now time.Time) {
+	for id, p := range m.processes {
+		if p.running() {
+			continue
+		}
+		age := now.Sub(p.finishedAt)
+		drained := p.stdout.Pending() == 0 && p.stderr.Pending() == 0
+		if age > exitedProcessTTL || (drained && age > drainedProcessTTL) {
+			delete(m.processes, id)
+		}
+	}
+}
+
+// evictExited makes room for a new entry by forgetting the user's oldest
+// exited processes. The caller holds m.mu.
+func (m *ProcessManager) evictExited(userID string) {
+	var owned, exited []*backgroundProcess
+	for _, p := range m.processes {
+		if p.userID != userID {
+			continue
+		}
+		owned = append(owned, p)
+		if !p.running() {
+			exited = append(exited, p)
+		}
+	}
+
+	sort.Slice(exited, func(i, j int) bool {
+		return exited[i].finishedAt.Before(exited[j].finishedAt)
+	})
+	for excess := len(owned) - maxTrackedPerUser + 1; excess > 0 && len(exited) > 0; excess-- {
+		delete(m.processes, exited[0].id)
+		exited = exited[1:]
+	}
+}
+
+// get returns the process with id if it belongs to userID
+func (m *ProcessManager) get(userID, id string) (*backgroundProcess, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.processes[id]
+	if !ok || p.userID != userID {
+		return nil, fmt.Errorf("process not found: %s", id)
+	}
+	return p, nil
+}
+
+// List returns all processes owned by userID, oldest first
+func (m *ProcessManager) List(userID string) []ProcessInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+
+	var infos []ProcessInfo
+	for _, p := range m.processes {
+		if p.userID == userID {
+			infos = append(infos, p.info())
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].StartedAt.Before(infos[j].StartedAt)
+	})
+	return infos
+}
+
+// Stop terminates the process and forgets it. The process group receives
+// SIGTERM first and SIGKILL if it is still alive after grace.
+func (m *ProcessManager) Stop(userID, id string, grace time.Duration) (ProcessInfo, error) {
+	p, err := m.get(userID, id)
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+
+	p.terminate(grace)
+
+	m.mu.Lock()
+	delete(m.processes, id)
+	m.mu.Unlock()
+
+	return p.info(), nil
+}
+
+// StopAll terminates every process owned by userID and returns how many were stopped
+func (m *ProcessManager) StopAll(userID string) int {
+	m.mu.Lock()
+	var owned []*backgroundProcess
+	for id, p := range m.processes {
+		if p.userID == userID {
+			owned = append(owned, p)
+			delete(m.processes, id)
+		}
+	}
+	m.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range owned {
+		wg.Add(1)
+		go func(p *backgroundProcess) {
+			defer wg.Done()
+			p.terminate(defaultStopGracePeriod)
+		}(p)
+	}
+	wg.Wait()
+
+	return len(owned)
+}
+
+func (p *backgroundProcess) running() bool {
+	select {
+	case <-p.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *backgroundProcess) terminate(grace time.Duration) {
+	if !p.running() {
+		return
+	}
+
+	p.stdin.Close()
+	signalProcessGroup(p.cmd, false)
+
+	select {
+	case <-p.done:
+	case <-time.After(grace):
+		signalProcessGroup(p.cmd, true)
+		<-p.done
+	}
+}
+
+func (p *backgroundProcess) info() ProcessInfo {
+	info := ProcessInfo{
+		ID:         p.id,
+		Command:    p.command,
+		WorkingDir: p.workingDir,
+		Running:    p.running(),
+		StartedAt:  p.startedAt,
+	}
+	if p.cmd.Process != nil {
+		info.PID = p.cmd.Process.Pid
+	}
+	if !info.Running {
+		info.ExitCode = p.exitCode
+	}
+	return info
+}
+
+func (p *backgroundProcess) status() string {
+	if p.running() {
+		return fmt.Sprintf("running (pid %d, uptime %s)", p.cmd.Process.Pid, time.Since(p.startedAt).Round(time.Second))
+	}
+	return fmt.Sprintf("exited with code %d after %s", p.exitCode, p.finishedAt.Sub(p.startedAt).Round(time.Millisecond))
+}
+
+// outputBuffer keeps the most recent output of a stream and remembers how
+// much of it has already been handed to the agent.
+type outputBuffer struct {
+	mu      sync.Mutex
+	data    []byte
+	limit   int
+	dropped int64 // bytes discarded from the front of data
+	readPos int64 // absolute offset of the first unread byte
+}
+
+func newOutputBuffer(limit int) *outputBuffer {
+	return &outputBuffer{limit: limit}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.limit; over > 0 {
+		b.data = append([]byte(nil), b.data[over:]...)
+		b.dropped += int64(over)
+	}
+	return len(p), nil
+}
+
+// ReadNew returns up to max unread bytes and the number of unread bytes that
+// were discarded before they could be read.
+func (b *outputBuffer) ReadNew(max int) (string, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var lost int64
+	if b.readPos < b.dropped {
+		lost = b.dropped - b.readPos
+		b.readPos = b.dropped
+	}
+
+	start := int(b.readPos - b.dropped)
+	end := len(b.data)
+	if max > 0 && end-start > max {
+		end = start + max
+	}
+
+	b.readPos += int64(end - start)
+	return string(b.data[start:end]), lost
+}
+
+// Pending returns the number of bytes not yet read
+func (b *outputBuffer) Pending() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped + int64(len(b.data)) - b.readPos
+}
+
+type StartProcessTool struct {
+	manager *ProcessManager
+	userID  string
+}
+
+func (t StartProcessTool) Name() string {
+	return "start_process"
+}
+
+func (t StartProcessTool) Description() string {
+	return "Start a long-running background process such as a dev server or a build in watch mode. Input should be JSON with 'command', optional 'working_dir', and optional 'env' object. Returns a process_id for the other process tools."
+}
+
+func (t StartProcessTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		Command    string            `json:"command"`
+		WorkingDir string            `json:"working_dir"`
+		Env        map[string]string `json:"env"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	info, err := t.manager.Start(t.userID, args.Command, args.WorkingDir, args.Env)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Started process %s (pid %d): %s", info.ID, info.PID, info.Command), nil
+}
+
+type ReadProcessOutputTool struct {
+	manager *ProcessManager
+	userID  string
+}
+
+func (t ReadProcessOutputTool) Name() string {
+	return "read_process_output"
+}
+
+func (t ReadProcessOutputTool) Description() string {
+	return "Read new stdout/stderr produced by a background process since the last read. Input should be JSON with 'process_id', optional 'max_bytes', and optional 'wait' (milliseconds to wait for new output)."
+}
+
+func (t ReadProcessOutputTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		ProcessID string `json:"process_id"`
+		MaxBytes  int    `json:"max_bytes"`
+		Wait      int    `json:"wait"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if args.MaxBytes <= 0 {
+		args.MaxBytes = defaultReadOutputBytes
+	}
+
+	p, err := t.manager.get(t.userID, args.ProcessID)
+	if err != nil {
+		return "", err
+	}
+
+	if args.Wait > 0 {
+		waitForOutput(ctx, p, time.Duration(args.Wait)*time.Millisecond)
+	}
+
+	stdout, lostOut := p.stdout.ReadNew(args.MaxBytes)
+	stderr, lostErr := p.stderr.ReadNew(args.MaxBytes)
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Process %s %s\n", p.id, p.status())
+	writeStream(&result, "stdout", stdout, lostOut, p.stdout.Pending())
+	writeStream(&result, "stderr", stderr, lostErr, p.stderr.Pending())
+
+	return result.String(), nil
+}
+
+// waitForOutput blocks until the process writes something, exits, timeout
+// passes or ctx is done
+func waitForOutput(ctx context.Context, p *backgroundProcess, timeout time.Duration) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	deadline := time.After(timeout)
+	for {
+		if p.stdout.Pending() > 0 || p.stderr.Pending() > 0 || !p.running() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeStream(b *strings.Builder, name, data string, lost, pending int64) {
+	if data == "" && lost == 0 {
+		fmt.Fprintf(b, "--- %s: no new output ---\n", name)
+		return
+	}
+
+	fmt.Fprintf(b, "--- %s ---\n", name)
+	if lost > 0 {
+		fmt.Fprintf(b, "[%d bytes discarded before they were read]\n", lost)
+	}
+	b.WriteString(data)
+	if !strings.HasSuffix(data, "\n") {
+		b.WriteString("\n")
+	}
+	if pending > 0 {
+		fmt.Fprintf(b, "[%d more bytes available]\n", pending)
+	}
+}
+
+type WriteProcessInputTool struct {
+	manager *ProcessManager
+	userID  string
+}
+
+func (t WriteProcessInputTool) Name() string {
+	return "write_process_input"
+}
+
+func (t WriteProcessInputTool) Description() string {
+	return "Send text to the stdin of a background process. Input should be JSON with 'process_id', 'input', and optional 'close_stdin' boolean. A trailing newline is not added automatically."
+}
+
+func (t WriteProcessInputTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		ProcessID  string `json:"process_id"`
+		Input      string `json:"input"`
+		CloseStdin bool   `json:"close_stdin"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	p, err := t.manager.get(t.userID, args.ProcessID)
+	if err != nil {
+		return "", err
+	}
+
+	if !p.running() {
+		return "", fmt.Errorf("process %s is not running", p.id)
+	}
+
+	if args.Input != "" {
+		if _, err := io.WriteString(p.stdin, args.Input); err != nil {
+			return "", fmt.Errorf("failed to write to stdin: %v", err)
+		}
+	}
+
+	if args.CloseStdin {
+		if err := p.stdin.Close(); err != nil {
+			return "", fmt.Errorf("failed to close stdin: %v", err)
+		}
+		return fmt.Sprintf("Wrote %d bytes to %s and closed stdin", len(args.Input), p.id), nil
+	}
+
+	return fmt.Sprintf("Wrote %d bytes to %s", len(args.Input), p.id), nil
+}
+
+type ListProcessesTool struct {
+	manager *ProcessManager
+	userID  string
+}
+
+func (t ListProcessesTool) Name() string {
+	return "list_processes"
+}
+
+func (t ListProcessesTool) Description() string {
+	return "List background processes started with start_process. No input required (use empty JSON {})."
+}
+
+func (t ListProcessesTool) Call(ctx context.Context, input string) (string, error) {
+	infos := t.manager.List(t.userID)
+	if len(infos) == 0 {
+		return "No background processes", nil
+	}
+
+	var result strings.Builder
+	for _, info := range infos {
+		state := "running"
+		if !info.Running {
+			state = fmt.Sprintf("exited (%d)", info.ExitCode)
+		}
+		fmt.Fprintf(&result, "%s\tpid %d\t%s\t%s\n", info.ID, info.PID, state, info.Command)
+	}
+
+	return result.String(), nil
+}
+
+type StopProcessTool struct {
+	manager *ProcessManager
+	userID  string
+}
+
+func (t StopProcessTool) Name() string {
+	return "stop_process"
+}
+
+func (t StopProcessTool) Description() string {
+	return "Stop a background process and its children. Input should be JSON with 'process_id' and optional 'grace_period' (seconds before the process is killed, default 5)."
+}
+
+func (t StopProcessTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		ProcessID   string `json:"process_id"`
+		GracePeriod int    `json:"grace_period"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	grace := defaultStopGracePeriod
+	if args.GracePeriod > 0 {
+		grace = time.Duration(args.GracePeriod) * time.Second
+	}
+
+	info, err := t.manager.Stop(t.userID, args.ProcessID, grace)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Stopped process %s (exit code %d)", info.ID, info.ExitCode), nil
+}
+
+// GetProcessTools returns the background process tools for userID
+func GetProcessTools(userID string) []tools.Tool {
+	manager := DefaultProcessManager
+
+	return []tools.Tool{
+		StartProcessTool{manager: manager, userID: userID},
+		ReadProcessOutputTool{manager: manager, userID: userID},
+		WriteProcessInputTool{manager: manager, userID: userID},
+		ListProcessesTool{manager: manager, userID: userID},
+		StopProcessTool{manager: manager, userID: userID},
+	}
+}
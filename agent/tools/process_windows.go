@@ -0,0 +1,15 @@
+//go:build windows
+
+package jarvisTools
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the process; Windows has no graceful equivalent of SIGTERM
+func signalProcessGroup(cmd *exec.Cmd, kill bool) {
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
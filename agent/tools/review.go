@@ -0,0 +1,528 @@
+package jarvisTools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// maxReviewChunkLines bounds how much of a diff goes into one prompt;
+	// larger files are reviewed hunk by hunk
+	maxReviewChunkLines = 300
+	// dedupeLineWindow is how close two findings with the same message must
+	// be to count as the same finding
+	dedupeLineWindow = 3
+)
+
+// severityRank orders severities from most to least serious
+var severityRank = map[string]int{
+	"critical": 0,
+	"major":    1,
+	"minor":    2,
+	"nit":      3,
+}
+
+// Finding is an issue raised by the reviewer at a line of the new version
+type Finding struct {
+	Path       string `json:"path"`
+	Line       int    `json:"line"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+// Review is the structured result of a code review
+type Review struct {
+	Source   string         `json:"source"`
+	Summary  string         `json:"summary"`
+	Files    int            `json:"files"`
+	Counts   map[string]int `json:"counts"`
+	Findings []Finding      `json:"findings"`
+	// Posted and PostErrors are set when the review was posted to a forge
+	Posted     bool     `json:"posted,omitempty"`
+	PostErrors []string `json:"post_errors,omitempty"`
+}
+
+// ReviewRequest selects the diff to review and what to do with the result.
+// The diff comes from pr_number if set, else from base...HEAD if base is
+// set, else from the staged changes if staged, else from the working tree.
+type ReviewRequest struct {
+	WorkingDir string `json:"working_dir"`
+	Base       string `json:"base"`
+	Staged     bool   `json:"staged"`
+	PRNumber   int    `json:"pr_number"`
+	Repository string `json:"repository"`
+	// Post publishes the summary and inline comments on the pull request
+	Post bool `json:"post"`
+	// Format is "markdown" (default) or "json"
+	Format string `json:"format"`
+}
+
+// ReviewInputError is returned by Review when the request itself is at
+// fault, such as a missing working directory or an unknown base ref, as
+// opposed to a failure of the LLM or forge
+type ReviewInputError struct {
+	Err error
+}
+
+func (e *ReviewInputError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ReviewInputError) Unwrap() error {
+	return e.Err
+}
+
+// CodeReviewTool reviews diffs with an LLM and optionally posts the review
+// through a Forge. A nil Forge is chosen from the environment.
+type CodeReviewTool struct {
+	LLM   llms.Model
+	Forge Forge
+}
+
+func NewCodeReviewTool(llm llms.Model) CodeReviewTool {
+	return CodeReviewTool{LLM: llm}
+}
+
+func (t CodeReviewTool) Name() string {
+	return "review_code"
+}
+
+func (t CodeReviewTool) Description() string {
+	return "Review a code change and report findings with severity and file:line locations. Input should be JSON with 'working_dir' and one of 'pr_number' (review a pull request), 'base' (review the current branch against this branch) or 'staged' (review staged changes); with none of them the uncommitted changes are reviewed. Optional 'repository', 'post' (post the summary and inline comments on the pull request) and 'format' (markdown, the default, or json) fields."
+}
+
+func (t CodeReviewTool) Call(ctx context.Context, input string) (string, error) {
+	var req ReviewRequest
+
+	if err := json.Unmarshal([]byte(input), &req); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	review, err := t.Review(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.ToLower(req.Format) == "json" {
+		out, err := json.MarshalIndent(review, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("failed to encode review: %v", err)
+		}
+		return string(out), nil
+	}
+
+	return review.Markdown(), nil
+}
+
+// Review fetches the requested diff, reviews it and posts it if asked to
+func (t CodeReviewTool) Review(ctx context.Context, req ReviewRequest) (*Review, error) {
+	if t.LLM == nil {
+		return nil, fmt.Errorf("code review needs an LLM")
+	}
+	if req.Post && req.PRNumber <= 0 {
+		return nil, &ReviewInputError{fmt.Errorf("post requires pr_number")}
+	}
+	if err := checkRef("base", req.Base); err != nil {
+		return nil, &ReviewInputError{err}
+	}
+
+	var forge Forge
+	var repo string
+	var diff, source string
+
+	if req.PRNumber > 0 {
+		var err error
+		forge, repo, err = resolveForge(ctx, t.Forge, req.WorkingDir, req.Repository)
+		if err != nil {
+			return nil, err
+		}
+		diff, err = forge.GetPullRequestDiff(ctx, repo, req.PRNumber)
+		if err != nil {
+			return nil, err
+		}
+		source = fmt.Sprintf("%s#%d", repo, req.PRNumber)
+	} else {
+		args := []string{"diff"}
+		switch {
+		case req.Base != "":
+			args = append(args, req.Base+"...HEAD")
+			source = req.Base + "...HEAD"
+		case req.Staged:
+			args = append(args, "--cached")
+			source = "staged changes"
+		default:
+			args = append(args, "HEAD")
+			source = "uncommitted changes"
+		}
+
+		var err error
+		diff, err = gitDiffText(ctx, req.WorkingDir, args...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	review, err := reviewDiff(ctx, t.LLM, diff)
+	if err != nil {
+		return nil, err
+	}
+	review.Source = source
+
+	if req.Post {
+		postReview(ctx, forge, repo, req.PRNumber, review)
+	}
+
+	return review, nil
+}
+
+// gitDiffText returns the complete output of git diff; runGit keeps only
+// the head and tail of long output, which would cut hunks in half
+func gitDiffText(ctx context.Context, workingDir string, args ...string) (string, error) {
+	dir, err := resolveWorkingDir(workingDir)
+	if err != nil {
+		return "", &ReviewInputError{err}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append(args, "--no-color", "--no-ext-diff")...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+
+	result, err := runCommand(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("git diff failed: %v", err)
+	}
+	// git rejects unknown refs and directories that aren't repositories
+	if !result.Success() {
+		return "", &ReviewInputError{fmt.Errorf("git diff failed: %s", strings.TrimSpace(result.Stderr))}
+	}
+
+	return stdout.String(), nil
+}
+
+// reviewChunk is the part of a diff sent to the LLM in one prompt
+type reviewChunk struct {
+	Path  string
+	Hunks []diffHunk
+}
+
+// chunkDiff splits a diff into per-file chunks, splitting files whose diff
+// exceeds maxReviewChunkLines at hunk boundaries
+func chunkDiff(files []diffFile) []reviewChunk {
+	var chunks []reviewChunk
+
+	for _, file := range files {
+		current := reviewChunk{Path: file.Path}
+		size := 0
+		for _, hunk := range file.Hunks {
+			if size > 0 && size+len(hunk.Lines) > maxReviewChunkLines {
+				chunks = append(chunks, current)
+				current = reviewChunk{Path: file.Path}
+				size = 0
+			}
+			current.Hunks = append(current.Hunks, hunk)
+			size += len(hunk.Lines)
+		}
+		if len(current.Hunks) > 0 {
+			chunks = append(chunks, current)
+		}
+	}
+
+	return chunks
+}
+
+// render prints the chunk with new-version line numbers so the model can
+// refer to lines precisely
+func (c reviewChunk) render() string {
+	var b strings.Builder
+	for _, hunk := range c.Hunks {
+		b.WriteString(hunk.Header)
+		b.WriteString("\n")
+		for _, l := range hunk.Lines {
+			if l.NewLine > 0 {
+				fmt.Fprintf(&b, "%5d %c %s\n", l.NewLine, l.Kind, l.Text)
+			} else {
+				fmt.Fprintf(&b, "      %c %s\n", l.Kind, l.Text)
+			}
+		}
+	}
+	return b.String()
+}
+
+// lines returns the new-version lines in the chunk and which were added
+func (c reviewChunk) lines() (map[int]bool, map[int]bool) {
+	all, added := make(map[int]bool), make(map[int]bool)
+	for _, hunk := range c.Hunks {
+		for _, l := range hunk.Lines {
+			if l.NewLine > 0 {
+				all[l.NewLine] = true
+				if l.Kind == '+' {
+					added[l.NewLine] = true
+				}
+			}
+		}
+	}
+	return all, added
+}
+
+const reviewPrompt = `You are an experienced engineer reviewing a code change.
+Report only real problems in the added or changed lines: bugs, security issues, missing error handling, race conditions, resource leaks, performance problems and seriously unclear code. Do not praise the code or restate what it does.
+
+File: %s
+Diff (the number on the left is the line number in the new version; '+' added, '-' removed, ' ' unchanged):
+%s
+Respond with only a JSON array. Each element must be:
+{"line": <line number from the left column>, "severity": "critical" | "major" | "minor" | "nit", "message": "<the problem>", "suggestion": "<how to fix it, optional>"}
+Respond with [] if there is nothing worth reporting.`
+
+// reviewDiff asks the LLM for findings on each chunk of diff, then
+// deduplicates them and writes a summary
+func reviewDiff(ctx context.Context, llm llms.Model, diff string) (*Review, error) {
+	files := parseUnifiedDiff(diff)
+	review := &Review{Files: len(files), Counts: map[string]int{}, Findings: []Finding{}}
+
+	if len(files) == 0 {
+		review.Summary = "No changes to review."
+		return review, nil
+	}
+
+	var findings []Finding
+	for _, chunk := range chunkDiff(files) {
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("review cancelled: %v", err)
+		}
+
+		response, err := llms.GenerateFromSinglePrompt(ctx, llm, fmt.Sprintf(reviewPrompt, chunk.Path, chunk.render()), llms.WithTemperature(0))
+		if err != nil {
+			return nil, fmt.Errorf("failed to review %s: %v", chunk.Path, err)
+		}
+
+		findings = append(findings, parseFindings(chunk, response)...)
+	}
+
+	review.Findings = dedupeFindings(findings)
+	for _, f := range review.Findings {
+		review.Counts[f.Severity]++
+	}
+	review.Summary = summariseReview(ctx, llm, files, review)
+
+	return review, nil
+}
+
+// parseFindings extracts findings from a model response, dropping any that
+// don't point at a line of the chunk
+func parseFindings(chunk reviewChunk, response string) []Finding {
+	start, end := strings.Index(response, "["), strings.LastIndex(response, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+
+	var raw []struct {
+		Line       json.Number `json:"line"`
+		Severity   string      `json:"severity"`
+		Message    string      `json:"message"`
+		Suggestion string      `json:"suggestion"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &raw); err != nil {
+		return nil
+	}
+
+	all, added := chunk.lines()
+
+	var findings []Finding
+	for _, r := range raw {
+		line, err := r.Line.Int64()
+		if err != nil || !all[int(line)] || strings.TrimSpace(r.Message) == "" {
+			continue
+		}
+		// Findings on unchanged context lines are usually about code the
+		// change didn't touch
+		if !added[int(line)] && len(added) > 0 {
+			continue
+		}
+		findings = append(findings, Finding{
+			Path:       chunk.Path,
+			Line:       int(line),
+			Severity:   normaliseSeverity(r.Severity),
+			Message:    strings.TrimSpace(r.Message),
+			Suggestion: strings.TrimSpace(r.Suggestion),
+		})
+	}
+
+	return findings
+}
+
+func normaliseSeverity(severity string) string {
+	switch strings.ToLower(strings.TrimSpace(severity)) {
+	case "critical", "blocker", "security":
+		return "critical"
+	case "major", "high", "error":
+		return "major"
+	case "nit", "style", "info", "trivial":
+		return "nit"
+	default:
+		return "minor"
+	}
+}
+
+// dedupeFindings merges findings with the same message on nearby lines of
+// the same file, keeping the most severe, and sorts them by severity
+func dedupeFindings(findings []Finding) []Finding {
+	var unique []Finding
+
+	for _, f := range findings {
+		key := normaliseMessage(f.Message)
+		merged := false
+		for i, u := range unique {
+			if u.Path != f.Path || normaliseMessage(u.Message) != key {
+				continue
+			}
+			if diff := u.Line - f.Line; diff < -dedupeLineWindow || diff > dedupeLineWindow {
+				continue
+			}
+			if severityRank[f.Severity] < severityRank[u.Severity] {
+				unique[i].Severity = f.Severity
+			}
+			if unique[i].Suggestion == "" {
+				unique[i].Suggestion = f.Suggestion
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			unique = append(unique, f)
+		}
+	}
+
+	sort.SliceStable(unique, func(i, j int) bool {
+		a, b := unique[i], unique[j]
+		if severityRank[a.Severity] != severityRank[b.Severity] {
+			return severityRank[a.Severity] < severityRank[b.Severity]
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Line < b.Line
+	})
+
+	if unique == nil {
+		return []Finding{}
+	}
+	return unique
+}
+
+// normaliseMessage lowercases a message and strips punctuation so that
+// trivially different wordings compare equal
+func normaliseMessage(message string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(message) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+				b.WriteRune(' ')
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+const summaryPrompt = `Write a two or three sentence summary of a code review for the author. Mention the overall state of the change and the most important problems. Do not use headings or lists.
+
+Files changed: %s
+Findings:
+%s`
+
+// summariseReview asks the LLM for a short overview, falling back to counts
+func summariseReview(ctx context.Context, llm llms.Model, files []diffFile, review *Review) string {
+	fallback := fmt.Sprintf("Reviewed %d file(s): %d critical, %d major, %d minor, %d nit.",
+		len(files), review.Counts["critical"], review.Counts["major"], review.Counts["minor"], review.Counts["nit"])
+
+	if len(review.Findings) == 0 {
+		return fmt.Sprintf("Reviewed %d file(s) and found no problems.", len(files))
+	}
+
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+
+	var list strings.Builder
+	for _, f := range review.Findings {
+		fmt.Fprintf(&list, "- [%s] %s:%d %s\n", f.Severity, f.Path, f.Line, f.Message)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	summary, err := llms.GenerateFromSinglePrompt(ctx, llm, fmt.Sprintf(summaryPrompt, strings.Join(paths, ", "), list.String()), llms.WithTemperature(0))
+	if err != nil || strings.TrimSpace(summary) == "" {
+		return fallback
+	}
+	return strings.TrimSpace(summary) + "\n\n" + fallback
+}
+
+// postReview publishes the summary as a comment and each finding inline.
+// Failures are recorded on the review rather than aborting the rest.
+func postReview(ctx context.Context, forge Forge, repo string, number int, review *Review) {
+	for _, f := range review.Findings {
+		body := fmt.Sprintf("**%s**: %s", f.Severity, f.Message)
+		if f.Suggestion != "" {
+			body += "\n\nSuggestion: " + f.Suggestion
+		}
+		err := forge.ReviewComment(ctx, repo, number, ReviewComment{Path: f.Path, Line: f.Line, Body: body})
+		if err != nil {
+			review.PostErrors = append(review.PostErrors, fmt.Sprintf("%s:%d: %v", f.Path, f.Line, err))
+		}
+	}
+
+	if err := forge.Comment(ctx, repo, number, "## Code review\n\n"+review.Summary); err != nil {
+		review.PostErrors = append(review.PostErrors, fmt.Sprintf("summary: %v", err))
+	}
+
+	review.Posted = len(review.PostErrors) == 0
+}
+
+// Markdown renders the review for people
+func (r *Review) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "## Code review: %s\n\n%s\n", r.Source, r.Summary)
+
+	if len(r.Findings) > 0 {
+		b.WriteString("\n| Severity | Location | Finding |\n|---|---|---|\n")
+		for _, f := range r.Findings {
+			finding := f.Message
+			if f.Suggestion != "" {
+				finding += " Suggestion: " + f.Suggestion
+			}
+			finding = strings.ReplaceAll(strings.ReplaceAll(finding, "|", "\\|"), "\n", " ")
+			fmt.Fprintf(&b, "| %s | `%s:%d` | %s |\n", f.Severity, f.Path, f.Line, finding)
+		}
+	}
+
+	if r.Posted {
+		b.WriteString("\nPosted to the pull request.\n")
+	}
+	if len(r.PostErrors) > 0 {
+		b.WriteString("\nSome comments could not be posted:\n")
+		for _, e := range r.PostErrors {
+			fmt.Fprintf(&b, "- %s\n", e)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,164 @@
+package jarvisTools
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testHunk returns a hunk with n added lines starting at line start
+func testHunk(start, n int) diffHunk {
+	hunk := diffHunk{Header: "@@"}
+	for i := 0; i < n; i++ {
+		hunk.Lines = append(hunk.Lines, diffLine{Kind: '+', NewLine: start + i})
+	}
+	return hunk
+}
+
+func TestChunkDiff(t *testing.T) {
+	half := maxReviewChunkLines / 2
+
+	tests := []struct {
+		name  string
+		files []diffFile
+		// want lists the hunk sizes of each chunk
+		want [][]int
+		path []string
+	}{
+		{
+			name:  "no files",
+			files: nil,
+			want:  nil,
+		},
+		{
+			name:  "file without hunks",
+			files: []diffFile{{Path: "a.go"}},
+			want:  nil,
+		},
+		{
+			name: "one chunk per file",
+			files: []diffFile{
+				{Path: "a.go", Hunks: []diffHunk{testHunk(1, 5), testHunk(20, 5)}},
+				{Path: "b.go", Hunks: []diffHunk{testHunk(1, 3)}},
+			},
+			want: [][]int{{5, 5}, {3}},
+			path: []string{"a.go", "b.go"},
+		},
+		{
+			name: "exactly at the limit",
+			files: []diffFile{
+				{Path: "a.go", Hunks: []diffHunk{testHunk(1, half), testHunk(1000, maxReviewChunkLines-half)}},
+			},
+			want: [][]int{{half, maxReviewChunkLines - half}},
+			path: []string{"a.go"},
+		},
+		{
+			name: "split at hunk boundaries",
+			files: []diffFile{
+				{Path: "a.go", Hunks: []diffHunk{testHunk(1, half), testHunk(1000, half), testHunk(2000, 2)}},
+			},
+			want: [][]int{{half, half}, {2}},
+			path: []string{"a.go", "a.go"},
+		},
+		{
+			name: "oversized hunk stays whole",
+			files: []diffFile{
+				{Path: "a.go", Hunks: []diffHunk{testHunk(1, 2), testHunk(100, maxReviewChunkLines+1), testHunk(1000, 1)}},
+			},
+			want: [][]int{{2}, {maxReviewChunkLines + 1}, {1}},
+			path: []string{"a.go", "a.go", "a.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := chunkDiff(tt.files)
+
+			var got [][]int
+			var paths []string
+			for _, chunk := range chunks {
+				var sizes []int
+				for _, hunk := range chunk.Hunks {
+					sizes = append(sizes, len(hunk.Lines))
+				}
+				got = append(got, sizes)
+				paths = append(paths, chunk.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got chunks %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(paths, tt.path) {
+				t.Errorf("got paths %v, want %v", paths, tt.path)
+			}
+		})
+	}
+}
+
+func TestDedupeFindings(t *testing.T) {
+	tests := []struct {
+		name     string
+		findings []Finding
+		want     []Finding
+	}{
+		{
+			name:     "none",
+			findings: nil,
+			want:     []Finding{},
+		},
+		{
+			name: "same message on nearby lines merges to most severe",
+			findings: []Finding{
+				{Path: "a.go", Line: 10, Severity: "minor", Message: "Error is ignored."},
+				{Path: "a.go", Line: 12, Severity: "major", Message: "error is ignored", Suggestion: "check err"},
+			},
+			want: []Finding{
+				{Path: "a.go", Line: 10, Severity: "major", Message: "Error is ignored.", Suggestion: "check err"},
+			},
+		},
+		{
+			name: "same message far apart is kept",
+			findings: []Finding{
+				{Path: "a.go", Line: 10, Severity: "minor", Message: "error is ignored"},
+				{Path: "a.go", Line: 10 + dedupeLineWindow + 1, Severity: "minor", Message: "error is ignored"},
+			},
+			want: []Finding{
+				{Path: "a.go", Line: 10, Severity: "minor", Message: "error is ignored"},
+				{Path: "a.go", Line: 10 + dedupeLineWindow + 1, Severity: "minor", Message: "error is ignored"},
+			},
+		},
+		{
+			name: "same message in other files is kept",
+			findings: []Finding{
+				{Path: "b.go", Line: 1, Severity: "nit", Message: "typo"},
+				{Path: "a.go", Line: 1, Severity: "nit", Message: "typo"},
+			},
+			want: []Finding{
+				{Path: "a.go", Line: 1, Severity: "nit", Message: "typo"},
+				{Path: "b.go", Line: 1, Severity: "nit", Message: "typo"},
+			},
+		},
+		{
+			name: "sorted by severity, path and line",
+			findings: []Finding{
+				{Path: "a.go", Line: 5, Severity: "nit", Message: "naming"},
+				{Path: "b.go", Line: 3, Severity: "critical", Message: "sql injection"},
+				{Path: "a.go", Line: 9, Severity: "major", Message: "leak"},
+				{Path: "a.go", Line: 2, Severity: "major", Message: "race"},
+			},
+			want: []Finding{
+				{Path: "b.go", Line: 3, Severity: "critical", Message: "sql injection"},
+				{Path: "a.go", Line: 2, Severity: "major", Message: "race"},
+				{Path: "a.go", Line: 9, Severity: "major", Message: "leak"},
+				{Path: "a.go", Line: 5, Severity: "nit", Message: "naming"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dedupeFindings(tt.findings)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,500 @@
+package jarvisTools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tmc/langchaingo/tools"
+)
+
+const (
+	// maxReportedFailures caps how many failures are returned to the model
+	maxReportedFailures = 30
+	// maxFailureMessage caps the length of each failure message
+	maxFailureMessage = 2000
+)
+
+// TestReport is the structured outcome of a test run
+type TestReport struct {
+	Framework string        `json:"framework"`
+	Command   string        `json:"command"`
+	Passed    int           `json:"passed"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+	Total     int           `json:"total"`
+	ExitCode  int           `json:"exit_code"`
+	TimedOut  bool          `json:"timed_out,omitempty"`
+	Duration  string        `json:"duration"`
+	Failures  []TestFailure `json:"failures,omitempty"`
+	// Output holds the runner's output when no results could be parsed,
+	// e.g. on build or collection errors
+	Output string `json:"output,omitempty"`
+}
+
+// TestFailure describes a single failing test
+type TestFailure struct {
+	Name    string `json:"name"`
+	Suite   string `json:"suite,omitempty"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (r *TestReport) addFailure(f TestFailure) {
+	r.Failed++
+	if len(r.Failures) >= maxReportedFailures {
+		return
+	}
+	if len(f.Message) > maxFailureMessage {
+		f.Message = f.Message[:maxFailureMessage] + "\n... [truncated]"
+	}
+	r.Failures = append(r.Failures, f)
+}
+
+type RunTestsTool struct{}
+
+func (t RunTestsTool) Name() string {
+	return "run_tests"
+}
+
+func (t RunTestsTool) Description() string {
+	return "Run a project's tests and return structured results: pass/fail/skip counts and each failure with its message and file/line. Detects Go (go test), Python (pytest) and JavaScript (jest) projects. Input should be JSON with optional 'project_dir' (default current directory), 'framework' (go, pytest or jest), 'target' (package pattern or test file), 'filter' (test name filter) and 'timeout' (seconds, default 600) fields."
+}
+
+func (t RunTestsTool) Call(ctx context.Context, input string) (string, error) {
+	var args struct {
+		ProjectDir string `json:"project_dir"`
+		Framework  string `json:"framework"`
+		Target     string `json:"target"`
+		Filter     string `json:"filter"`
+		Timeout    int    `json:"timeout"`
+	}
+
+	if err := json.Unmarshal([]byte(input), &args); err != nil {
+		return "", fmt.Errorf("invalid input JSON: %v", err)
+	}
+
+	if args.ProjectDir == "" {
+		args.ProjectDir = "."
+	}
+	if args.Timeout == 0 {
+		args.Timeout = 600
+	}
+
+	report, err := runTests(ctx, args.ProjectDir, args.Framework, args.Target, args.Filter, args.Timeout)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode test report: %v", err)
+	}
+
+	return string(out), nil
+}
+
+// RunTests runs all tests in projectDir for callers outside the tool
+// interface. It returns a nil report when no test framework is detected.
+func RunTests(ctx context.Context, projectDir string, timeout int) (*TestReport, error) {
+	framework, err := detectTestFramework(projectDir)
+	if err != nil {
+		return nil, nil
+	}
+	return runTests(ctx, projectDir, framework, "", "", timeout)
+}
+
+// detectTestFramework guesses the test framework from the files in dir
+func detectTestFramework(dir string) (string, error) {
+	switch {
+	case fileExists(filepath.Join(dir, "go.mod")):
+		return "go", nil
+	case fileExists(filepath.Join(dir, "package.json")):
+		return "jest", nil
+	case fileExists(filepath.Join(dir, "pytest.ini")),
+		fileExists(filepath.Join(dir, "pyproject.toml")),
+		fileExists(filepath.Join(dir, "setup.py")),
+		fileExists(filepath.Join(dir, "setup.cfg")),
+		fileExists(filepath.Join(dir, "requirements.txt")),
+		fileExists(filepath.Join(dir, "tests")):
+		return "pytest", nil
+	}
+	return "", fmt.Errorf("could not detect the test framework in %s; set 'framework' to go, pytest or jest", dir)
+}
+
+func runTests(ctx context.Context, projectDir, framework, target, filter string, timeout int) (*TestReport, error) {
+	if framework == "" {
+		detected, err := detectTestFramework(projectDir)
+		if err != nil {
+			return nil, err
+		}
+		framework = detected
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	switch strings.ToLower(framework) {
+	case "go", "golang":
+		return runGoTests(ctx, projectDir, target, filter)
+	case "pytest", "python":
+		return runPytest(ctx, projectDir, target, filter)
+	case "jest", "javascript", "js", "typescript", "ts":
+		return runJest(ctx, projectDir, target, filter)
+	default:
+		return nil, fmt.Errorf("unsupported test framework: %s", framework)
+	}
+}
+
+func newTestReport(framework string, result *ExecResult) *TestReport {
+	return &TestReport{
+		Framework: framework,
+		Command:   result.Command,
+		ExitCode:  result.ExitCode,
+		TimedOut:  result.TimedOut,
+		Duration:  result.Duration.Round(time.Millisecond).String(),
+	}
+}
+
+// finish fills in the total and keeps the raw output when nothing was parsed
+func (r *TestReport) finish(result *ExecResult) {
+	r.Total = r.Passed + r.Failed + r.Skipped
+	if r.Total == 0 || (r.Failed == 0 && !result.Success()) {
+		r.Output = strings.TrimSpace(result.Stdout + "\n" + result.Stderr)
+	}
+}
+
+// goTestEvent is a line of `go test -json` output
+type goTestEvent struct {
+	Action     string `json:"Action"`
+	Package    string `json:"Package"`
+	ImportPath string `json:"ImportPath"`
+	Test       string `json:"Test"`
+	Output     string `json:"Output"`
+}
+
+// goFailureLocation matches the file:line prefix of t.Error/t.Fatal output
+var goFailureLocation = regexp.MustCompile(`^\s+([\w./-]+\.go):(\d+): `)
+
+func runGoTests(ctx context.Context, projectDir, target, filter string) (*TestReport, error) {
+	if target == "" {
+		target = "./..."
+	}
+
+	args := []string{"test", "-json"}
+	if filter != "" {
+		args = append(args, "-run", filter)
+	}
+	args = append(args, target)
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = projectDir
+	cmd.Stdout = &stdout
+
+	result, err := runCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run go tests: %v", err)
+	}
+
+	report := newTestReport("go", result)
+
+	// Output is collected per test (and per package for build errors) so the
+	// failure message only contains what that test printed
+	outputs := make(map[string]*strings.Builder)
+	failedTests := make(map[string]bool)
+
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var event goTestEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+
+		if fields := strings.Fields(event.ImportPath); event.Action == "build-output" && len(fields) > 0 {
+			// Build output is keyed by import path, e.g. "pkg [pkg.test]"
+			event.Package = fields[0]
+		}
+
+		key := event.Package + " " + event.Test
+		switch event.Action {
+		case "output", "build-output":
+			if outputs[key] == nil {
+				outputs[key] = &strings.Builder{}
+			}
+			outputs[key].WriteString(event.Output)
+		case "pass":
+			if event.Test != "" {
+				report.Passed++
+			}
+		case "skip":
+			if event.Test != "" {
+				report.Skipped++
+			}
+		case "fail":
+			if event.Test != "" {
+				failedTests[event.Package] = true
+				report.addFailure(goTestFailure(event, outputs[key]))
+			} else if !failedTests[event.Package] {
+				// The package failed without a failing test: a build error,
+				// a panic in TestMain or a missing package
+				report.addFailure(TestFailure{
+					Name:    event.Package,
+					Suite:   event.Package,
+					Message: strings.TrimSpace(builderString(outputs[key])),
+				})
+			}
+		}
+	}
+
+	report.finish(result)
+	return report, nil
+}
+
+func goTestFailure(event goTestEvent, output *strings.Builder) TestFailure {
+	failure := TestFailure{Name: event.Test, Suite: event.Package}
+
+	var lines []string
+	for _, line := range strings.Split(builderString(output), "\n") {
+		trimmed := strings.TrimSpace(line)
+		// Drop the runner's own status lines
+		if trimmed == "" || strings.HasPrefix(trimmed, "=== ") || strings.HasPrefix(trimmed, "--- FAIL") {
+			continue
+		}
+		if failure.File == "" {
+			if m := goFailureLocation.FindStringSubmatch(line); m != nil {
+				failure.File = m[1]
+				failure.Line, _ = strconv.Atoi(m[2])
+			}
+		}
+		lines = append(lines, trimmed)
+	}
+	failure.Message = strings.Join(lines, "\n")
+
+	return failure
+}
+
+func builderString(b *strings.Builder) string {
+	if b == nil {
+		return ""
+	}
+	return b.String()
+}
+
+// junitSuites covers both a <testsuites> root and a bare <testsuite>
+type junitSuites struct {
+	Suites []junitSuite `xml:"testsuite"`
+	junitSuite
+}
+
+type junitSuite struct {
+	Name  string      `xml:"name,attr"`
+	Cases []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	File      string        `xml:"file,attr"`
+	Line      int           `xml:"line,attr"`
+	Failure   *junitMessage `xml:"failure"`
+	Error     *junitMessage `xml:"error"`
+	Skipped   *junitMessage `xml:"skipped"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// pythonFailureLocation matches the "path.py:12: AssertionError" lines pytest prints
+var pythonFailureLocation = regexp.MustCompile(`(?m)^([\w./-]+\.py):(\d+): `)
+
+func runPytest(ctx context.Context, projectDir, target, filter string) (*TestReport, error) {
+	reportDir, err := ioutil.TempDir("", "jarvis_pytest_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(reportDir)
+	reportPath := filepath.Join(reportDir, "report.xml")
+
+	// xunit1 keeps the file and line attributes on each test case
+	args := []string{"-m", "pytest", "-q", "-o", "junit_family=xunit1", "--junitxml=" + reportPath}
+	if filter != "" {
+		args = append(args, "-k", filter)
+	}
+	if target != "" {
+		args = append(args, target)
+	}
+
+	python := "python3"
+	if fileExists(filepath.Join(projectDir, ".venv", "bin", "python")) {
+		python = filepath.Join(".venv", "bin", "python")
+	}
+
+	cmd := exec.CommandContext(ctx, python, args...)
+	cmd.Dir = projectDir
+
+	result, err := runCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run pytest: %v", err)
+	}
+
+	report := newTestReport("pytest", result)
+
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		// pytest never got as far as writing a report, e.g. it isn't installed
+		report.finish(result)
+		return report, nil
+	}
+
+	var suites junitSuites
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		return nil, fmt.Errorf("failed to parse pytest report: %v", err)
+	}
+
+	all := append(suites.Suites, suites.junitSuite)
+	for _, suite := range all {
+		for _, tc := range suite.Cases {
+			switch {
+			case tc.Failure != nil || tc.Error != nil:
+				msg := tc.Failure
+				if msg == nil {
+					msg = tc.Error
+				}
+				failure := TestFailure{
+					Name:    tc.Name,
+					Suite:   tc.ClassName,
+					File:    tc.File,
+					Message: strings.TrimSpace(msg.Message + "\n" + msg.Text),
+				}
+				// junit lines are zero-based; prefer the assertion location
+				// from the traceback when pytest printed one
+				if tc.Line > 0 || tc.File != "" {
+					failure.Line = tc.Line + 1
+				}
+				if matches := pythonFailureLocation.FindAllStringSubmatch(msg.Text, -1); len(matches) > 0 {
+					last := matches[len(matches)-1]
+					failure.File = last[1]
+					failure.Line, _ = strconv.Atoi(last[2])
+				}
+				report.addFailure(failure)
+			case tc.Skipped != nil:
+				report.Skipped++
+			default:
+				report.Passed++
+			}
+		}
+	}
+
+	report.finish(result)
+	return report, nil
+}
+
+// jestReport is the subset of `jest --json` output used here
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"`
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			FailureMessages []string `json:"failureMessages"`
+			Location        *struct {
+				Line   int `json:"line"`
+				Column int `json:"column"`
+			} `json:"location"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+func runJest(ctx context.Context, projectDir, target, filter string) (*TestReport, error) {
+	reportDir, err := ioutil.TempDir("", "jarvis_jest_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(reportDir)
+	reportPath := filepath.Join(reportDir, "report.json")
+
+	args := []string{"--yes", "jest", "--json", "--testLocationInResults", "--outputFile=" + reportPath}
+	if filter != "" {
+		args = append(args, "-t", filter)
+	}
+	if target != "" {
+		args = append(args, target)
+	}
+
+	cmd := exec.CommandContext(ctx, "npx", args...)
+	cmd.Dir = projectDir
+	cmd.Env = append(os.Environ(), "CI=true")
+
+	result, err := runCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run jest: %v", err)
+	}
+
+	report := newTestReport("jest", result)
+
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		report.finish(result)
+		return report, nil
+	}
+
+	var parsed jestReport
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse jest report: %v", err)
+	}
+
+	for _, file := range parsed.TestResults {
+		// A suite that fails to load has no assertions, only a message
+		if file.Status == "failed" && len(file.AssertionResults) == 0 {
+			report.addFailure(TestFailure{Name: filepath.Base(file.Name), File: file.Name, Message: strings.TrimSpace(file.Message)})
+			continue
+		}
+
+		for _, assertion := range file.AssertionResults {
+			switch assertion.Status {
+			case "passed":
+				report.Passed++
+			case "failed":
+				failure := TestFailure{
+					Name:    assertion.FullName,
+					File:    file.Name,
+					Message: strings.TrimSpace(strings.Join(assertion.FailureMessages, "\n")),
+				}
+				if assertion.Location != nil {
+					failure.Line = assertion.Location.Line
+				}
+				report.addFailure(failure)
+			default:
+				// pending, skipped, todo and disabled
+				report.Skipped++
+			}
+		}
+	}
+
+	report.finish(result)
+	return report, nil
+}
+
+func GetTestTools() []tools.Tool {
+	return []tools.Tool{
+		RunTestsTool{},
+	}
+}
@@ -79,7 +79,7 @@ func (t VisualAnalyserTool) Call(ctx context.Context, input string) (string, err
 	// Extract base64 image from GUI daemon response
 	// The GUI daemon returns it through formatResponse, but we need the raw data
 	// Let's get it directly
-	daemonResp, err := t.guiControl.sendAction(screenshotAction)
+	daemonResp, err := t.guiControl.sendAction(ctx, screenshotAction)
 	if err != nil {
 		return "", fmt.Errorf("failed to get screenshot data: %v", err)
 	}
@@ -99,7 +99,7 @@ func (t VisualAnalyserTool) Call(ctx context.Context, input string) (string, err
 	analyseRequest["screenshot"] = screenshot
 
 	// Send request to visual analyser
-	response, err := t.sendAnalyseRequest(analyseRequest)
+	response, err := t.sendAnalyseRequest(ctx, analyseRequest)
 	if err != nil {
 		return "", err
 	}
@@ -109,7 +109,7 @@ func (t VisualAnalyserTool) Call(ctx context.Context, input string) (string, err
 }
 
 // sendAnalyseRequest sends request to visual analyser service
-func (t *VisualAnalyserTool) sendAnalyseRequest(request map[string]interface{}) (map[string]interface{}, error) {
+func (t *VisualAnalyserTool) sendAnalyseRequest(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
 	// Marshal request
 	requestBody, err := json.Marshal(request)
 	if err != nil {
@@ -117,7 +117,7 @@ func (t *VisualAnalyserTool) sendAnalyseRequest(request map[string]interface{})
 	}
 
 	// Create request
-	req, err := http.NewRequest("POST", t.analyserURL+"/analyze", bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", t.analyserURL+"/analyze", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// markdown renders GitHub flavoured Markdown (tables, strikethrough, task
+// lists, autolinks). Raw HTML in the source is not passed through, and
+// single newlines become <br> as agents' output expects.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.Strikethrough,
+		extension.TaskList,
+		extension.Linkify,
+	),
+	goldmark.WithRendererOptions(goldmarkhtml.WithHardWraps()),
+)
+
+// emailStyles are inlined into rendered tags since many mail clients drop
+// <style> blocks
+var emailStyles = map[string]string{
+	"table":      "border-collapse:collapse;margin:12px 0;",
+	"th":         "border:1px solid #e5e7eb;padding:6px 10px;background:#f9fafb;",
+	"td":         "border:1px solid #e5e7eb;padding:6px 10px;",
+	"pre":        "background:#f3f4f6;border-radius:6px;padding:12px;overflow-x:auto;font-size:13px;line-height:1.45;",
+	"code":       "font-family:Menlo,Consolas,monospace;background:#f3f4f6;border-radius:4px;padding:1px 4px;",
+	"blockquote": "margin:12px 0;padding:0 12px;border-left:4px solid #e5e7eb;color:#4b5563;",
+	"h1":         "font-size:22px;margin:16px 0 8px;",
+	"h2":         "font-size:19px;margin:16px 0 8px;",
+	"h3":         "font-size:16px;margin:16px 0 8px;",
+}
+
+var styledTag = regexp.MustCompile(`<(table|th|td|pre|code|blockquote|h1|h2|h3)([ >])`)
+
+// codeInPre matches the <code> element goldmark puts inside every <pre>,
+// which shouldn't get the inline code background twice
+var codeInPre = regexp.MustCompile(`(<pre style="[^"]*">)<code style="[^"]*"`)
+
+// renderMarkdown converts a Markdown body to HTML with inline styles,
+// falling back to escaped text if rendering fails
+func renderMarkdown(body string) string {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(body), &buf); err != nil {
+		return strings.ReplaceAll(html.EscapeString(body), "\n", "<br>")
+	}
+
+	rendered := styledTag.ReplaceAllStringFunc(buf.String(), func(tag string) string {
+		m := styledTag.FindStringSubmatch(tag)
+		return `<` + m[1] + ` style="` + emailStyles[m[1]] + `"` + m[2]
+	})
+	return codeInPre.ReplaceAllString(rendered, "$1<code")
+}
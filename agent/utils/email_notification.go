@@ -3,85 +3,454 @@ package utils
 import (
 	"bytes"
 	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 )
 
-// SendStyledEmail sends an HTML email via Gmail SMTP with a plain-text fallback.
-// from:        your Gmail address (e.g., "you@gmail.com")
-// appPassword: Gmail App Password (16 chars)
+// SMTPConfig describes how to reach the mail server
+type SMTPConfig struct {
+	Host string
+	Port int
+	// TLS is "starttls" (upgrade after connecting), "tls" (implicit TLS,
+	// usually port 465) or "none"
+	TLS string
+	// Auth is "plain", "login" or "none"
+	Auth     string
+	Username string
+	Password string
+	// From is the default sender address
+	From string
+	// InsecureSkipVerify disables certificate checks, for local relays only
+	InsecureSkipVerify bool
+	Timeout            time.Duration
+}
+
+// SMTPConfigFromEnv reads the SMTP settings from SMTP_* environment
+// variables. EMAIL_FROM and EMAIL_PASSWORD are still honoured as fallbacks.
+func SMTPConfigFromEnv() SMTPConfig {
+	cfg := SMTPConfig{
+		Host:               getEnvOrDefault("SMTP_HOST", "smtp.gmail.com"),
+		TLS:                strings.ToLower(getEnvOrDefault("SMTP_TLS", "starttls")),
+		Auth:               strings.ToLower(getEnvOrDefault("SMTP_AUTH", "plain")),
+		From:               getEnvOrDefault("SMTP_FROM", os.Getenv("EMAIL_FROM")),
+		Password:           getEnvOrDefault("SMTP_PASSWORD", os.Getenv("EMAIL_PASSWORD")),
+		InsecureSkipVerify: os.Getenv("SMTP_INSECURE_SKIP_VERIFY") == "true",
+		Timeout:            30 * time.Second,
+	}
+	cfg.Username = getEnvOrDefault("SMTP_USERNAME", cfg.From)
+
+	cfg.Port, _ = strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS == "tls" {
+			cfg.Port = 465
+		}
+	}
+
+	return cfg
+}
+
+// Attachment is a file sent along with an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Email is a message to send. Body is Markdown; it is sent as is in the
+// plain-text part and rendered for the HTML part.
+type Email struct {
+	From        string
+	To          []string
+	Cc          []string
+	Bcc         []string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+	// InReplyTo and References thread a reply to earlier messages
+	InReplyTo  string
+	References []string
+}
+
+// EmailOption adjusts an email sent by SendStyledEmail
+type EmailOption func(*Email)
+
+// InReplyTo makes the email a reply to the message with the given
+// Message-ID. references is the References chain of that message.
+func InReplyTo(messageID string, references ...string) EmailOption {
+	return func(e *Email) {
+		e.InReplyTo = messageID
+		e.References = append(append([]string{}, references...), messageID)
+	}
+}
+
+// SendStyledEmail sends an HTML email with a plain-text fallback using the
+// SMTP settings from the environment.
+// from:        sender address; empty uses SMTP_FROM
 // to:          list of recipient emails
-// subject:     email subject (ASCII; for UTF-8 subjects, add RFC2047 encoding)
-// message:     your message body (plain text, newlines are preserved)
-func SendStyledEmail(from string, to []string, subject, message string) error {
-	// SMTP config
-	host := "smtp.gmail.com"
-	addr := host + ":587"
+// subject:     email subject (UTF-8 is RFC 2047 encoded)
+// message:     your message body (Markdown, rendered to HTML)
+// opts:        e.g. InReplyTo to answer on an existing thread
+func SendStyledEmail(from string, to []string, subject, message string, opts ...EmailOption) error {
+	email := Email{
+		From:    from,
+		To:      to,
+		Subject: subject,
+		Body:    message,
+	}
+	for _, opt := range opts {
+		opt(&email)
+	}
+	return SendEmail(SMTPConfigFromEnv(), email)
+}
 
-	// Prepare IDs & headers
-	now := time.Now()
-	messageID := fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), randomToken(8), "local")
-	dateHeader := now.Format(time.RFC1123Z)
+// SendEmail builds the message and delivers it through the configured server
+func SendEmail(cfg SMTPConfig, email Email) error {
+	if email.From == "" {
+		email.From = cfg.From
+	}
+	if email.From == "" {
+		return fmt.Errorf("no sender address: set SMTP_FROM")
+	}
 
-	// Build a multipart/alternative message (plain text + HTML)
-	boundary := "bnd_" + randomToken(12)
+	recipients := append(append(append([]string{}, email.To...), email.Cc...), email.Bcc...)
+	if len(recipients) == 0 {
+		return fmt.Errorf("no recipients")
+	}
+	for _, addr := range append([]string{email.From}, recipients...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return fmt.Errorf("invalid address %q", addr)
+		}
+	}
+	for _, id := range append([]string{email.InReplyTo}, email.References...) {
+		if strings.ContainsAny(id, "\r\n") {
+			return fmt.Errorf("invalid message ID %q", id)
+		}
+	}
 
-	// Plain text part (use the raw message)
-	plainPart := message
+	message, err := defaultBuilder.Build(email)
+	if err != nil {
+		return err
+	}
 
-	// HTML part (escape + convert newlines to <br>)
-	escaped := html.EscapeString(message)
-	htmlPart := buildHTMLTemplate(strings.ReplaceAll(escaped, "\n", "<br>"))
+	client, err := dialSMTP(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
 
-	// RFC 5322 headers
+	if err := authenticate(client, cfg); err != nil {
+		return err
+	}
+
+	if err := client.Mail(email.From); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %v", err)
+	}
+	for _, rcpt := range recipients {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("recipient %s rejected: %v", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %v", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %v", err)
+	}
+
+	return client.Quit()
+}
+
+// dialSMTP connects to the server, negotiating TLS as configured
+func dialSMTP(cfg SMTPConfig) (*smtp.Client, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is not set")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLS == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	// Bound the whole session, not just the connect
+	conn.SetDeadline(time.Now().Add(4 * cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP handshake with %s failed: %v", addr, err)
+	}
+
+	switch cfg.TLS {
+	case "tls", "none":
+	case "starttls", "":
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("%s does not support STARTTLS; set SMTP_TLS=none to send unencrypted", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %v", err)
+		}
+	default:
+		client.Close()
+		return nil, fmt.Errorf("unknown SMTP_TLS mode %q", cfg.TLS)
+	}
+
+	return client, nil
+}
+
+func authenticate(client *smtp.Client, cfg SMTPConfig) error {
+	if cfg.Auth == "none" || cfg.Password == "" {
+		return nil
+	}
+	if ok, _ := client.Extension("AUTH"); !ok {
+		return fmt.Errorf("server does not support authentication; set SMTP_AUTH=none")
+	}
+
+	var auth smtp.Auth
+	switch cfg.Auth {
+	case "plain", "":
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	case "login":
+		auth = &loginAuth{username: cfg.Username, password: cfg.Password}
+	default:
+		return fmt.Errorf("unknown SMTP_AUTH mechanism %q", cfg.Auth)
+	}
+
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("SMTP authentication failed: %v", err)
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism still required by some servers
+type loginAuth struct {
+	username, password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS {
+		return "", nil, fmt.Errorf("refusing LOGIN authentication over an unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+}
+
+// MessageBuilder renders emails as MIME messages. Now and Random are the
+// only sources of variation, so fixing them makes the output reproducible.
+type MessageBuilder struct {
+	Now func() time.Time
+	// Random supplies the bytes for boundaries and Message-IDs
+	Random io.Reader
+	// Domain is the right-hand side of generated Message-IDs
+	Domain string
+}
+
+// defaultBuilder is used by SendEmail
+var defaultBuilder = MessageBuilder{Now: time.Now, Random: rand.Reader, Domain: "local"}
+
+// Build renders the email as multipart/alternative (plain text + HTML
+// rendered from the body's Markdown), wrapped in multipart/mixed when there
+// are attachments. Text parts are quoted-printable and non-ASCII headers are
+// RFC 2047 encoded.
+func (b MessageBuilder) Build(email Email) ([]byte, error) {
+	now := b.Now()
 	var buf bytes.Buffer
-	writeHeader(&buf, "From", from)
-	writeHeader(&buf, "To", strings.Join(to, ", "))
-	writeHeader(&buf, "Subject", subject)
-	writeHeader(&buf, "Date", dateHeader)
-	writeHeader(&buf, "Message-ID", messageID)
+
+	// RFC 5322 headers
+	writeHeader(&buf, "From", formatAddressList([]string{email.From}))
+	writeHeader(&buf, "To", formatAddressList(email.To))
+	if len(email.Cc) > 0 {
+		writeHeader(&buf, "Cc", formatAddressList(email.Cc))
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("UTF-8", email.Subject))
+	writeHeader(&buf, "Date", now.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), b.token(8), b.Domain))
+	if email.InReplyTo != "" {
+		writeHeader(&buf, "In-Reply-To", email.InReplyTo)
+	}
+	if len(email.References) > 0 {
+		// One ID per line keeps long threads within the line length limit
+		writeHeader(&buf, "References", strings.Join(email.References, "\r\n "))
+	}
 	writeHeader(&buf, "MIME-Version", "1.0")
-	writeHeader(&buf, "Content-Type", fmt.Sprintf(`multipart/alternative; boundary="%s"`, boundary))
+
+	htmlPart := buildHTMLTemplate(renderMarkdown(email.Body), now)
+
+	if len(email.Attachments) == 0 {
+		alternative := b.multipartWriter(&buf)
+		writeHeader(&buf, "Content-Type", fmt.Sprintf("multipart/alternative;\r\n boundary=\"%s\"", alternative.Boundary()))
+		buf.WriteString("\r\n")
+		if err := writeAlternative(alternative, email.Body, htmlPart); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := b.multipartWriter(&buf)
+	writeHeader(&buf, "Content-Type", fmt.Sprintf("multipart/mixed;\r\n boundary=\"%s\"", mixed.Boundary()))
 	buf.WriteString("\r\n")
 
-	// Plain text section
-	fmt.Fprintf(&buf, "--%s\r\n", boundary)
-	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-	buf.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
-	buf.WriteString(plainPart + "\r\n")
+	var body bytes.Buffer
+	alternative := b.multipartWriter(&body)
+	if err := writeAlternative(alternative, email.Body, htmlPart); err != nil {
+		return nil, err
+	}
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative;\r\n boundary=\"%s\"", alternative.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body.Bytes())
+
+	for _, a := range email.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := mixed.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": a.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, a.Data)
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (b MessageBuilder) multipartWriter(w io.Writer) *multipart.Writer {
+	mw := multipart.NewWriter(w)
+	mw.SetBoundary("bnd_" + b.token(16))
+	return mw
+}
+
+func (b MessageBuilder) token(n int) string {
+	t := make([]byte, n)
+	_, _ = io.ReadFull(b.Random, t)
+	return hex.EncodeToString(t)
+}
+
+// formatAddressList formats addresses for a header, encoding non-ASCII
+// display names. Addresses that don't parse are used as given.
+func formatAddressList(addresses []string) string {
+	formatted := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if addr, err := mail.ParseAddress(a); err == nil {
+			formatted = append(formatted, addr.String())
+		} else {
+			formatted = append(formatted, a)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func writeAlternative(w *multipart.Writer, plain, htmlBody string) error {
+	// Plain text section; the Markdown source reads fine as text
+	if err := writeQuotedPrintable(w, "text/plain; charset=UTF-8", plain); err != nil {
+		return err
+	}
 
 	// HTML section
-	fmt.Fprintf(&buf, "--%s\r\n", boundary)
-	buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-	buf.WriteString("Content-Transfer-Encoding: 7bit\r\n\r\n")
-	buf.WriteString(htmlPart + "\r\n")
+	if err := writeQuotedPrintable(w, "text/html; charset=UTF-8", htmlBody); err != nil {
+		return err
+	}
 
-	// Closing boundary
-	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return w.Close()
+}
+
+// writeQuotedPrintable adds a quoted-printable part; line endings are
+// normalised to CRLF by the encoder
+func writeQuotedPrintable(w *multipart.Writer, contentType, text string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(text, "\r\n", "\n") + "\n")); err != nil {
+		return err
+	}
+	return qp.Close()
+}
 
-	// Auth & send
-	pssw := os.Getenv("EMAIL_PASSWORD")
-	auth := smtp.PlainAuth("", from, pssw, host)
-	return smtp.SendMail(addr, auth, from, to, buf.Bytes())
+// writeBase64Lines writes data base64 encoded in 76 character lines
+func writeBase64Lines(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
 }
 
 func writeHeader(buf *bytes.Buffer, k, v string) {
 	buf.WriteString(k + ": " + v + "\r\n")
 }
 
-func randomToken(n int) string {
-	b := make([]byte, n)
-	_, _ = rand.Read(b)
-	return base64.RawURLEncoding.EncodeToString(b)
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
 }
 
 // Simple, clean HTML card with inline styles (plays nice in Gmail/Outlook)
-func buildHTMLTemplate(body string) string {
+func buildHTMLTemplate(body string, now time.Time) string {
 	return `<!doctype html>
 <html lang="en">
 <head>
@@ -108,7 +477,7 @@ func buildHTMLTemplate(body string) string {
           </tr>
           <tr>
             <td style="padding:10px 20px 22px;color:#6b7280;font-size:12px;border-top:1px solid #f0f2f6;">
-              Sent via Go · ` + time.Now().Format("2006-01-02 15:04 MST") + `
+              Sent via Go · ` + now.Format("2006-01-02 15:04 MST") + `
             </td>
           </tr>
         </table>
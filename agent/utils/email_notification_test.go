@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"jarvis/agent/utils/smtpstub"
+)
+
+// newTestSMTP starts an smtpstub server and returns a config for it
+func newTestSMTP(t *testing.T) (SMTPConfig, *smtpstub.Server) {
+	t.Helper()
+
+	server, err := smtpstub.Start("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+
+	return SMTPConfig{
+		Host: "127.0.0.1",
+		Port: server.Port(),
+		TLS:  "none",
+		Auth: "none",
+		From: "jarvis@example.com",
+	}, server
+}
+
+func TestSendEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*SMTPConfig)
+		email  Email
+		rcpt   []string
+		err    string
+	}{
+		{
+			name:  "to, cc and bcc",
+			email: Email{To: []string{"a@example.com"}, Cc: []string{"b@example.com"}, Bcc: []string{"c@example.com"}, Subject: "s", Body: "b"},
+			rcpt:  []string{"a@example.com", "b@example.com", "c@example.com"},
+		},
+		{
+			name:   "plain auth",
+			config: func(c *SMTPConfig) { c.Auth, c.Username, c.Password = "plain", "jarvis", "secret" },
+			email:  Email{To: []string{"a@example.com"}, Body: "b"},
+			rcpt:   []string{"a@example.com"},
+		},
+		{
+			name:   "login auth refused without TLS",
+			config: func(c *SMTPConfig) { c.Auth, c.Username, c.Password = "login", "jarvis", "secret" },
+			email:  Email{To: []string{"a@example.com"}, Body: "b"},
+			err:    "refusing LOGIN authentication over an unencrypted connection",
+		},
+		{
+			name:   "unknown auth mechanism",
+			config: func(c *SMTPConfig) { c.Auth, c.Password = "cram-md5", "secret" },
+			email:  Email{To: []string{"a@example.com"}, Body: "b"},
+			err:    "unknown SMTP_AUTH mechanism",
+		},
+		{
+			name:   "starttls required",
+			config: func(c *SMTPConfig) { c.TLS = "starttls" },
+			email:  Email{To: []string{"a@example.com"}, Body: "b"},
+			err:    "does not support STARTTLS",
+		},
+		{
+			name:   "no sender",
+			config: func(c *SMTPConfig) { c.From = "" },
+			email:  Email{To: []string{"a@example.com"}, Body: "b"},
+			err:    "no sender address",
+		},
+		{
+			name:  "no recipients",
+			email: Email{Body: "b"},
+			err:   "no recipients",
+		},
+		{
+			name:  "header injection in address",
+			email: Email{To: []string{"a@example.com\r\nBcc: x@example.com"}, Body: "b"},
+			err:   "invalid address",
+		},
+		{
+			name:  "header injection in message ID",
+			email: Email{To: []string{"a@example.com"}, Body: "b", InReplyTo: "<id@x>\r\nBcc: x@example.com"},
+			err:   "invalid message ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, server := newTestSMTP(t)
+			if tt.config != nil {
+				tt.config(&cfg)
+			}
+
+			err := SendEmail(cfg, tt.email)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				if n := len(server.Messages()); n != 0 {
+					t.Errorf("%d messages sent despite the error", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			messages := server.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages, want 1", len(messages))
+			}
+			if messages[0].From != cfg.From {
+				t.Errorf("got sender %q, want %q", messages[0].From, cfg.From)
+			}
+			if !reflect.DeepEqual(messages[0].To, tt.rcpt) {
+				t.Errorf("got recipients %v, want %v", messages[0].To, tt.rcpt)
+			}
+
+			msg, err := messages[0].Parsed()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bcc := msg.Header.Get("Bcc"); bcc != "" {
+				t.Errorf("Bcc header leaked: %q", bcc)
+			}
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// sequenceReader yields 0, 1, 2, ... so boundaries and Message-IDs are
+// reproducible
+type sequenceReader struct {
+	next byte
+}
+
+func (r *sequenceReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.next
+		r.next++
+	}
+	return len(p), nil
+}
+
+func TestMessageBuilderBuild(t *testing.T) {
+	tests := []struct {
+		name  string
+		email Email
+	}{
+		{
+			name: "plain",
+			email: Email{
+				From:    "jarvis@example.com",
+				To:      []string{"owner@example.com"},
+				Subject: "Build finished",
+				Body:    "The build finished without errors.\n\nNothing else to report.",
+			},
+		},
+		{
+			name: "utf8",
+			email: Email{
+				From:    "Jarvis Ünal <jarvis@example.com>",
+				To:      []string{"Zoë Ğüneş <zoe@example.com>"},
+				Cc:      []string{"team@example.com"},
+				Subject: "Rapor hazır ✓ — größer als gestern",
+				Body:    "Merhaba, rapor hazır. Çalışma süresi: 3 dakika.",
+			},
+		},
+		{
+			name: "markdown",
+			email: Email{
+				From:    "jarvis@example.com",
+				To:      []string{"owner@example.com"},
+				Subject: "Test results",
+				Body: "## Summary\n\n" +
+					"| Package | Passed | Failed |\n" +
+					"|---|---:|---:|\n" +
+					"| tools | 12 | 0 |\n" +
+					"| utils | 4 | 1 |\n\n" +
+					"Failure:\n\n" +
+					"```go\nif got != want {\n\tt.Errorf(\"got %d <want> %d\", got, want)\n}\n```\n\n" +
+					"- rerun with `go test -run TestX`\n- see **logs**",
+			},
+		},
+		{
+			name: "attachments",
+			email: Email{
+				From:    "jarvis@example.com",
+				To:      []string{"owner@example.com"},
+				Subject: "Screenshot",
+				Body:    "Screenshot and log attached.",
+				Attachments: []Attachment{
+					{Filename: "screen.png", ContentType: "image/png", Data: bytes.Repeat([]byte("\x89PNG\r\n\x1a\n"), 20)},
+					{Filename: "run log.txt", Data: []byte("line 1\nline 2\n")},
+				},
+			},
+		},
+		{
+			name: "reply",
+			email: Email{
+				From:       "jarvis@example.com",
+				To:         []string{"owner@example.com"},
+				Subject:    "Re: Deploy today?",
+				Body:       "Yes, deploying at 16:00.",
+				InReplyTo:  "<msg-3@mail.example.com>",
+				References: []string{"<msg-1@mail.example.com>", "<msg-2@mail.example.com>", "<msg-3@mail.example.com>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := MessageBuilder{
+				Now: func() time.Time {
+					return time.Date(2024, 3, 9, 14, 30, 5, 0, time.FixedZone("CET", 3600))
+				},
+				Random: &sequenceReader{},
+				Domain: "jarvis.test",
+			}
+
+			got, err := builder.Build(tt.email)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("message differs from %s (run go test -update to accept it):\n%s", golden, got)
+			}
+		})
+	}
+}
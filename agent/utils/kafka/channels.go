@@ -7,6 +7,9 @@ const (
 	VisualAnalyserAgentTopic = "visual-analyser-requests"
 	GUIAgentTopic            = "gui-agent-requests"
 	IPRegistrationTopic      = "ip-registration-requests"
+
+	// CoderResultTopic carries the outcome of coder agent requests
+	CoderResultTopic = "coder-agent-results"
 )
 
 // AgentMessage represents a message sent between agents
@@ -16,6 +19,25 @@ type AgentMessage struct {
 	Demand    string `json:"demand"`
 	Timestamp int64  `json:"timestamp"`
 	ImageData string `json:"image_data,omitempty"` // Base64 encoded image for visual analyser
+	Workspace string `json:"workspace,omitempty"`  // Workspace directory for the coder agent, relative to its workspace root
+}
+
+// CoderResult is published by the coder agent when it finishes a request
+type CoderResult struct {
+	ID            string   `json:"id"`
+	RequestID     string   `json:"request_id"`
+	UserID        string   `json:"user_id"`
+	Status        string   `json:"status"` // committed, no_changes, tests_failed or failed
+	Plan          []string `json:"plan,omitempty"`
+	Summary       string   `json:"summary,omitempty"`
+	Workspace     string   `json:"workspace"`
+	Branch        string   `json:"branch,omitempty"`
+	Commit        string   `json:"commit,omitempty"`
+	Tests         string   `json:"tests,omitempty"` // e.g. "go: 12 passed, 0 failed, 1 skipped"
+	Diff          string   `json:"diff,omitempty"`
+	DiffTruncated bool     `json:"diff_truncated,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	Timestamp     int64    `json:"timestamp"`
 }
 
 // IPRegistrationMessage represents a message for IP registration
@@ -1 +1,104 @@
 package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Consumer wraps a Kafka reader in a consumer group
+type Consumer struct {
+	reader *kafka.Reader
+}
+
+// NewConsumer creates a consumer for topic. Consumers sharing a groupID
+// split the topic's messages between them.
+func NewConsumer(topic, groupID string) (*Consumer, error) {
+	if groupID == "" {
+		return nil, fmt.Errorf("consumer group ID is required")
+	}
+
+	brokers := os.Getenv("KAFKA_BROKERS")
+	if brokers == "" {
+		brokers = "localhost:9092"
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  strings.Split(brokers, ","),
+		Topic:    topic,
+		GroupID:  groupID,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+
+	return &Consumer{
+		reader: reader,
+	}, nil
+}
+
+// Consume reads messages until ctx is cancelled, calling handle for each.
+// A message is committed once handle returns, whether or not it failed, so
+// a request that keeps failing is not redelivered forever. Messages that
+// can't be decoded are logged and skipped.
+func (c *Consumer) Consume(ctx context.Context, handle func(context.Context, AgentMessage) error) error {
+	return c.consume(ctx, func(kafkaMessage kafka.Message) {
+		var message AgentMessage
+		if err := json.Unmarshal(kafkaMessage.Value, &message); err != nil {
+			log.Printf("Skipping malformed message on topic %s at offset %d: %v", kafkaMessage.Topic, kafkaMessage.Offset, err)
+			return
+		}
+		log.Printf("Message received from topic %s: %s", kafkaMessage.Topic, message.ID)
+		if err := handle(ctx, message); err != nil {
+			log.Printf("Failed to handle message %s: %v", message.ID, err)
+		}
+	})
+}
+
+// ConsumeCoderResults is Consume for consumers of CoderResultTopic
+func (c *Consumer) ConsumeCoderResults(ctx context.Context, handle func(context.Context, CoderResult) error) error {
+	return c.consume(ctx, func(kafkaMessage kafka.Message) {
+		var result CoderResult
+		if err := json.Unmarshal(kafkaMessage.Value, &result); err != nil {
+			log.Printf("Skipping malformed result on topic %s at offset %d: %v", kafkaMessage.Topic, kafkaMessage.Offset, err)
+			return
+		}
+		log.Printf("Coder result received from topic %s: %s (%s)", kafkaMessage.Topic, result.RequestID, result.Status)
+		if err := handle(ctx, result); err != nil {
+			log.Printf("Failed to handle coder result %s: %v", result.RequestID, err)
+		}
+	})
+}
+
+// consume fetches messages until ctx is cancelled and commits each one
+// after handle returns
+func (c *Consumer) consume(ctx context.Context, handle func(kafka.Message)) error {
+	for {
+		kafkaMessage, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch message: %v", err)
+		}
+
+		handle(kafkaMessage)
+
+		if err := c.reader.CommitMessages(ctx, kafkaMessage); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to commit message: %v", err)
+		}
+	}
+}
+
+// Close closes the consumer
+func (c *Consumer) Close() error {
+	return c.reader.Close()
+}
@@ -133,3 +133,31 @@ func SendIPRegistrationRequest(ctx context.Context, message IPRegistrationMessag
 	log.Printf("IP registration request sent to topic %s: %s", IPRegistrationTopic, message.ID)
 	return nil
 }
+
+// SendCoderResult publishes the outcome of a coder agent request
+func SendCoderResult(ctx context.Context, result CoderResult) error {
+	producer, err := NewProducer(CoderResultTopic)
+	if err != nil {
+		return fmt.Errorf("failed to create coder result producer: %v", err)
+	}
+	defer producer.Close()
+
+	messageBytes, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to marshal coder result: %v", err)
+	}
+
+	kafkaMessage := kafka.Message{
+		Key:   []byte(result.RequestID),
+		Value: messageBytes,
+		Time:  time.Now(),
+	}
+
+	err = producer.writer.WriteMessages(ctx, kafkaMessage)
+	if err != nil {
+		return fmt.Errorf("failed to write coder result: %v", err)
+	}
+
+	log.Printf("Coder result sent to topic %s: %s (%s)", CoderResultTopic, result.RequestID, result.Status)
+	return nil
+}
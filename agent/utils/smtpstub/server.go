@@ -0,0 +1,186 @@
+// Package smtpstub is a minimal in-process SMTP server that records the
+// messages it receives. It stands in for a real mail server when trying out
+// or testing email features locally; it does no delivery.
+package smtpstub
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the server
+type Message struct {
+	From string
+	To   []string
+	// Data is the raw message as sent after DATA
+	Data string
+}
+
+// Parsed parses the raw message
+func (m Message) Parsed() (*mail.Message, error) {
+	return mail.ReadMessage(strings.NewReader(m.Data))
+}
+
+// Server accepts SMTP connections and keeps every message it receives.
+// Authentication is accepted without checking credentials.
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []Message
+	wg       sync.WaitGroup
+}
+
+// Start listens on addr (e.g. "127.0.0.1:0" for a free port) and serves in
+// the background until Close is called
+func Start(addr string) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+
+	s := &Server{listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Port returns the port the server listens on
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and waits for open sessions to finish
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.session(conn)
+		}()
+	}
+}
+
+// session speaks just enough SMTP for net/smtp and most clients
+func (s *Server) session(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var current Message
+	reply("220 smtpstub ready")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		arg := strings.TrimSpace(strings.TrimPrefix(line, strings.SplitN(line, " ", 2)[0]))
+
+		switch verb {
+		case "EHLO":
+			reply("250-smtpstub")
+			reply("250-AUTH PLAIN LOGIN")
+			reply("250 8BITMIME")
+		case "HELO":
+			reply("250 smtpstub")
+		case "AUTH":
+			if strings.HasPrefix(strings.ToUpper(arg), "LOGIN") {
+				reply("334 VXNlcm5hbWU6")
+				r.ReadString('\n')
+				reply("334 UGFzc3dvcmQ6")
+				r.ReadString('\n')
+			} else if !strings.Contains(arg, " ") {
+				// PLAIN without an initial response
+				reply("334 ")
+				r.ReadString('\n')
+			}
+			reply("235 authenticated")
+		case "MAIL":
+			current = Message{From: address(arg)}
+			reply("250 ok")
+		case "RCPT":
+			current.To = append(current.To, address(arg))
+			reply("250 ok")
+		case "DATA":
+			if len(current.To) == 0 {
+				reply("503 need RCPT first")
+				continue
+			}
+			reply("354 end data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" || line == ".\n" {
+					break
+				}
+				// Undo dot-stuffing
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			current.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = Message{}
+			reply("250 queued")
+		case "RSET":
+			current = Message{}
+			reply("250 ok")
+		case "NOOP":
+			reply("250 ok")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// address extracts the address from "FROM:<a@b>" or "TO:<a@b> PARAMS"
+func address(arg string) string {
+	if i := strings.Index(arg, "<"); i >= 0 {
+		if j := strings.Index(arg[i:], ">"); j >= 0 {
+			return arg[i+1 : i+j]
+		}
+	}
+	if i := strings.Index(arg, ":"); i >= 0 {
+		return strings.TrimSpace(arg[i+1:])
+	}
+	return arg
+}
@@ -37,8 +37,8 @@ func (s *VisualAnalyserServer) handleAnalyze(w http.ResponseWriter, r *http.Requ
 	log.Printf("Analyze request: action=%s, query=%s, screenshot_length=%d",
 		req.Action, req.Query, len(req.Screenshot))
 
-	// Process request
-	response, err := s.analyzer.AnalyzeScreen(req)
+	// Process request; the vision call is abandoned if the client goes away
+	response, err := s.analyzer.AnalyzeScreen(r.Context(), req)
 	if err != nil {
 		log.Printf("Error analyzing screen: %v", err)
 		w.Header().Set("Content-Type", "application/json")
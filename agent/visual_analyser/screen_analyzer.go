@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 )
@@ -18,25 +19,25 @@ func NewScreenAnalyzer() *ScreenAnalyzer {
 }
 
 // AnalyzeScreen processes screen analysis requests
-func (sa *ScreenAnalyzer) AnalyzeScreen(req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
+func (sa *ScreenAnalyzer) AnalyzeScreen(ctx context.Context, req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
 	log.Printf("Processing screen analysis: action=%s, query=%s", req.Action, req.Query)
 
 	switch req.Action {
 	case "find_element":
-		return sa.findElement(req)
+		return sa.findElement(ctx, req)
 	case "find_coordinates":
-		return sa.findCoordinates(req)
+		return sa.findCoordinates(ctx, req)
 	case "detect_text":
-		return sa.detectText(req)
+		return sa.detectText(ctx, req)
 	case "describe_screen":
-		return sa.describeScreen(req)
+		return sa.describeScreen(ctx, req)
 	default:
 		return nil, fmt.Errorf("unsupported action: %s", req.Action)
 	}
 }
 
 // findElement finds a UI element and returns its details
-func (sa *ScreenAnalyzer) findElement(req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
+func (sa *ScreenAnalyzer) findElement(ctx context.Context, req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
 	if req.Query == "" {
 		return nil, fmt.Errorf("query is required for find_element action")
 	}
@@ -45,7 +46,7 @@ func (sa *ScreenAnalyzer) findElement(req AnalyzeScreenRequest) (*AnalyzeScreenR
 		return nil, fmt.Errorf("screenshot is required")
 	}
 
-	elements, err := sa.visionService.FindElement(req.Screenshot, req.Query)
+	elements, err := sa.visionService.FindElement(ctx, req.Screenshot, req.Query)
 	if err != nil {
 		return &AnalyzeScreenResponse{
 			Success: false,
@@ -62,17 +63,17 @@ func (sa *ScreenAnalyzer) findElement(req AnalyzeScreenRequest) (*AnalyzeScreenR
 }
 
 // findCoordinates is an alias for findElement (focused on getting coordinates)
-func (sa *ScreenAnalyzer) findCoordinates(req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
-	return sa.findElement(req)
+func (sa *ScreenAnalyzer) findCoordinates(ctx context.Context, req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
+	return sa.findElement(ctx, req)
 }
 
 // detectText extracts all text from the screenshot
-func (sa *ScreenAnalyzer) detectText(req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
+func (sa *ScreenAnalyzer) detectText(ctx context.Context, req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
 	if req.Screenshot == "" {
 		return nil, fmt.Errorf("screenshot is required")
 	}
 
-	textContent, err := sa.visionService.DetectText(req.Screenshot)
+	textContent, err := sa.visionService.DetectText(ctx, req.Screenshot)
 	if err != nil {
 		return &AnalyzeScreenResponse{
 			Success: false,
@@ -97,12 +98,12 @@ func (sa *ScreenAnalyzer) detectText(req AnalyzeScreenRequest) (*AnalyzeScreenRe
 }
 
 // describeScreen provides full screen description
-func (sa *ScreenAnalyzer) describeScreen(req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
+func (sa *ScreenAnalyzer) describeScreen(ctx context.Context, req AnalyzeScreenRequest) (*AnalyzeScreenResponse, error) {
 	if req.Screenshot == "" {
 		return nil, fmt.Errorf("screenshot is required")
 	}
 
-	description, err := sa.visionService.DescribeScreen(req.Screenshot)
+	description, err := sa.visionService.DescribeScreen(ctx, req.Screenshot)
 	if err != nil {
 		return &AnalyzeScreenResponse{
 			Success: false,
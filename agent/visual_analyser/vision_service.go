@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -40,7 +41,7 @@ func NewVisionService() *VisionService {
 }
 
 // AnalyzeImage sends image to vision model with prompt
-func (vs *VisionService) AnalyzeImage(imageBase64 string, prompt string) (string, error) {
+func (vs *VisionService) AnalyzeImage(ctx context.Context, imageBase64 string, prompt string) (string, error) {
 	log.Printf("Analyzing image with prompt: %s", prompt)
 
 	// Create request
@@ -63,7 +64,7 @@ func (vs *VisionService) AnalyzeImage(imageBase64 string, prompt string) (string
 	}
 
 	// Send request to Ollama
-	httpReq, err := http.NewRequest("POST", vs.ollamaHost+"/api/chat", bytes.NewBuffer(reqBody))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", vs.ollamaHost+"/api/chat", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
@@ -94,7 +95,7 @@ func (vs *VisionService) AnalyzeImage(imageBase64 string, prompt string) (string
 }
 
 // FindElement finds a specific UI element in the screenshot
-func (vs *VisionService) FindElement(imageBase64 string, elementQuery string) ([]DetectedElement, error) {
+func (vs *VisionService) FindElement(ctx context.Context, imageBase64 string, elementQuery string) ([]DetectedElement, error) {
 	prompt := fmt.Sprintf(`You are a GUI element detector. Analyze this screenshot and find: "%s"
 
 IMPORTANT: Respond ONLY with valid JSON in this exact format:
@@ -115,7 +116,7 @@ Rules:
 - If element not found, return empty elements array
 - No markdown, no explanations, only JSON`, elementQuery)
 
-	response, err := vs.AnalyzeImage(imageBase64, prompt)
+	response, err := vs.AnalyzeImage(ctx, imageBase64, prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -135,7 +136,7 @@ Rules:
 }
 
 // DescribeScreen provides a full description of the screen
-func (vs *VisionService) DescribeScreen(imageBase64 string) (string, error) {
+func (vs *VisionService) DescribeScreen(ctx context.Context, imageBase64 string) (string, error) {
 	prompt := `Analyze this screenshot and provide a detailed description:
 
 1. What application or website is visible?
@@ -145,11 +146,11 @@ func (vs *VisionService) DescribeScreen(imageBase64 string) (string, error) {
 
 Be specific and mention positions (top, bottom, left, right, center).`
 
-	return vs.AnalyzeImage(imageBase64, prompt)
+	return vs.AnalyzeImage(ctx, imageBase64, prompt)
 }
 
 // DetectText extracts text from the screenshot using vision model
-func (vs *VisionService) DetectText(imageBase64 string) ([]string, error) {
+func (vs *VisionService) DetectText(ctx context.Context, imageBase64 string) ([]string, error) {
 	prompt := `Extract ALL visible text from this screenshot.
 
 IMPORTANT: Respond ONLY with valid JSON in this exact format:
@@ -163,7 +164,7 @@ Rules:
 - Include button labels, field labels, menu items, etc.
 - No markdown, no explanations, only JSON`
 
-	response, err := vs.AnalyzeImage(imageBase64, prompt)
+	response, err := vs.AnalyzeImage(ctx, imageBase64, prompt)
 	if err != nil {
 		return nil, err
 	}
@@ -198,8 +199,13 @@ func (vs *VisionService) extractCoordinatesFromText(text string, elementName str
 }
 
 // GetModelInfo returns information about the vision model
-func (vs *VisionService) GetModelInfo() (string, error) {
-	resp, err := vs.client.Get(vs.ollamaHost + "/api/tags")
+func (vs *VisionService) GetModelInfo(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", vs.ollamaHost+"/api/tags", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := vs.client.Do(req)
 	if err != nil {
 		return "", err
 	}